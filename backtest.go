@@ -0,0 +1,242 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"gocta/internal"
+)
+
+func runBacktest(args []string) error {
+	var (
+		f          engineFlags
+		params     string
+		configFile string
+		format     string
+		database   string
+	)
+	fs := flag.NewFlagSet("backtest", flag.ExitOnError)
+	f.register(fs)
+	fs.StringVar(&params, "params", "", "策略参数，如 window=20,dev=2")
+	fs.StringVar(&configFile, "config", "", "回测配置文件 yaml/toml/json，设置后只能再使用 -out、-format 和 -results-dsn 参数")
+	fs.StringVar(&format, "format", "", "成交、委托和逐日结果的导出格式: csv 或 jsonl，默认 csv")
+	fs.StringVar(&database, "results-dsn", "", "结果库 mysql 数据源，设置后保存本次回测")
+	fs.Parse(args)
+
+	output := internal.OutputConfig{Dir: f.out, Format: internal.ExportFormat(format), Database: database}
+	if configFile != "" {
+		if err := onlyFlags(fs, "config", "out", "format", "results-dsn"); err != nil {
+			return err
+		}
+		return runBacktestConfig(configFile, output)
+	}
+
+	cfg, err := f.config()
+	if err != nil {
+		return err
+	}
+	factory, err := f.factory()
+	if err != nil {
+		return err
+	}
+	strategyParams, err := parseParams(params)
+	if err != nil {
+		return err
+	}
+	if cfg.Strategy, err = factory(strategyParams); err != nil {
+		return err
+	}
+
+	if output.Format == "" {
+		output.Format = internal.ExportCSV
+	}
+	return backtest(cfg, f.strategy, strategyParams, output)
+}
+
+// onlyFlags 命令行设置了 allowed 以外的参数时返回错误，避免参数被配置文件静默忽略
+func onlyFlags(fs *flag.FlagSet, allowed ...string) error {
+	var conflicts []string
+	fs.Visit(func(f *flag.Flag) {
+		for _, name := range allowed {
+			if f.Name == name {
+				return
+			}
+		}
+		conflicts = append(conflicts, "-"+f.Name)
+	})
+	if len(conflicts) > 0 {
+		return fmt.Errorf("使用 -config 时不能设置 %s，请在配置文件中设置", strings.Join(conflicts, ", "))
+	}
+	return nil
+}
+
+// runBacktestConfig 使用配置文件回测，命令行的输出参数优先于配置文件
+func runBacktestConfig(path string, output internal.OutputConfig) error {
+	c, err := internal.LoadBacktestConfig(path)
+	if err != nil {
+		return err
+	}
+	cfg, err := c.EngineCfg()
+	if err != nil {
+		return err
+	}
+	if output.Dir == "" {
+		output.Dir = c.Output.Dir
+	}
+	if output.Format == "" {
+		output.Format = c.Output.Format
+	}
+	if output.Database == "" {
+		output.Database = c.Output.Database
+	}
+	return backtest(cfg, c.Strategy.Name, c.Strategy.Params, output)
+}
+
+func backtest(cfg internal.EngineCfg, strategy string, params map[string]float64, output internal.OutputConfig) error {
+	result, err := internal.Evaluate(cfg)
+	if err != nil {
+		return err
+	}
+
+	printStatistics(os.Stdout, result.Statistics)
+	fmt.Println("回测指纹:", result.Fingerprint)
+
+	if output.Database != "" {
+		store, err := internal.NewResultStoreWithDSN(output.Database)
+		if err != nil {
+			return err
+		}
+		id, err := store.SaveRun(internal.NewBacktestRun(cfg, strategy, params, result), result)
+		if err != nil {
+			return err
+		}
+		fmt.Println("回测记录已保存，编号:", id)
+	}
+
+	out := output.Dir
+	if out == "" {
+		return nil
+	}
+	err = writeJSON(filepath.Join(out, "statistics.json"), map[string]any{
+		"strategy":    strategy,
+		"params":      params,
+		"statistics":  result.Statistics,
+		"fingerprint": result.Fingerprint,
+	})
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(out, "report.html")
+	if err = internal.SaveReport(path, fmt.Sprintf("%s %s 回测报告", strategy, cfg.Symbol), result); err != nil {
+		return err
+	}
+	fmt.Println("报告已写入:", path)
+
+	paths, err := internal.ExportResult(out, output.Format, result)
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		fmt.Println("结果已写入:", path)
+	}
+	return nil
+}
+
+func runOptimize(args []string) error {
+	var (
+		f      engineFlags
+		params string
+		target string
+		top    int
+	)
+	fs := flag.NewFlagSet("optimize", flag.ExitOnError)
+	f.register(fs)
+	fs.StringVar(&params, "params", "", "优化参数，如 window=10:30:5,dev=2")
+	fs.StringVar(&target, "target", "total_net_pnl", "优化目标指标")
+	fs.IntVar(&top, "top", 10, "输出前几组结果")
+	fs.Parse(args)
+
+	cfg, err := f.config()
+	if err != nil {
+		return err
+	}
+	factory, err := f.factory()
+	if err != nil {
+		return err
+	}
+	setting, err := parseRanges(params)
+	if err != nil {
+		return err
+	}
+	setting.Target = target
+
+	results, err := internal.Optimize(cfg, factory, setting)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "排名\t参数\t%s\n", target)
+	for i, result := range results {
+		if i >= top {
+			break
+		}
+		fmt.Fprintf(w, "%d\t%v\t%.4f\n", i+1, result.Params, result.Target)
+	}
+	w.Flush()
+
+	if f.out == "" {
+		return nil
+	}
+	return writeJSON(filepath.Join(f.out, "optimization.json"), map[string]any{
+		"strategy": f.strategy,
+		"target":   target,
+		"results":  results,
+	})
+}
+
+func runStrategies() {
+	for _, info := range internal.Strategies() {
+		fmt.Printf("%s\t%s\n", info.Name, info.Description)
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		for _, param := range info.Params {
+			fmt.Fprintf(w, "  %s\t%v\t%s\n", param.Name, param.Default, param.Description)
+		}
+		w.Flush()
+	}
+}
+
+func printStatistics(w io.Writer, statistics map[string]any) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, key := range internal.StatisticKeys {
+		switch value := statistics[key].(type) {
+		case float64:
+			fmt.Fprintf(tw, "%s\t%.2f\n", key, value)
+		default:
+			fmt.Fprintf(tw, "%s\t%v\n", key, value)
+		}
+	}
+	tw.Flush()
+}
+
+func writeJSON(path string, v any) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = os.WriteFile(path, data, 0o644); err != nil {
+		return err
+	}
+	fmt.Println("结果已写入:", path)
+	return nil
+}
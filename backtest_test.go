@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"gocta/internal"
+)
+
+type buyOnceStrategy struct {
+	internal.StrategyTemplate
+	bought bool
+}
+
+func (s *buyOnceStrategy) OnBar(bar internal.BarData) {
+	if !s.bought {
+		s.bought = true
+		s.Buy(bar.ClosePrice, 1)
+	}
+}
+
+// 持续上涨没有回撤时，收益回撤比为 0，统计、报告和导出都能写入
+func TestBacktestNoDrawdown(t *testing.T) {
+	data, err := internal.NewFileData(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	bars := make([]internal.BarData, 0)
+	for i := 0; i < 5; i++ {
+		price := 100 + float64(i)
+		bars = append(bars, internal.BarData{
+			Symbol:     "BTCUSDT",
+			UpdatedAt:  timestamppb.New(start.Add(time.Duration(i) * 24 * time.Hour)),
+			Volume:     100,
+			OpenPrice:  price,
+			HighPrice:  price + 1,
+			LowPrice:   100,
+			ClosePrice: price + 1,
+		})
+	}
+	if err = data.SaveBarData(24*time.Hour, bars); err != nil {
+		t.Fatal(err)
+	}
+
+	out := t.TempDir()
+	cfg := internal.EngineCfg{
+		Strategy:   new(buyOnceStrategy),
+		DataRepo:   data,
+		Symbol:     "BTCUSDT",
+		Start:      start,
+		End:        start.Add(5 * 24 * time.Hour),
+		Interval:   24 * time.Hour,
+		Capital:    1000,
+		Size:       1,
+		AnnualDays: 365,
+	}
+	if err = backtest(cfg, "buy_once", nil, internal.OutputConfig{Dir: out, Format: internal.ExportCSV}); err != nil {
+		t.Fatal(err)
+	}
+
+	raw, err := os.ReadFile(filepath.Join(out, "statistics.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var file struct {
+		Statistics map[string]any `json:"statistics"`
+	}
+	if err = json.Unmarshal(raw, &file); err != nil {
+		t.Fatal(err)
+	}
+	statistics := file.Statistics
+	if statistics["max_ddpercent"] != 0.0 || statistics["total_net_pnl"].(float64) <= 0 || statistics["return_drawdown_ratio"] != 0.0 {
+		t.Fatalf("statistics: %v", statistics)
+	}
+	if _, err = os.Stat(filepath.Join(out, "report.html")); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"time"
+
+	"gocta/internal"
+)
+
+func runData(args []string) error {
+	if len(args) == 0 {
+		return errors.New("data 需要子命令 import 或 export")
+	}
+
+	var (
+		dsn      string
+		dir      string
+		symbol   string
+		interval string
+		start    string
+		end      string
+		mode     string
+	)
+	fs := flag.NewFlagSet("data "+args[0], flag.ExitOnError)
+	fs.StringVar(&dsn, "dsn", "", "mysql 数据源，为空时使用默认数据库")
+	fs.StringVar(&dir, "dir", "", "csv 行情目录")
+	fs.StringVar(&symbol, "symbol", "", "合约代码")
+	fs.StringVar(&interval, "interval", "1m", "K线周期，如 1m、1h、1d")
+	fs.StringVar(&start, "start", "", "开始日期 2006-01-02")
+	fs.StringVar(&end, "end", "", "结束日期 2006-01-02，为空时到当前时间")
+	fs.StringVar(&mode, "mode", "bar", "数据类型: bar 或 tick")
+	fs.Parse(args[1:])
+
+	if dir == "" || symbol == "" {
+		return errors.New("dir和symbol不能为空")
+	}
+	barInterval, err := internal.ParseInterval(interval)
+	if err != nil {
+		return err
+	}
+	startTime, err := internal.ParseDate(start)
+	if err != nil {
+		return fmt.Errorf("start: %w", err)
+	}
+	endTime := time.Now()
+	if end != "" {
+		if endTime, err = internal.ParseDate(end); err != nil {
+			return fmt.Errorf("end: %w", err)
+		}
+	}
+
+	files, err := internal.NewFileData(dir)
+	if err != nil {
+		return err
+	}
+	var db *internal.Data
+	if dsn != "" {
+		db, err = internal.NewDataWithDSN(dsn)
+	} else {
+		db = internal.NewData().(*internal.Data)
+	}
+	if err != nil {
+		return err
+	}
+
+	var (
+		from internal.DataRepo
+		to   internal.DataSaver
+	)
+	switch args[0] {
+	case "import":
+		from, to = files, db
+	case "export":
+		from, to = db, files
+	default:
+		return fmt.Errorf("未知子命令: data %s", args[0])
+	}
+
+	var count int
+	if mode == "tick" {
+		count, err = copyTicks(from, to, symbol, barInterval, startTime, endTime)
+	} else {
+		count, err = copyBars(from, to, symbol, barInterval, startTime, endTime)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s完成，数据量: %d\n", args[0], count)
+	return nil
+}
+
+func copyBars(from internal.DataRepo, to internal.DataSaver, symbol string, interval time.Duration, start, end time.Time) (int, error) {
+	loaded, err := from.GetBarData(symbol, 0, interval, start, end)
+	if err != nil {
+		return 0, err
+	}
+	bars := make([]internal.BarData, 0, loaded.Len())
+	for cur := loaded.Front(); cur != nil; cur = cur.Next() {
+		bars = append(bars, cur.Value.(internal.BarData))
+	}
+	return len(bars), to.SaveBarData(interval, bars)
+}
+
+func copyTicks(from internal.DataRepo, to internal.DataSaver, symbol string, interval time.Duration, start, end time.Time) (int, error) {
+	loaded, err := from.GetTickData(symbol, 0, interval, start, end)
+	if err != nil {
+		return 0, err
+	}
+	ticks := make([]internal.TickData, 0, loaded.Len())
+	for cur := loaded.Front(); cur != nil; cur = cur.Next() {
+		ticks = append(ticks, cur.Value.(internal.TickData))
+	}
+	return len(ticks), to.SaveTickData(ticks)
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"gocta/internal"
+	// 注册策略
+	_ "gocta/pkg"
+)
+
+type dataFlags struct {
+	dsn     string
+	dataDir string
+}
+
+func (f *dataFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.dsn, "dsn", "", "mysql 数据源，为空时使用默认数据库")
+	fs.StringVar(&f.dataDir, "data-dir", "", "csv 行情目录，设置后不使用数据库")
+}
+
+func (f *dataFlags) repo() (internal.DataRepo, error) {
+	if f.dataDir != "" {
+		return internal.NewFileData(f.dataDir)
+	}
+	if f.dsn != "" {
+		return internal.NewDataWithDSN(f.dsn)
+	}
+	return internal.NewData(), nil
+}
+
+type engineFlags struct {
+	dataFlags
+
+	strategy     string
+	symbol       string
+	exchange     int
+	interval     string
+	start        string
+	end          string
+	capital      float64
+	rate         *float64
+	size         float64
+	slippage     float64
+	inverse      bool
+	annualDays   int
+	mode         string
+	benchmark    string
+	orderBook    bool
+	marketTrades bool
+	latency      internal.LatencyConfig
+	contracts    string
+	out          string
+}
+
+func (f *engineFlags) register(fs *flag.FlagSet) {
+	f.dataFlags.register(fs)
+	fs.StringVar(&f.strategy, "strategy", "", "策略名称: "+strings.Join(internal.StrategyNames(), ", "))
+	fs.StringVar(&f.symbol, "symbol", "", "合约代码")
+	fs.IntVar(&f.exchange, "exchange", 0, "交易所编号")
+	fs.StringVar(&f.interval, "interval", "1m", "K线周期，如 1m、1h、1d")
+	fs.StringVar(&f.start, "start", "", "开始日期 2006-01-02")
+	fs.StringVar(&f.end, "end", "", "结束日期 2006-01-02，为空时到当前时间")
+	fs.Float64Var(&f.capital, "capital", 1000000, "起始资金")
+	fs.Func("rate", "手续费率，不设置时使用合约规格的费率，设置为 0 时不收手续费", func(s string) error {
+		rate, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return err
+		}
+		f.rate = &rate
+		return nil
+	})
+	fs.Float64Var(&f.size, "size", 0, "合约乘数，为 0 时使用合约规格，没有合约规格时为 1")
+	fs.Float64Var(&f.slippage, "slippage", 0, "滑点")
+	fs.BoolVar(&f.inverse, "inverse", false, "反向合约")
+	fs.IntVar(&f.annualDays, "annual-days", 365, "年化天数")
+	fs.StringVar(&f.mode, "mode", "bar", "回测模式: bar 或 tick")
+	fs.StringVar(&f.benchmark, "benchmark", "", "基准合约，与其买入持有收益对比，可以是 symbol 本身")
+	fs.BoolVar(&f.orderBook, "order-book", false, "tick 模式下按 L2 盘口逐档撮合并估算排队位置")
+	fs.BoolVar(&f.marketTrades, "market-trades", false, "tick 模式下回放逐笔成交，成交价达到委托价时挂单成交")
+	fs.DurationVar(&f.latency.Submit, "submit-latency", 0, "委托到达交易所的延迟，如 50ms")
+	fs.DurationVar(&f.latency.Cancel, "cancel-latency", 0, "撤单生效的延迟")
+	fs.DurationVar(&f.latency.MarketData, "data-latency", 0, "策略收到行情的延迟")
+	fs.DurationVar(&f.latency.Jitter, "latency-jitter", 0, "在不为 0 的延迟上再加的最大随机延迟")
+	fs.Int64Var(&f.latency.Seed, "latency-seed", 0, "随机延迟的种子")
+	fs.StringVar(&f.contracts, "contracts", "", "合约规格文件 yaml/toml/json，按 symbol 和 exchange 查找最小变动价位、数量步长等")
+	fs.StringVar(&f.out, "out", "", "结果输出目录，为空时不写文件")
+}
+
+// config 生成不含策略的引擎配置
+func (f *engineFlags) config() (internal.EngineCfg, error) {
+	interval, err := internal.ParseInterval(f.interval)
+	if err != nil {
+		return internal.EngineCfg{}, err
+	}
+	start, err := internal.ParseDate(f.start)
+	if err != nil {
+		return internal.EngineCfg{}, fmt.Errorf("start: %w", err)
+	}
+	var end time.Time
+	if f.end != "" {
+		if end, err = internal.ParseDate(f.end); err != nil {
+			return internal.EngineCfg{}, fmt.Errorf("end: %w", err)
+		}
+	}
+
+	var mode internal.BackTestingMod
+	switch f.mode {
+	case "bar":
+		mode = internal.BAR
+	case "tick":
+		mode = internal.TICK
+	default:
+		return internal.EngineCfg{}, fmt.Errorf("不支持的回测模式: %s", f.mode)
+	}
+
+	repo, err := f.repo()
+	if err != nil {
+		return internal.EngineCfg{}, err
+	}
+
+	cfg := internal.EngineCfg{
+		DataRepo:       repo,
+		Symbol:         f.symbol,
+		Exchange:       internal.Exchange(f.exchange),
+		Start:          start,
+		End:            end,
+		Interval:       interval,
+		Capital:        f.capital,
+		Size:           f.size,
+		Slippage:       f.slippage,
+		Inverse:        f.inverse,
+		AnnualDays:     f.annualDays,
+		BackTestingMod: mode,
+		Benchmark:      f.benchmark,
+		OrderBook:      f.orderBook,
+		MarketTrades:   f.marketTrades,
+		Latency:        f.latency,
+	}
+	if f.contracts != "" {
+		registry, err := internal.LoadContracts(f.contracts)
+		if err != nil {
+			return internal.EngineCfg{}, err
+		}
+		contract, ok := registry.Get(cfg.Symbol, cfg.Exchange)
+		if !ok {
+			return internal.EngineCfg{}, fmt.Errorf("合约规格中没有%s", cfg.Symbol)
+		}
+		cfg.SetContract(contract)
+	}
+	if f.rate != nil {
+		cfg.Rate = *f.rate
+	}
+	if cfg.Size == 0 {
+		cfg.Size = 1
+	}
+	return cfg, nil
+}
+
+func (f *engineFlags) factory() (internal.StrategyFactory, error) {
+	info, err := internal.LookupStrategy(f.strategy)
+	if err != nil {
+		return nil, err
+	}
+	return info.New, nil
+}
+
+// parseParams 解析 window=20,dev=2 形式的策略参数
+func parseParams(s string) (map[string]float64, error) {
+	params := make(map[string]float64)
+	if s == "" {
+		return params, nil
+	}
+	for _, item := range strings.Split(s, ",") {
+		name, value, ok := strings.Cut(item, "=")
+		if !ok {
+			return nil, fmt.Errorf("参数格式错误: %s", item)
+		}
+		v, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil {
+			return nil, fmt.Errorf("参数%s的值错误: %s", name, value)
+		}
+		params[strings.TrimSpace(name)] = v
+	}
+	return params, nil
+}
+
+// parseRanges 解析 window=10:30:5,dev=2 形式的优化参数，单个值表示固定参数
+func parseRanges(s string) (internal.OptimizationSetting, error) {
+	var setting internal.OptimizationSetting
+	for _, item := range strings.Split(s, ",") {
+		name, value, ok := strings.Cut(item, "=")
+		if !ok {
+			return setting, fmt.Errorf("参数格式错误: %s", item)
+		}
+		name = strings.TrimSpace(name)
+
+		parts := strings.Split(value, ":")
+		values := make([]float64, 0, len(parts))
+		for _, part := range parts {
+			v, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+			if err != nil {
+				return setting, fmt.Errorf("参数%s的值错误: %s", name, value)
+			}
+			values = append(values, v)
+		}
+
+		switch len(values) {
+		case 1:
+			if err := setting.AddParameter(name, values[0], values[0], 1); err != nil {
+				return setting, err
+			}
+		case 3:
+			if err := setting.AddParameter(name, values[0], values[1], values[2]); err != nil {
+				return setting, err
+			}
+		default:
+			return setting, fmt.Errorf("参数%s应为 值 或 开始:结束:步长", name)
+		}
+	}
+	return setting, nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"flag"
+	"strings"
+	"testing"
+)
+
+func TestParseParams(t *testing.T) {
+	params, err := parseParams("window=20, dev=1.5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if params["window"] != 20 || params["dev"] != 1.5 {
+		t.Fatalf("params: %v", params)
+	}
+	if _, err = parseParams("window"); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestParseRanges(t *testing.T) {
+	setting, err := parseRanges("window=10:30:10,dev=2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(setting.Params["window"]) != 3 || len(setting.Params["dev"]) != 1 {
+		t.Fatalf("params: %v", setting.Params)
+	}
+	if _, err = parseRanges("window=10:30"); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestOnlyFlags(t *testing.T) {
+	fs := flag.NewFlagSet("backtest", flag.ContinueOnError)
+	var f engineFlags
+	f.register(fs)
+	config := fs.String("config", "", "")
+	if err := fs.Parse([]string{"-config", "backtest.yaml", "-out", "out"}); err != nil || *config == "" {
+		t.Fatal(err)
+	}
+	if err := onlyFlags(fs, "config", "out"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := fs.Parse([]string{"-symbol", "ETHUSDT", "-rate", "0"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := onlyFlags(fs, "config", "out"); err == nil || !strings.Contains(err.Error(), "-rate, -symbol") {
+		t.Fatalf("conflicts: %v", err)
+	}
+}
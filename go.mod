@@ -3,6 +3,9 @@ module gocta
 go 1.19
 
 require (
+	github.com/BurntSushi/toml v1.2.1
+	google.golang.org/grpc v1.45.0
+	gopkg.in/yaml.v3 v3.0.1
 	gorm.io/driver/mysql v1.4.3
 	gorm.io/gorm v1.24.0
 	newgitlab.com/xquant/exchange-protocols v0.0.0-20220922024746-a06a65c627d0
@@ -19,6 +22,5 @@ require (
 	golang.org/x/text v0.4.0 // indirect
 	gonum.org/v1/gonum v0.12.0 // indirect
 	google.golang.org/genproto v0.0.0-20200526211855-cb27e3aa2013 // indirect
-	google.golang.org/grpc v1.45.0 // indirect
 	google.golang.org/protobuf v1.28.0 // indirect
 )
@@ -0,0 +1,526 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+	expb "newgitlab.com/xquant/exchange-protocols/protocols/src/go"
+)
+
+type AlgoType int
+
+const (
+	// TWAP 在 Duration 内分 Slices 次均匀下单，上一笔未成交的部分撤单后并入下一笔
+	TWAP AlgoType = iota
+	// ICEBERG 每次只挂出 DisplayVolume，成交完再挂下一笔
+	ICEBERG
+	// TRAILING_STOP 价格从最高（最低）点回撤超过比例或 ATR 倍数时市价止损
+	TRAILING_STOP
+)
+
+// AlgoRequest 算法委托，子委托走普通下单流程，同样经过风控和模拟延迟
+type AlgoRequest struct {
+	Type      AlgoType
+	Direction expb.Direction
+	Volume    float64
+	// TWAP 和冰山委托的限价，TWAP 为 0 时子委托用市价单
+	Price float64
+	// 子委托是否只减仓
+	ReduceOnly bool
+
+	Duration time.Duration
+	Slices   int
+
+	DisplayVolume float64
+
+	// 跟踪止损按回撤比例（如 0.02）或 ATRWindow 根K线的 ATR 乘以 ATRMultiple 触发，二选一
+	TrailingPercent float64
+	ATRWindow       int
+	ATRMultiple     float64
+	// 只有 tick 行情时按 ATRInterval 合成计算 ATR 的K线，为 0 时为 1 分钟
+	ATRInterval time.Duration
+}
+
+func (r AlgoRequest) Check() error {
+	var errs CheckErrors
+	if r.Volume <= 0 {
+		errs = append(errs, errors.New("算法委托数量必须大于0"))
+	}
+	switch r.Type {
+	case TWAP:
+		if r.Duration <= 0 || r.Slices <= 0 {
+			errs = append(errs, errors.New("TWAP的duration和slices必须大于0"))
+		}
+	case ICEBERG:
+		if r.Price <= 0 {
+			errs = append(errs, errors.New("冰山委托的价格必须大于0"))
+		}
+		if r.DisplayVolume <= 0 {
+			errs = append(errs, errors.New("冰山委托的displayVolume必须大于0"))
+		}
+	case TRAILING_STOP:
+		byPercent := r.TrailingPercent > 0
+		byATR := r.ATRWindow > 0 && r.ATRMultiple > 0
+		if byPercent == byATR {
+			errs = append(errs, errors.New("跟踪止损需要设置trailingPercent或atrWindow和atrMultiple中的一种"))
+		}
+		if r.TrailingPercent >= 1 {
+			errs = append(errs, errors.New("trailingPercent必须小于1"))
+		}
+		if r.ATRInterval < 0 {
+			errs = append(errs, errors.New("atrInterval不能小于0"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("不支持的算法类型: %d", r.Type))
+	}
+	return errs.Err()
+}
+
+// AlgoData 算法委托的进度，Status 的含义与委托相同
+type AlgoData struct {
+	AlgoID    string
+	Type      AlgoType
+	Direction expb.Direction
+	Volume    float64
+	Traded    float64
+	AvgPrice  float64
+	Status    expb.Status
+	UpdatedAt time.Time
+	Reference string
+}
+
+// algoMarket 推给算法的行情，定时事件只有时间
+type algoMarket struct {
+	time             time.Time
+	price, high, low float64
+	bar              bool
+}
+
+type algoRunner interface {
+	start(a *algoOrder)
+	onMarket(a *algoOrder, m algoMarket)
+	// onChild 子委托结束，order 为最后的状态
+	onChild(a *algoOrder, order OrderData)
+}
+
+type algoOrder struct {
+	AlgoData
+	req    AlgoRequest
+	runner algoRunner
+	engine *algoEngine
+
+	// 当前子委托，以及按委托回报计算的已结束子委托和当前子委托的成交量
+	child     string
+	childDone float64
+	childLive float64
+	cost      float64
+	stopping  bool
+}
+
+func (a *algoOrder) filled() float64 {
+	return a.childDone + a.childLive
+}
+
+func (a *algoOrder) remaining() float64 {
+	return Max(a.Volume-a.filled(), 0)
+}
+
+// send 同一时间只有一笔子委托
+func (a *algoOrder) send(volume, price float64, typ OrderType) {
+	if volume <= 1e-12 || a.child != "" {
+		return
+	}
+	a.engine.send(a, OrderRequest{
+		Direction:  a.Direction,
+		Price:      price,
+		Volume:     volume,
+		Type:       typ,
+		ReduceOnly: a.req.ReduceOnly,
+	})
+}
+
+// algoEngine 管理一个策略的算法委托，行情和回报都在事件引擎中处理
+type algoEngine struct {
+	engine CtaEngine
+	symbol string
+	notify func(AlgoData)
+	logger Logger
+
+	count int
+	// 回测为行情时间，实盘为系统时间
+	now      func() time.Time
+	algos    map[string]*algoOrder
+	children map[string]*algoOrder
+	// 正在发送子委托的算法，同步的事件引擎会在 SendOrder 返回前推送被拒绝的委托
+	sending *algoOrder
+}
+
+func newAlgoEngine(engine CtaEngine, symbol string, notify func(AlgoData), logger Logger, now func() time.Time) *algoEngine {
+	return &algoEngine{
+		engine:   engine,
+		symbol:   symbol,
+		notify:   notify,
+		logger:   logger,
+		now:      now,
+		algos:    make(map[string]*algoOrder),
+		children: make(map[string]*algoOrder),
+	}
+}
+
+func (e *algoEngine) register(events *EventEngine) {
+	events.Register(EventBar, e.onMarketEvent)
+	events.Register(EventTick, e.onMarketEvent)
+	events.Register(EventTimer, func(event Event) {
+		e.onMarket(algoMarket{time: event.Data.(time.Time)})
+	})
+	e.registerOrders(events)
+}
+
+// registerOrders 只注册委托和成交，回测中行情由引擎按交易所时间调用 onMarketEvent，不受行情延迟影响
+func (e *algoEngine) registerOrders(events *EventEngine) {
+	events.Register(EventOrder, func(event Event) {
+		e.onOrder(event.Data.(OrderData))
+	})
+	events.Register(EventTrade, func(event Event) {
+		e.onTrade(event.Data.(TradeData))
+	})
+}
+
+func (e *algoEngine) onMarketEvent(event Event) {
+	switch data := event.Data.(type) {
+	case BarData:
+		if data.Symbol == e.symbol {
+			e.onMarket(algoMarket{data.UpdatedAt.AsTime(), data.ClosePrice, data.HighPrice, data.LowPrice, true})
+		}
+	case TickData:
+		if data.Symbol == e.symbol {
+			e.onMarket(algoMarket{data.UpdatedAt.AsTime(), data.LastPrice, data.LastPrice, data.LastPrice, false})
+		}
+	}
+}
+
+func (e *algoEngine) sendAlgo(req AlgoRequest) string {
+	if err := req.Check(); err != nil {
+		e.logger.Println("算法委托失败:", err.Error())
+		return ""
+	}
+
+	e.count++
+	a := &algoOrder{
+		AlgoData: AlgoData{
+			AlgoID:    "algo." + strconv.Itoa(e.count),
+			Type:      req.Type,
+			Direction: req.Direction,
+			Volume:    req.Volume,
+			Status:    expb.Status_NOT_TRADED,
+			UpdatedAt: e.now(),
+		},
+		req:    req,
+		engine: e,
+	}
+	switch req.Type {
+	case TWAP:
+		a.runner = &twapRunner{}
+	case ICEBERG:
+		a.runner = &icebergRunner{}
+	case TRAILING_STOP:
+		a.runner = &trailingStopRunner{}
+	}
+	e.algos[a.AlgoID] = a
+	e.notify(a.AlgoData)
+	a.runner.start(a)
+	return a.AlgoID
+}
+
+// cancelAlgo 撤销子委托，子委托结束后算法才结束
+func (e *algoEngine) cancelAlgo(algoID string) {
+	a, ok := e.algos[algoID]
+	if !ok || a.stopping {
+		return
+	}
+	a.stopping = true
+	if a.child == "" {
+		e.finish(a, expb.Status_CANCELLED, "")
+		return
+	}
+	e.engine.CancelOrder(a.child)
+}
+
+// send 发送失败时结束算法
+func (e *algoEngine) send(a *algoOrder, req OrderRequest) {
+	e.sending = a
+	orderNo := e.engine.SendOrder(req)
+	e.sending = nil
+	if orderNo == "" {
+		e.finish(a, expb.Status_CANCELLED, "子委托发送失败")
+		return
+	}
+	// 同步推送的回报已经在 onOrder 中记录
+	if _, handled := e.children[orderNo]; handled {
+		return
+	}
+	e.children[orderNo] = a
+	a.child = orderNo
+}
+
+func (e *algoEngine) finish(a *algoOrder, status expb.Status, reason string) {
+	if _, ok := e.algos[a.AlgoID]; !ok {
+		return
+	}
+	delete(e.algos, a.AlgoID)
+	if a.child != "" {
+		e.engine.CancelOrder(a.child)
+	}
+	a.Status = status
+	if reason != "" {
+		a.Reference = reason
+		e.logger.Println("算法委托结束:", a.AlgoID, reason)
+	}
+	a.UpdatedAt = e.now()
+	e.notify(a.AlgoData)
+}
+
+func (e *algoEngine) onMarket(m algoMarket) {
+	for _, id := range sortedAlgoIDs(e.algos) {
+		if a := e.algos[id]; !a.stopping {
+			a.runner.onMarket(a, m)
+		}
+	}
+}
+
+func (e *algoEngine) onOrder(order OrderData) {
+	a, ok := e.children[order.OrderNo]
+	if !ok && e.sending != nil {
+		a, ok = e.sending, true
+		e.children[order.OrderNo] = a
+		a.child = order.OrderNo
+	}
+	if !ok {
+		return
+	}
+
+	if order.OrderNo == a.child {
+		a.childLive = order.Traded
+	}
+	switch order.Status {
+	case expb.Status_ALL_TRADED, expb.Status_CANCELLED, expb.Status_REJECTED:
+	default:
+		return
+	}
+	if order.OrderNo != a.child {
+		return
+	}
+	a.child = ""
+	a.childDone += order.Traded
+	a.childLive = 0
+
+	if _, running := e.algos[a.AlgoID]; !running {
+		return
+	}
+	switch {
+	case a.remaining() <= 1e-12:
+		// 等成交回报到达后结束
+	case a.stopping:
+		e.finish(a, expb.Status_CANCELLED, "")
+	case order.Status == expb.Status_REJECTED:
+		e.finish(a, expb.Status_CANCELLED, "子委托被拒绝: "+order.Reference)
+	default:
+		a.runner.onChild(a, order)
+	}
+}
+
+func (e *algoEngine) onTrade(trade TradeData) {
+	a, ok := e.children[trade.OrderNo]
+	if !ok {
+		return
+	}
+	if _, running := e.algos[a.AlgoID]; !running {
+		return
+	}
+	a.Traded += trade.Volume
+	a.cost += trade.Volume * trade.Price
+	a.AvgPrice = a.cost / a.Traded
+	a.Status = expb.Status_PART_TRADED
+	a.UpdatedAt = e.now()
+
+	if a.Traded >= a.Volume-1e-12 {
+		e.finish(a, expb.Status_ALL_TRADED, "")
+		return
+	}
+	e.notify(a.AlgoData)
+}
+
+func sortedAlgoIDs(algos map[string]*algoOrder) []string {
+	ids := make([]string, 0, len(algos))
+	for id := range algos {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return lessNo(ids[i], ids[j]) })
+	return ids
+}
+
+type twapRunner struct {
+	start0   time.Time
+	slice    int
+	interval time.Duration
+	pending  bool
+}
+
+func (r *twapRunner) start(*algoOrder) {}
+
+func (r *twapRunner) onMarket(a *algoOrder, m algoMarket) {
+	if r.start0.IsZero() {
+		if m.price == 0 {
+			return
+		}
+		r.start0 = m.time
+		r.interval = a.req.Duration / time.Duration(a.req.Slices)
+	}
+
+	due := r.slice
+	for due < a.req.Slices && !m.time.Before(r.start0.Add(time.Duration(due)*r.interval)) {
+		due++
+	}
+	if due == r.slice {
+		return
+	}
+	r.slice = due
+
+	if a.child != "" {
+		r.pending = true
+		a.engine.engine.CancelOrder(a.child)
+		return
+	}
+	r.sendSlice(a)
+}
+
+func (r *twapRunner) onChild(a *algoOrder, _ OrderData) {
+	if r.pending {
+		r.pending = false
+		r.sendSlice(a)
+	}
+}
+
+// sendSlice 补足到当前时间片应完成的数量
+func (r *twapRunner) sendSlice(a *algoOrder) {
+	target := a.Volume * float64(r.slice) / float64(a.req.Slices)
+	volume := Min(target-a.filled(), a.remaining())
+	if a.req.Price > 0 {
+		a.send(volume, a.req.Price, LIMIT)
+	} else {
+		a.send(volume, 0, MARKET)
+	}
+}
+
+type icebergRunner struct{}
+
+func (r *icebergRunner) start(a *algoOrder) {
+	r.sendNext(a)
+}
+
+func (r *icebergRunner) onMarket(a *algoOrder, _ algoMarket) {
+	r.sendNext(a)
+}
+
+// onChild 子委托被撤销时算法结束，全部成交时挂出下一笔
+func (r *icebergRunner) onChild(a *algoOrder, order OrderData) {
+	if order.Status == expb.Status_CANCELLED {
+		a.engine.finish(a, expb.Status_CANCELLED, "子委托已撤销")
+		return
+	}
+	r.sendNext(a)
+}
+
+func (r *icebergRunner) sendNext(a *algoOrder) {
+	a.send(Min(a.req.DisplayVolume, a.remaining()), a.req.Price, LIMIT)
+}
+
+type trailingStopRunner struct {
+	extreme   float64
+	triggered bool
+
+	prevClose float64
+	ranges    []float64
+	// 收到过K线后只用K线计算 ATR，否则由 tick 合成
+	barFed bool
+	bars   *BarGenerator
+}
+
+func (r *trailingStopRunner) start(*algoOrder) {}
+
+func (r *trailingStopRunner) onMarket(a *algoOrder, m algoMarket) {
+	if m.price == 0 {
+		return
+	}
+	// 止损单方向为空时保护多头持仓，跟踪最高价
+	long := a.Direction == expb.Direction_SHORT
+	trigger, extreme := m.low, m.high
+	if !long {
+		trigger, extreme = m.high, m.low
+	}
+
+	if !r.triggered && r.extreme > 0 {
+		if distance, ok := r.distance(a); ok {
+			if (long && trigger <= r.extreme-distance) || (!long && trigger >= r.extreme+distance) {
+				r.triggered = true
+			}
+		}
+	}
+	if r.extreme == 0 || (long && extreme > r.extreme) || (!long && extreme < r.extreme) {
+		r.extreme = extreme
+	}
+	if m.bar {
+		r.barFed = true
+		r.updateATR(m, a.req.ATRWindow)
+	} else if a.req.ATRWindow > 0 && !r.barFed {
+		r.updateTick(a, m)
+	}
+	if r.triggered {
+		a.send(a.remaining(), 0, MARKET)
+	}
+}
+
+// onChild 市价止损单没有全部成交时在下一次行情补发
+func (r *trailingStopRunner) onChild(*algoOrder, OrderData) {}
+
+func (r *trailingStopRunner) distance(a *algoOrder) (float64, bool) {
+	if a.req.TrailingPercent > 0 {
+		return r.extreme * a.req.TrailingPercent, true
+	}
+	if len(r.ranges) < a.req.ATRWindow {
+		return 0, false
+	}
+	sum := 0.0
+	for _, tr := range r.ranges {
+		sum += tr
+	}
+	return sum / float64(len(r.ranges)) * a.req.ATRMultiple, true
+}
+
+// updateTick tick 所在周期结束时用合成的K线更新 ATR
+func (r *trailingStopRunner) updateTick(a *algoOrder, m algoMarket) {
+	if r.bars == nil {
+		r.bars = NewBarGenerator(a.req.ATRInterval, func(bar BarData) {
+			r.updateATR(algoMarket{price: bar.ClosePrice, high: bar.HighPrice, low: bar.LowPrice}, a.req.ATRWindow)
+		})
+	}
+	r.bars.UpdateTick(TickData{LastPrice: m.price, UpdatedAt: timestamppb.New(m.time)})
+}
+
+// updateATR 记录最近 window 根K线的真实波幅
+func (r *trailingStopRunner) updateATR(m algoMarket, window int) {
+	tr := m.high - m.low
+	if r.prevClose > 0 {
+		tr = math.Max(tr, math.Max(math.Abs(m.high-r.prevClose), math.Abs(m.low-r.prevClose)))
+	}
+	r.prevClose = m.price
+	r.ranges = append(r.ranges, tr)
+	if len(r.ranges) > window {
+		r.ranges = r.ranges[1:]
+	}
+}
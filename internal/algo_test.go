@@ -0,0 +1,278 @@
+package internal
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	expb "newgitlab.com/xquant/exchange-protocols/protocols/src/go"
+)
+
+func TestAlgoRequestCheck(t *testing.T) {
+	valid := []AlgoRequest{
+		{Type: TWAP, Volume: 1, Duration: time.Hour, Slices: 4},
+		{Type: ICEBERG, Volume: 1, Price: 100, DisplayVolume: 0.1},
+		{Type: TRAILING_STOP, Volume: 1, TrailingPercent: 0.05},
+		{Type: TRAILING_STOP, Volume: 1, ATRWindow: 14, ATRMultiple: 3},
+	}
+	for _, req := range valid {
+		if err := req.Check(); err != nil {
+			t.Fatalf("%+v: %v", req, err)
+		}
+	}
+	invalid := []AlgoRequest{
+		{Type: TWAP, Volume: 1},
+		{Type: ICEBERG, Volume: 1, Price: 100},
+		{Type: TRAILING_STOP, Volume: 1, TrailingPercent: 0.05, ATRWindow: 14, ATRMultiple: 3},
+		{Type: TRAILING_STOP, Volume: 1},
+		{Type: TRAILING_STOP, Volume: 1, ATRWindow: 14, ATRMultiple: 3, ATRInterval: -time.Minute},
+		{Type: TWAP, Duration: time.Hour, Slices: 4},
+	}
+	for _, req := range invalid {
+		if err := req.Check(); err == nil {
+			t.Fatalf("expect error: %+v", req)
+		}
+	}
+}
+
+type algoTestStrategy struct {
+	StrategyTemplate
+	onBar func(s *algoTestStrategy, bar BarData)
+
+	mu    sync.Mutex
+	bars  int
+	algos []AlgoData
+}
+
+func (s *algoTestStrategy) OnBar(bar BarData) {
+	s.mu.Lock()
+	s.bars++
+	s.mu.Unlock()
+	s.onBar(s, bar)
+}
+
+func (s *algoTestStrategy) OnAlgo(algo AlgoData) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.algos = append(s.algos, algo)
+}
+
+func (s *algoTestStrategy) last() AlgoData {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.algos[len(s.algos)-1]
+}
+
+func runAlgoTest(t *testing.T, bars []BarData, onBar func(s *algoTestStrategy, bar BarData)) (*algoTestStrategy, *BacktestResult) {
+	t.Helper()
+	start := bars[0].UpdatedAt.AsTime()
+	strategy := &algoTestStrategy{onBar: onBar}
+	result, err := Evaluate(EngineCfg{
+		Strategy:   strategy,
+		DataRepo:   &memoryRepo{bars: map[string][]BarData{"BTCUSDT": bars}},
+		Symbol:     "BTCUSDT",
+		Start:      start,
+		End:        start.Add(time.Duration(len(bars)) * time.Hour),
+		Interval:   time.Hour,
+		Capital:    10000,
+		Size:       1,
+		AnnualDays: 365,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strategy, result
+}
+
+func hourlyBars(start time.Time, prices ...[4]float64) []BarData {
+	bars := make([]BarData, 0, len(prices))
+	for i, p := range prices {
+		bars = append(bars, newTestBar("BTCUSDT", start.Add(time.Duration(i)*time.Hour), p[0], p[1], p[2], p[3]))
+	}
+	return bars
+}
+
+func TestBacktestTWAP(t *testing.T) {
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	bars := hourlyBars(start,
+		[4]float64{100, 100, 100, 100},
+		[4]float64{101, 101, 101, 101},
+		[4]float64{102, 102, 102, 102},
+		[4]float64{103, 103, 103, 103},
+		[4]float64{104, 104, 104, 104},
+		[4]float64{105, 105, 105, 105},
+	)
+	strategy, result := runAlgoTest(t, bars, func(s *algoTestStrategy, bar BarData) {
+		if s.bars == 1 {
+			s.SendAlgo(AlgoRequest{Type: TWAP, Direction: expb.Direction_LONG, Volume: 4, Duration: 4 * time.Hour, Slices: 4})
+		}
+	})
+
+	// 每小时一笔市价子委托，在下一根K线开盘成交
+	if len(result.Trades) != 4 {
+		t.Fatalf("trades: %+v", result.Trades)
+	}
+	for i, trade := range result.Trades {
+		if trade.Volume != 1 || trade.Price != 101+float64(i) {
+			t.Fatalf("trade %d: %+v", i, trade)
+		}
+	}
+	last := strategy.last()
+	if last.Status != expb.Status_ALL_TRADED || last.Traded != 4 || last.AvgPrice != 102.5 {
+		t.Fatalf("algo: %+v", last)
+	}
+}
+
+func TestBacktestIceberg(t *testing.T) {
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	bars := make([]BarData, 0)
+	for i := 0; i < 6; i++ {
+		bars = append(bars, newTestBar("BTCUSDT", start.Add(time.Duration(i)*time.Hour), 100, 100, 99, 100))
+	}
+	strategy, result := runAlgoTest(t, bars, func(s *algoTestStrategy, bar BarData) {
+		if s.bars == 1 {
+			s.SendAlgo(AlgoRequest{Type: ICEBERG, Direction: expb.Direction_LONG, Price: 100, Volume: 2.5, DisplayVolume: 1})
+		}
+	})
+
+	if len(result.Orders) != 3 || result.Orders[2].Volume != 0.5 {
+		t.Fatalf("orders: %+v", result.Orders)
+	}
+	// 上一笔成交后才挂出下一笔
+	for i, trade := range result.Trades {
+		if !trade.UpdatedAt.AsTime().Equal(start.Add(time.Duration(i+1) * time.Hour)) {
+			t.Fatalf("trade %d: %+v", i, trade)
+		}
+	}
+	if last := strategy.last(); last.Status != expb.Status_ALL_TRADED || last.Traded != 2.5 {
+		t.Fatalf("algo: %+v", last)
+	}
+
+	// 撤销算法时撤销挂出的子委托
+	var algoID string
+	strategy, result = runAlgoTest(t, bars, func(s *algoTestStrategy, bar BarData) {
+		switch s.bars {
+		case 1:
+			algoID = s.SendAlgo(AlgoRequest{Type: ICEBERG, Direction: expb.Direction_LONG, Price: 50, Volume: 3, DisplayVolume: 1})
+		case 3:
+			s.CancelAlgo(algoID)
+		}
+	})
+	if last := strategy.last(); last.Status != expb.Status_CANCELLED || last.AlgoID != algoID {
+		t.Fatalf("algo: %+v", last)
+	}
+	if len(result.Orders) != 1 || result.Orders[0].Status != expb.Status_CANCELLED {
+		t.Fatalf("orders: %+v", result.Orders)
+	}
+}
+
+func TestBacktestTrailingStop(t *testing.T) {
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	bars := hourlyBars(start,
+		[4]float64{100, 100, 100, 100},
+		[4]float64{100, 110, 100, 110},
+		[4]float64{110, 120, 110, 118},
+		[4]float64{118, 118, 112, 113},
+		[4]float64{113, 113, 107, 108},
+		[4]float64{106, 106, 106, 106},
+		[4]float64{106, 106, 106, 106},
+	)
+	strategy, result := runAlgoTest(t, bars, func(s *algoTestStrategy, bar BarData) {
+		if s.bars == 1 {
+			s.SendAlgo(AlgoRequest{Type: TRAILING_STOP, Direction: expb.Direction_SHORT, Volume: 1, TrailingPercent: 0.1})
+		}
+	})
+
+	// 最高 120，回撤到 108 以下触发，在下一根K线开盘卖出
+	if len(result.Trades) != 1 || result.Trades[0].Price != 106 || result.Trades[0].Direction != expb.Direction_SHORT {
+		t.Fatalf("trades: %+v", result.Trades)
+	}
+	if last := strategy.last(); last.Status != expb.Status_ALL_TRADED {
+		t.Fatalf("algo: %+v", last)
+	}
+
+	r := &trailingStopRunner{}
+	a := &algoOrder{AlgoData: AlgoData{Direction: expb.Direction_SHORT}, req: AlgoRequest{ATRWindow: 2, ATRMultiple: 2}}
+	for _, bar := range bars[:3] {
+		r.onMarket(a, algoMarket{bar.UpdatedAt.AsTime(), bar.ClosePrice, bar.HighPrice, bar.LowPrice, true})
+	}
+	// 真实波幅为 10 和 10，ATR 为 10，止损距离为 20
+	if distance, ok := r.distance(a); !ok || distance != 20 || r.triggered {
+		t.Fatalf("distance: %v %v", distance, ok)
+	}
+}
+
+type algoTickTestStrategy struct {
+	algoTestStrategy
+	ticks int
+}
+
+func (s *algoTickTestStrategy) OnTick(tick TickData) {
+	s.ticks++
+	if s.ticks == 1 {
+		s.SendAlgo(AlgoRequest{Type: TRAILING_STOP, Direction: expb.Direction_SHORT, Volume: 1, ATRWindow: 2, ATRMultiple: 1, ATRInterval: time.Minute})
+	}
+}
+
+func TestBacktestTrailingStopATRTicks(t *testing.T) {
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	repo := &memoryRepo{ticks: make(map[string][]TickData)}
+	for i, price := range []float64{100, 110, 110, 120, 125, 114, 113, 112} {
+		repo.ticks["BTCUSDT"] = append(repo.ticks["BTCUSDT"], newTestTick("BTCUSDT", start.Add(time.Duration(i)*30*time.Second), price, 1))
+	}
+	strategy := new(algoTickTestStrategy)
+	result, err := Evaluate(EngineCfg{
+		Strategy:       strategy,
+		DataRepo:       repo,
+		Symbol:         "BTCUSDT",
+		Start:          start,
+		End:            start.Add(time.Hour),
+		Capital:        10000,
+		Size:           1,
+		AnnualDays:     365,
+		BackTestingMod: TICK,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 每分钟合成一根K线，前两根的 ATR 不超过 10，从 125 回撤到 114 时触发，下一个 tick 按买一价 112 卖出
+	if len(result.Trades) != 1 || result.Trades[0].Direction != expb.Direction_SHORT || result.Trades[0].Price != 112 {
+		t.Fatalf("trades: %+v", result.Trades)
+	}
+	if last := strategy.last(); last.Status != expb.Status_ALL_TRADED {
+		t.Fatalf("algo: %+v", last)
+	}
+}
+
+func TestLiveAlgo(t *testing.T) {
+	market := new(fakeMarketGateway)
+	strategy := &algoTestStrategy{onBar: func(s *algoTestStrategy, bar BarData) {
+		if s.bars == 1 {
+			s.SendAlgo(AlgoRequest{Type: ICEBERG, Direction: expb.Direction_LONG, Price: 100, Volume: 2, DisplayVolume: 1})
+		}
+	}}
+	engine, err := NewLiveEngine(LiveEngineCfg{
+		Strategy: strategy,
+		Gateway:  NewPaperGateway(market, 1000, 0, 1),
+		Symbol:   "BTCUSDT",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = engine.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	waiter := newEventWaiter(market.events)
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		market.events.Put(Event{Type: EventBar, Data: newTestBar("BTCUSDT", start.Add(time.Duration(i)*time.Minute), 100, 100, 99, 100)})
+		waiter.wait(t)
+	}
+	engine.Stop()
+
+	if last := strategy.last(); last.Status != expb.Status_ALL_TRADED || last.Traded != 2 || engine.Pos() != 2 {
+		t.Fatalf("algo: %+v pos: %v", last, engine.Pos())
+	}
+}
@@ -3,7 +3,10 @@ package internal
 import (
 	"container/list"
 	"errors"
+	"fmt"
 	"log"
+	"math"
+	"sort"
 	"strconv"
 	"time"
 
@@ -16,24 +19,104 @@ import (
 	"github.com/go-gota/gota/series"
 )
 
-func Evaluate(cfg EngineCfg) error {
+func Evaluate(cfg EngineCfg) (*BacktestResult, error) {
 	engine, err := newEngine(cfg)
 	if err != nil {
 		log.Println("创建引擎失败:", err.Error())
-		return err
+		return nil, err
 	}
 
 	err = engine.loadData()
 	if err != nil {
 		engine.logger.Println("加载数据失败:", err.Error())
-		return err
+		return nil, err
 	}
 
-	engine.runBackTesting()
-	engine.calculateResult()
-	engine.calculateStatistics()
+	return engine.run(), nil
+}
 
-	return nil
+// BacktestResult 一次回测的统计指标、逐日结果、委托和成交记录，均按时间排序
+type BacktestResult struct {
+	Capital      float64
+	Statistics   map[string]any
+	DailyResults []*DailyResult
+	Orders       []*OrderData
+	Trades       []*TradeData
+	RoundTrips   []RoundTrip
+	// 设置基准时为与 DailyResults 对齐的基准资金曲线
+	Benchmark []BenchmarkPoint
+	// 同样的配置和数据每次回测得到同样的指纹
+	Fingerprint RunFingerprint
+}
+
+// DailyBalance 逐日资金和回撤，DdPercent 为百分比
+type DailyBalance struct {
+	Date      string
+	Balance   float64
+	Highlevel float64
+	Drawdown  float64
+	DdPercent float64
+}
+
+// Balances 逐日净盈亏累加得到资金曲线，算法与 calculateStatistics 一致
+func (r *BacktestResult) Balances() []DailyBalance {
+	return dailyBalances(r.Capital, r.DailyResults)
+}
+
+func dailyBalances(capital float64, dailyResults []*DailyResult) []DailyBalance {
+	balances := make([]DailyBalance, 0, len(dailyResults))
+	balance, highlevel := capital, capital
+	for i, daily := range dailyResults {
+		balance += daily.NetPnl
+		if i == 0 || balance > highlevel {
+			highlevel = balance
+		}
+		item := DailyBalance{Date: daily.Date, Balance: balance, Highlevel: highlevel, Drawdown: balance - highlevel}
+		if highlevel != 0 {
+			item.DdPercent = item.Drawdown / highlevel * 100
+		}
+		balances = append(balances, item)
+	}
+	return balances
+}
+
+func (b *BackTestingEngine) run() *BacktestResult {
+	fingerprint := RunFingerprint{Config: b.configHash(), Data: b.dataHash()}
+	b.runBackTesting()
+	b.calculateResult()
+	b.benchmark = b.benchmarkCurve()
+	statistics := b.calculateStatistics()
+
+	result := &BacktestResult{
+		Capital:      b.Capital,
+		Statistics:   statistics,
+		DailyResults: make([]*DailyResult, 0, len(b.dailyResults)),
+		Orders:       make([]*OrderData, 0, len(b.limitOrders)),
+		Trades:       make([]*TradeData, 0, len(b.trades)),
+		RoundTrips:   b.roundTrips.trips,
+		Benchmark:    b.benchmark,
+		Fingerprint:  fingerprint,
+	}
+	for _, date := range sortedDates(b.dailyResults) {
+		result.DailyResults = append(result.DailyResults, b.dailyResults[date])
+	}
+	for _, order := range b.limitOrders {
+		result.Orders = append(result.Orders, order)
+	}
+	// 编号按委托和成交的先后递增
+	sort.Slice(result.Orders, func(i, j int) bool {
+		return lessNo(result.Orders[i].OrderNo, result.Orders[j].OrderNo)
+	})
+	result.Trades = b.sortedTrades()
+	result.Fingerprint.Result = resultHash(result)
+	return result
+}
+
+func lessNo(a, b string) bool {
+	if len(a) != len(b) {
+		return len(a) < len(b)
+	}
+	return a < b
 }
 
 type BackTestingMod int
@@ -63,23 +146,122 @@ type EngineCfg struct {
 	Inverse    bool
 	AnnualDays int
 	BackTestingMod
+
+	// 设置后回测价差合约，Symbol 为价差名称，各腿的数据分别加载
+	Spread *SpreadData
+
+	// 下单前的风控规则，为空时不限制
+	Risk RiskConfig
+
+	// tick 模式下按 L2 盘口逐档撮合并估算排队位置，数据源实现 DepthRepo 时使用逐笔盘口，否则使用 tick 的五档行情
+	OrderBook bool
+
+	// tick 模式下按时间回放数据源的逐笔成交，挂单在成交价达到委托价时成交，数据源需要实现 MarketTradeRepo
+	MarketTrades bool
+
+	// 委托、撤单和行情的模拟延迟，为空时立即生效
+	Latency LatencyConfig
+
+	// 合约规格，设置后委托按最小变动价位和数量步长取整并检查最小下单金额，一般通过 SetContract 设置
+	Contract *ContractData
+
+	// 设置后与该合约的买入持有对比，可以是回测合约本身，也可以是其他合约
+	Benchmark string
+
+	// 为空时引擎自己创建，调用方可以提前在上面注册风控、记录等处理函数
+	// 回测同步处理事件，传入的 EventEngine 不能已启动，也不能用于过其他回测
+	EventEngine *EventEngine
 }
 
+var (
+	errNoStrategy = errors.New("strategy不能为空")
+	errNoDataRepo = errors.New("dataRepo不能为空")
+)
+
+// Check 检查全部字段，返回的 CheckErrors 包含所有不合法的字段
 func (c EngineCfg) Check() error {
+	var errs CheckErrors
 	if c.Symbol == "" {
-		return errors.New("symbol不能为空")
+		errs = append(errs, errors.New("symbol不能为空"))
 	}
 	if c.Strategy == nil {
-		return errors.New("strategy不能为空")
+		errs = append(errs, errNoStrategy)
 	}
 	if c.DataRepo == nil {
-		return errors.New("dataRepo不能为空")
+		errs = append(errs, errNoDataRepo)
 	}
 	if c.Start.IsZero() {
-		return errors.New("start不能为空")
+		errs = append(errs, errors.New("start不能为空"))
+	} else if !c.End.IsZero() && !c.End.After(c.Start) {
+		errs = append(errs, errors.New("end必须晚于start"))
+	}
+	switch c.BackTestingMod {
+	case BAR:
+		if c.Interval <= 0 {
+			errs = append(errs, errors.New("bar模式interval必须大于0"))
+		}
+	case TICK:
+		if c.Interval < 0 {
+			errs = append(errs, errors.New("interval不能为负数"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("不支持的回测模式: %d", c.BackTestingMod))
+	}
+	if c.Capital < 0 {
+		errs = append(errs, errors.New("capital不能为负数"))
+	}
+	if c.Rate < 0 {
+		errs = append(errs, errors.New("rate不能为负数"))
+	}
+	if c.Size < 0 {
+		errs = append(errs, errors.New("size不能为负数"))
+	}
+	if c.Slippage < 0 {
+		errs = append(errs, errors.New("slippage不能为负数"))
+	}
+	if c.AnnualDays < 0 {
+		errs = append(errs, errors.New("annualDays不能为负数"))
+	}
+	if err := c.Risk.Check(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := c.Latency.Check(); err != nil {
+		errs = append(errs, err)
+	}
+	if c.Contract != nil {
+		if err := c.Contract.Check(); err != nil {
+			errs = append(errs, err)
+		}
+		if c.Contract.Symbol != "" && (c.Contract.Symbol != c.Symbol || c.Contract.Exchange != c.Exchange) {
+			errs = append(errs, fmt.Errorf("contract %s/%d与回测合约%s/%d不一致", c.Contract.Symbol, c.Contract.Exchange, c.Symbol, c.Exchange))
+		}
+	}
+	if c.OrderBook && (c.BackTestingMod != TICK || c.Spread != nil) {
+		errs = append(errs, errors.New("orderBook只支持单合约tick模式"))
+	}
+	if c.MarketTrades {
+		if c.BackTestingMod != TICK || c.Spread != nil {
+			errs = append(errs, errors.New("marketTrades只支持单合约tick模式"))
+		}
+		if _, ok := c.DataRepo.(MarketTradeRepo); c.DataRepo != nil && !ok {
+			errs = append(errs, errors.New("dataRepo不支持逐笔成交数据"))
+		}
+	}
+	if c.Spread != nil {
+		if err := c.Spread.Check(); err != nil {
+			errs = append(errs, err)
+		}
+		if c.Spread.Name != c.Symbol {
+			errs = append(errs, errors.New("symbol必须与spread名称一致"))
+		}
+	}
+	if c.EventEngine != nil {
+		if err := c.EventEngine.checkUnused(); err != nil {
+			errs = append(errs, err)
+		}
 	}
 
-	return nil
+	return errs.Err()
 }
 
 type Logger interface {
@@ -87,21 +269,11 @@ type Logger interface {
 	Printf(format string, v ...any)
 }
 
-type defaultLogger struct {
-}
-
-func (defaultLogger) Println(v ...any) {
-	log.Println(v...)
-}
-
-func (defaultLogger) Printf(format string, v ...any) {
-	log.Printf(format, v...)
-}
-
 type BackTestingEngine struct {
 	EngineCfg
 
 	logger Logger
+	events *EventEngine
 
 	historyData *list.List
 
@@ -109,30 +281,95 @@ type BackTestingEngine struct {
 	tick     TickData
 	datetime time.Time
 
+	limitOrderCount   int
+	limitOrders       map[string]*OrderData
 	activeLimitOrders map[string]*OrderData
 	trades            map[string]*TradeData
 	tradeCount        int
 	dailyDf           *dataframe.DataFrame
 	dailyResults      map[string]*DailyResult
+
+	// 价差回测时各腿的参考价、成交和逐日结果
+	legHistory map[int64]map[string]float64
+	legPrices  map[string]float64
+	legTrades  []*TradeData
+
+	roundTrips *roundTripTracker
+	risk       *riskManager
+	timers     *scheduler
+	latency    *latencySim
+	warmingUp  bool
+	legResults map[string]map[string]*DailyResult
+
+	// 已发出但还没有到达交易所的委托
+	pendingOrders map[string]*OrderData
+	// 委托的类型和有效方式，以及按成交累计的净持仓
+	requests map[string]OrderRequest
+	pos      float64
+	algos    *algoEngine
+	brackets *bracketEngine
+
+	benchmarkPrices map[string]float64
+	benchmark       []BenchmarkPoint
+
+	// 开启 OrderBook 时的盘口、被动委托的排队位置和本次更新的成交
+	book       *OrderBook
+	queues     map[string]*queuePosition
+	lastPrice  float64
+	lastVolume float64
+	preVolume  float64
+	// 开启逐笔成交但不开启 OrderBook 时，已经撮合过一次的被动委托，之后只由市场成交撮合
+	resting map[string]struct{}
 }
 
 func newEngine(cfg EngineCfg) (*BackTestingEngine, error) {
 	if err := cfg.Check(); err != nil {
 		return nil, err
 	}
-	return &BackTestingEngine{
+	events := cfg.EventEngine
+	if events == nil {
+		events = NewEventEngine(0)
+		events.Register(EventLog, logHandler)
+	}
+	events.RegisterStrategy(cfg.Strategy)
+
+	engine := &BackTestingEngine{
 		EngineCfg:         cfg,
-		logger:            defaultLogger{},
+		logger:            eventLogger{events},
+		events:            events,
 		historyData:       list.New(),
+		limitOrders:       make(map[string]*OrderData),
 		activeLimitOrders: make(map[string]*OrderData),
 		trades:            make(map[string]*TradeData),
 		dailyResults:      make(map[string]*DailyResult),
-	}, nil
+		legHistory:        make(map[int64]map[string]float64),
+		legPrices:         make(map[string]float64),
+		legResults:        make(map[string]map[string]*DailyResult),
+		roundTrips:        newRoundTripTracker(cfg),
+		risk:              newRiskManager(cfg.Risk, cfg.Size),
+		timers:            newScheduler(),
+		latency:           newLatencySim(cfg.Latency),
+		pendingOrders:     make(map[string]*OrderData),
+		requests:          make(map[string]OrderRequest),
+	}
+	if cfg.OrderBook {
+		engine.book = new(OrderBook)
+		engine.queues = make(map[string]*queuePosition)
+	} else if cfg.MarketTrades {
+		engine.resting = make(map[string]struct{})
+	}
+	engine.algos = newAlgoEngine(engine, cfg.Symbol, cfg.Strategy.OnAlgo, engine.logger, func() time.Time { return engine.datetime })
+	events.Register(EventTimer, engine.onTimer)
+	engine.algos.registerOrders(events)
+	engine.brackets = newBracketEngine(engine, cfg.Symbol, cfg.Strategy.OnBracket, engine.logger, func() time.Time { return engine.datetime })
+	engine.brackets.registerOrders(events)
+	engine.Strategy.SetEngine(engine)
+	return engine, nil
 }
 
 func (b *BackTestingEngine) runBackTesting() {
+	// 策略可以在 OnInit 中调用 LoadBar、LoadTick 预热
 	b.Strategy.OnInit()
-	// todo 缺了让策略提前获得部分交易数据的功能
 	b.logger.Println("策略初始化完成")
 
 	b.Strategy.OnStart()
@@ -145,12 +382,27 @@ func (b *BackTestingEngine) runBackTesting() {
 
 	// todo 没有回放进度的功能
 	for cur := b.historyData.Front(); cur.Next() != nil; cur = cur.Next() {
-		if b.BackTestingMod == BAR {
-			b.newBar(cur.Value.(BarData))
-		} else {
-			b.newTick(cur.Value.(TickData))
+		switch data := cur.Value.(type) {
+		case BarData:
+			b.newBar(data)
+		case TickData:
+			if b.book != nil {
+				b.book.SetTick(data)
+				b.updateLastVolume(data)
+			}
+			b.newTick(data)
+		case DepthData:
+			b.book.Apply(data)
+			b.lastPrice, b.lastVolume = data.LastPrice, data.LastVolume
+			if b.MarketTrades {
+				b.lastVolume = 0
+			}
+			b.newTick(b.book.Tick(data.Symbol, data.UpdatedAt, data.LastPrice, data.LastVolume))
+		case MarketTradeData:
+			b.newMarketTrade(data)
 		}
 	}
+	b.drainDelayed()
 
 	b.Strategy.OnStop()
 	b.logger.Println("历史数据回放结束")
@@ -169,62 +421,166 @@ func (b *BackTestingEngine) loadData() error {
 
 	b.historyData.Init()
 
-	totalDays := int(b.End.Sub(b.Start).Hours() / 24)
-	progressDays := Max(totalDays/10, 1)
-	progressDelta := time.Hour * time.Duration(progressDays*24)
-	intervalDelta := b.Interval
+	if b.Spread == nil {
+		loaded, err := b.loadHistory(b.Symbol, b.Exchange, b.BackTestingMod, b.Start, b.End)
+		if err != nil {
+			return err
+		}
+		if b.MarketTrades {
+			repo := b.DataRepo.(MarketTradeRepo)
+			trades, err := b.loadChunks(func(symbol string, exchange Exchange, _ time.Duration, start, end time.Time) (*list.List, error) {
+				return repo.GetMarketTradeData(symbol, exchange, start, end)
+			}, b.Symbol, b.Exchange, b.Start, b.End)
+			if err != nil {
+				return err
+			}
+			b.logger.Println("逐笔成交加载完成，数据量:", trades.Len())
+			loaded = mergeByTime(loaded, trades)
+		}
+		b.historyData.PushBackList(loaded)
+	} else {
+		if err := b.loadSpreadHistory(); err != nil {
+			return err
+		}
+	}
 
-	start := b.Start
-	end := b.Start.Add(progressDelta)
-	progress := 0
+	b.logger.Println("历史数据加载完成，数据量:", b.historyData.Len())
+
+	if b.Benchmark != "" && b.Benchmark != b.Symbol {
+		if err := b.loadBenchmark(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
 
+// loadHistory 分段加载 [from, to] 的K线或tick，回测和预热共用
+func (b *BackTestingEngine) loadHistory(symbol string, exchange Exchange, mod BackTestingMod, from, to time.Time) (*list.List, error) {
 	var howToLoad LoadFunc
-	if b.BackTestingMod == BAR {
+	if mod == BAR {
 		howToLoad = b.DataRepo.GetBarData
 	} else {
 		howToLoad = b.DataRepo.GetTickData
 	}
+	if depthRepo, ok := b.DataRepo.(DepthRepo); ok && b.OrderBook && mod == TICK {
+		howToLoad = func(symbol string, exchange Exchange, _ time.Duration, start, end time.Time) (*list.List, error) {
+			return depthRepo.GetDepthData(symbol, exchange, start, end)
+		}
+	}
+	return b.loadChunks(howToLoad, symbol, exchange, from, to)
+}
+
+func (b *BackTestingEngine) loadChunks(howToLoad LoadFunc, symbol string, exchange Exchange, from, to time.Time) (*list.List, error) {
+	history := list.New()
+
+	totalDays := Max(int(to.Sub(from).Hours()/24), 1)
+	progressDays := Max(totalDays/10, 1)
+	progressDelta := time.Hour * time.Duration(progressDays*24)
 
-	for start.Before(b.End) {
+	start := from
+	end := from.Add(progressDelta)
+	progress := 0
+
+	for start.Before(to) {
 		// 确保时间范围
-		if end.After(b.End) {
-			end = b.End
+		if end.After(to) {
+			end = to
 		}
 
-		loaded, err := howToLoad(b.Symbol, b.Exchange, b.Interval, start, end)
+		loaded, err := howToLoad(symbol, exchange, b.Interval, start, end)
 		if err != nil {
-			return err
+			return nil, err
+		}
+		// 每段的起止时间都包含在内，分界时间的数据已经在上一段加载过
+		for cur := loaded.Front(); cur != nil; cur = cur.Next() {
+			if start.Equal(from) || dataTime(cur.Value).After(start) {
+				history.PushBack(cur.Value)
+			}
 		}
-		b.historyData.PushBackList(loaded)
 
 		progress += progressDays / totalDays
 		progress = Min(progress, 1)
 
-		start = end.Add(intervalDelta)
+		start = end
 		end = end.Add(progressDelta)
 	}
 
-	b.logger.Println("历史数据加载完成，数据量:", b.historyData.Len())
+	return history, nil
+}
+
+func (b *BackTestingEngine) loadSpreadHistory() error {
+	legs := make(map[string]*list.List, len(b.Spread.Legs))
+	for _, leg := range b.Spread.Legs {
+		loaded, err := b.loadHistory(leg.Symbol, leg.Exchange, b.BackTestingMod, b.Start, b.End)
+		if err != nil {
+			return err
+		}
+		b.logger.Println("价差腿数据加载完成:", leg.Symbol, loaded.Len())
+		legs[leg.Symbol] = loaded
+	}
 
+	if b.BackTestingMod == BAR {
+		spread, legBars := b.Spread.MergeBars(legs)
+		for key, bars := range legBars {
+			prices := make(map[string]float64, len(bars))
+			for symbol, bar := range bars {
+				prices[symbol] = bar.ClosePrice
+			}
+			b.legHistory[key] = prices
+		}
+		b.historyData.PushBackList(spread)
+	} else {
+		spread, legTicks := b.Spread.MergeTicks(legs)
+		for key, ticks := range legTicks {
+			prices := make(map[string]float64, len(ticks))
+			for symbol, tick := range ticks {
+				prices[symbol] = tick.LastPrice
+			}
+			b.legHistory[key] = prices
+		}
+		b.historyData.PushBackList(spread)
+	}
+
+	for _, leg := range b.Spread.Legs {
+		b.legResults[leg.Symbol] = make(map[string]*DailyResult)
+	}
 	return nil
 }
 
 func (b *BackTestingEngine) updateDailyClose(price float64) {
-	date := b.datetime.Format("2006-01-01")
-	if result, ok := b.dailyResults[date]; ok {
+	date := b.datetime.Format("2006-01-02")
+	updateDailyResult(b.dailyResults, date, price)
+
+	if b.Spread != nil {
+		for symbol, legPrice := range b.legPrices {
+			updateDailyResult(b.legResults[symbol], date, legPrice)
+		}
+	}
+}
+
+func updateDailyResult(results map[string]*DailyResult, date string, price float64) {
+	if result, ok := results[date]; ok {
 		result.ClosePrice = price
 	} else {
-		b.dailyResults[date] = NewDailyResult(date, price)
+		results[date] = NewDailyResult(date, price)
 	}
 }
 
 func (b *BackTestingEngine) newBar(bar BarData) {
 	b.bar = bar
 	b.datetime = bar.UpdatedAt.AsTime()
+	if b.Spread != nil {
+		b.legPrices = b.legHistory[b.datetime.UnixNano()]
+	}
 
+	b.runDelayed(b.datetime)
 	b.crossLimitOrder()
 	//b.crossStopOrder()
-	b.Strategy.OnBar(bar)
+	b.roundTrips.updatePrice(bar.HighPrice, bar.LowPrice)
+	b.risk.updatePrice(bar.ClosePrice, b.datetime)
+	b.fireTimers()
+	b.publish(Event{Type: EventBar, Data: bar})
 
 	b.updateDailyClose(bar.ClosePrice)
 }
@@ -232,87 +588,382 @@ func (b *BackTestingEngine) newBar(bar BarData) {
 func (b *BackTestingEngine) newTick(tick TickData) {
 	b.tick = tick
 	b.datetime = tick.UpdatedAt.AsTime()
+	if b.Spread != nil {
+		b.legPrices = b.legHistory[b.datetime.UnixNano()]
+	}
 
+	b.runDelayed(b.datetime)
 	b.crossLimitOrder()
 	//b.crossStopOrder()
-	b.Strategy.OnTick(tick)
+	b.roundTrips.updatePrice(tick.LastPrice, tick.LastPrice)
+	b.risk.updatePrice(tick.LastPrice, b.datetime)
+	b.fireTimers()
+	b.publish(Event{Type: EventTick, Data: tick})
 
 	b.updateDailyClose(tick.LastPrice)
 }
 
 func (b *BackTestingEngine) crossLimitOrder() {
-	var (
-		longCrossPrice  float64
-		shortCrossPrice float64
-		longBestPrice   float64
-		shortBestPrice  float64
-	)
+	if b.book != nil {
+		b.crossOrderBook()
+		return
+	}
+
+	var price crossPrice
 	if b.BackTestingMod == BAR {
-		longCrossPrice = b.bar.LowPrice
-		shortCrossPrice = b.bar.HighPrice
-		longBestPrice = b.bar.OpenPrice
-		shortBestPrice = b.bar.OpenPrice
+		price = barCrossPrice(b.bar)
 	} else {
-		longCrossPrice = b.tick.AskPrice_1
-		shortCrossPrice = b.tick.BidPrice_1
-		longBestPrice = longCrossPrice
-		shortBestPrice = shortCrossPrice
+		price = tickCrossPrice(b.tick)
 	}
 
-	for _, order := range b.activeLimitOrders {
-		longCross := (order.Direction == expb.Direction_LONG) &&
-			(order.Price >= longCrossPrice) &&
-			(longCrossPrice > 0)
+	orders := b.sortedActiveOrders()
+	for _, order := range orders {
+		if _, ok := b.resting[order.OrderNo]; ok {
+			continue
+		}
+		tradePrice, _, ok := matchOrder(order, b.requests[order.OrderNo].Type, price)
+		if !ok {
+			continue
+		}
+		b.fillOrder(order, tradePrice, order.Volume-order.Traded)
+	}
+	b.expireImmediate(orders)
+	if b.resting != nil {
+		for orderNo := range b.activeLimitOrders {
+			b.resting[orderNo] = struct{}{}
+		}
+	}
+}
+
+// expireImmediate 市价、IOC 和 FOK 委托撮合一次后撤销剩余部分
+func (b *BackTestingEngine) expireImmediate(orders []*OrderData) {
+	for _, order := range orders {
+		if _, ok := b.activeLimitOrders[order.OrderNo]; ok && b.requests[order.OrderNo].immediate() {
+			b.expireOrder(order, "未立即成交的部分已撤销")
+		}
+	}
+}
 
-		shortCross := (order.Direction == expb.Direction_SHORT) &&
-			(order.Price <= shortCrossPrice) &&
-			(shortCrossPrice > 0)
+// sortedTrades 按成交顺序排列，逐日结果的成交和盈亏的累加顺序不受 map 遍历顺序影响
+func (b *BackTestingEngine) sortedTrades() []*TradeData {
+	trades := make([]*TradeData, 0, len(b.trades))
+	for _, trade := range b.trades {
+		trades = append(trades, trade)
+	}
+	sort.Slice(trades, func(i, j int) bool { return lessNo(trades[i].TradeNo, trades[j].TradeNo) })
+	return trades
+}
+
+// sortedActiveOrders 按提交顺序排列的活动委托
+func (b *BackTestingEngine) sortedActiveOrders() []*OrderData {
+	orders := make([]*OrderData, 0, len(b.activeLimitOrders))
+	for _, order := range b.activeLimitOrders {
+		orders = append(orders, order)
+	}
+	sort.Slice(orders, func(i, j int) bool { return lessNo(orders[i].OrderNo, orders[j].OrderNo) })
+	return orders
+}
 
-		if !longCross || !shortCross {
+// crossOrderBook 按 L2 盘口撮合，委托按提交顺序吃掉盘口的量
+func (b *BackTestingEngine) crossOrderBook() {
+	book := b.book.clone()
+	orders := b.sortedActiveOrders()
+	for _, order := range orders {
+		queue, ok := b.queues[order.OrderNo]
+		if !ok {
+			queue = new(queuePosition)
+			b.queues[order.OrderNo] = queue
+		}
+		req := b.requests[order.OrderNo]
+		match := marketable(order, req.Type)
+		if req.TimeInForce == FOK && !fillable(match, book, *queue, b.lastPrice, b.lastVolume) {
 			continue
 		}
+		for _, fill := range matchBook(match, &book, queue, b.lastPrice, b.lastVolume) {
+			b.fillOrder(order, fill.price, fill.volume)
+		}
+	}
+	b.expireImmediate(orders)
+}
+
+// fillable 在盘口的副本上试撮合，判断 FOK 委托能否全部成交
+func fillable(order *OrderData, book OrderBook, queue queuePosition, lastPrice, lastVolume float64) bool {
+	book = book.clone()
+	volume := 0.0
+	for _, fill := range matchBook(order, &book, &queue, lastPrice, lastVolume) {
+		volume += fill.volume
+	}
+	return volume >= order.Volume-order.Traded-1e-12
+}
+
+// fillOrder 委托成交 volume，全部成交后从活动委托中移除，只减仓委托最多成交到持仓为 0
+func (b *BackTestingEngine) fillOrder(order *OrderData, tradePrice, volume float64) {
+	if b.requests[order.OrderNo].ReduceOnly {
+		if volume = reduceOnlyVolume(order.Direction, volume, b.pos); volume <= 0 {
+			b.expireOrder(order, "只减仓委托没有可平的持仓")
+			return
+		}
+	}
 
+	order.Traded += volume
+	if order.Traded >= order.Volume-1e-12 {
 		order.Traded = order.Volume
 		order.Status = expb.Status_ALL_TRADED
+	} else {
+		order.Status = expb.Status_PART_TRADED
+	}
+	b.risk.updateOrder(*order)
 
-		b.Strategy.OnOrder(*order)
-		if _, ok := b.activeLimitOrders[order.OrderNo]; ok {
-			delete(b.activeLimitOrders, order.OrderNo)
-		}
+	b.events.Put(Event{Type: EventOrder, Data: *order})
+	if order.Status == expb.Status_ALL_TRADED {
+		delete(b.activeLimitOrders, order.OrderNo)
+		delete(b.queues, order.OrderNo)
+		delete(b.resting, order.OrderNo)
+	}
+
+	b.tradeCount++
+
+	trade := TradeData{
+		Symbol:    order.Symbol,
+		Exchange:  order.Exchange,
+		OrderNo:   order.OrderNo,
+		TradeNo:   strconv.Itoa(b.tradeCount),
+		Direction: order.Direction,
+		Offset:    order.Offset,
+		Price:     tradePrice,
+		Volume:    volume,
+		UpdatedAt: timestamppb.New(b.datetime),
+		Reference: "",
+		//GatewayName: 0,
+	}
+
+	b.pos += signedVolume(order.Direction, volume)
+	b.risk.updateTrade(trade)
+	b.events.Put(Event{Type: EventPosition, Data: signedVolume(order.Direction, volume)})
+	b.events.Put(Event{Type: EventTrade, Data: trade})
+
+	b.trades[trade.TradeNo] = &trade
+	b.roundTrips.addTrade(&trade)
+
+	if b.Spread != nil {
+		b.legTrades = append(b.legTrades, b.Spread.SplitTrade(&trade, b.legPrices)...)
+	}
+}
+
+func (b *BackTestingEngine) SendOrder(req OrderRequest) string {
+	if b.warmingUp {
+		b.logger.Println("委托失败:", errWarmupOrder.Error())
+		return ""
+	}
+	b.limitOrderCount++
+	req, err := b.Contract.normalize(req, b.risk.latestPrice())
+
+	order := &OrderData{
+		Symbol:    b.Symbol,
+		Exchange:  expb.Exchange(b.Exchange),
+		OrderNo:   strconv.Itoa(b.limitOrderCount),
+		Direction: req.Direction,
+		Offset:    req.Offset,
+		Price:     req.Price,
+		Volume:    req.Volume,
+		Status:    expb.Status_NOT_TRADED,
+		UpdatedAt: timestamppb.New(b.datetime),
+	}
+	b.limitOrders[order.OrderNo] = order
+	b.requests[order.OrderNo] = req
+
+	// 不符合合约规格和被风控拒绝的委托也会记录，原因写在 Reference 中
+	if err == nil {
+		err = b.risk.check(req, b.datetime)
+	}
+	if err != nil {
+		order.Status = expb.Status_REJECTED
+		order.Reference = err.Error()
+		b.logger.Println("委托被拒绝:", err.Error())
+		b.events.Put(Event{Type: EventOrder, Data: *order})
+		return order.OrderNo
+	}
+	b.risk.addOrder(*order, b.datetime)
 
-		b.tradeCount++
+	if d := b.latency.delay(b.Latency.Submit); d > 0 {
+		order.Status = expb.Status_SUBMITTING
+		b.pendingOrders[order.OrderNo] = order
+		b.latency.schedule(b.datetime.Add(d), func() { b.activateOrder(order) })
+		return order.OrderNo
+	}
+	b.acceptOrder(order)
 
-		var (
-			tradePrice float64
-			posChange  float64
-		)
+	return order.OrderNo
+}
 
-		if longCross {
-			tradePrice = Min(order.Price, longBestPrice)
-			posChange = order.Volume
+// acceptOrder 委托到达交易所时检查 post-only 和只减仓，只减仓委托的数量不超过持仓
+func (b *BackTestingEngine) acceptOrder(order *OrderData) bool {
+	req := b.requests[order.OrderNo]
+	var reason string
+	switch {
+	case req.TimeInForce == GTX && b.quote().crosses(order.Direction, order.Price):
+		reason = "postOnly委托会立即成交"
+	case req.ReduceOnly:
+		if volume := reduceOnlyVolume(order.Direction, order.Volume, b.pos); volume > 0 {
+			order.Volume = volume
 		} else {
-			tradePrice = Min(order.Price, shortBestPrice)
-			posChange = -order.Volume
+			reason = "只减仓委托不能增加持仓"
+		}
+	}
+	if reason != "" {
+		order.Status = expb.Status_REJECTED
+		order.Reference = reason
+		b.risk.updateOrder(*order)
+		b.logger.Println("委托被拒绝:", reason)
+		b.events.Put(Event{Type: EventOrder, Data: *order})
+		return false
+	}
+
+	b.activeLimitOrders[order.OrderNo] = order
+	return true
+}
+
+func (b *BackTestingEngine) quote() quote {
+	if b.BackTestingMod == BAR {
+		return barQuote(b.bar)
+	}
+	return tickQuote(b.tick)
+}
+
+// CancelOrder 撤单在 Cancel 延迟后生效，先于委托到达时直接撤销委托
+func (b *BackTestingEngine) CancelOrder(orderNo string) {
+	if d := b.latency.delay(b.Latency.Cancel); d > 0 {
+		b.latency.schedule(b.datetime.Add(d), func() { b.cancelOrder(orderNo) })
+		return
+	}
+	b.cancelOrder(orderNo)
+}
+
+func (b *BackTestingEngine) cancelOrder(orderNo string) {
+	order, ok := b.activeLimitOrders[orderNo]
+	if !ok {
+		if order, ok = b.pendingOrders[orderNo]; !ok {
+			return
 		}
+	}
+
+	b.expireOrder(order, "")
+}
+
+// expireOrder 撤销委托，reason 为引擎撤单的原因
+func (b *BackTestingEngine) expireOrder(order *OrderData, reason string) {
+	order.Status = expb.Status_CANCELLED
+	if reason != "" {
+		order.Reference = reason
+	}
+	delete(b.activeLimitOrders, order.OrderNo)
+	delete(b.pendingOrders, order.OrderNo)
+	delete(b.queues, order.OrderNo)
+	delete(b.resting, order.OrderNo)
+	b.risk.updateOrder(*order)
+	b.events.Put(Event{Type: EventOrder, Data: *order})
+}
+
+func (b *BackTestingEngine) SendAlgo(req AlgoRequest) string {
+	if b.warmingUp {
+		b.logger.Println("算法委托失败:", errWarmupOrder.Error())
+		return ""
+	}
+	return b.algos.sendAlgo(req)
+}
+
+func (b *BackTestingEngine) CancelAlgo(algoID string) {
+	b.algos.cancelAlgo(algoID)
+}
+
+func (b *BackTestingEngine) SendBracket(req BracketRequest) string {
+	if b.warmingUp {
+		b.logger.Println("止盈止损委托失败:", errWarmupOrder.Error())
+		return ""
+	}
+	return b.brackets.sendBracket(req)
+}
+
+func (b *BackTestingEngine) CancelBracket(bracketID string) {
+	b.brackets.cancelBracket(bracketID)
+}
+
+// LoadBar 把回测开始前 days 天的K线推给策略，期间不能下单，也不计入统计
+func (b *BackTestingEngine) LoadBar(days int) {
+	if b.Interval <= 0 {
+		b.logger.Println("加载预热数据失败: interval必须大于0")
+		return
+	}
+	b.warmup(BAR, days)
+}
+
+// LoadTick 把回测开始前 days 天的tick推给策略，期间不能下单，也不计入统计
+func (b *BackTestingEngine) LoadTick(days int) {
+	b.warmup(TICK, days)
+}
+
+func (b *BackTestingEngine) warmup(mod BackTestingMod, days int) {
+	history, err := b.loadWarmup(mod, days)
+	if err != nil {
+		b.logger.Println("加载预热数据失败:", err.Error())
+		return
+	}
+
+	// 回放时引擎时间跟随预热数据，定时任务照常触发，结束后恢复
+	datetime := b.datetime
+	b.warmingUp = true
+	count := replayHistory(b.Strategy, history, b.Start, func(t time.Time) {
+		b.datetime = t
+		b.fireTimers()
+	})
+	b.warmingUp = false
+	b.datetime = datetime
+	b.logger.Println("预热数据回放完成，数据量:", count)
+}
+
+// loadWarmup 价差回测时分别加载各腿再合成价差
+func (b *BackTestingEngine) loadWarmup(mod BackTestingMod, days int) (*list.List, error) {
+	start, end, err := warmupRange(b.Start, days)
+	if err != nil {
+		return nil, err
+	}
+	if b.Spread == nil {
+		return b.loadHistory(b.Symbol, b.Exchange, mod, start, end)
+	}
 
-		trade := TradeData{
-			Symbol:    order.Symbol,
-			Exchange:  order.Exchange,
-			OrderNo:   order.OrderNo,
-			TradeNo:   strconv.Itoa(b.tradeCount),
-			Direction: order.Direction,
-			Offset:    order.Offset,
-			Price:     tradePrice,
-			Volume:    order.Volume,
-			UpdatedAt: timestamppb.New(b.datetime),
-			Reference: "",
-			//GatewayName: 0,
+	legs := make(map[string]*list.List, len(b.Spread.Legs))
+	for _, leg := range b.Spread.Legs {
+		loaded, err := b.loadHistory(leg.Symbol, leg.Exchange, mod, start, end)
+		if err != nil {
+			return nil, err
 		}
+		legs[leg.Symbol] = loaded
+	}
+	if mod == BAR {
+		spread, _ := b.Spread.MergeBars(legs)
+		return spread, nil
+	}
+	spread, _ := b.Spread.MergeTicks(legs)
+	return spread, nil
+}
 
-		b.Strategy.OnPosition(posChange)
-		b.Strategy.OnTrade(trade)
+func (b *BackTestingEngine) AddTimer(name string, schedule Schedule) {
+	b.timers.add(name, schedule)
+}
+
+func (b *BackTestingEngine) RemoveTimer(name string) {
+	b.timers.remove(name)
+}
 
-		b.trades[trade.TradeNo] = &trade
+// fireTimers 用当前行情时间触发定时任务，在撮合之后、策略收到行情之前调用
+// fireTimers 按行情时间发出 EventTimer，和实盘一样经事件引擎触发定时任务
+func (b *BackTestingEngine) fireTimers() {
+	b.events.Put(Event{Type: EventTimer, Data: b.datetime})
+}
+
+func (b *BackTestingEngine) onTimer(event Event) {
+	for _, fired := range b.timers.update(event.Data.(time.Time)) {
+		b.Strategy.OnTimer(fired.name, fired.at)
 	}
 }
 
@@ -322,27 +973,133 @@ func (b *BackTestingEngine) calculateResult() {
 		b.logger.Println("成交记录为空，无法计算")
 		return
 	}
-	for _, trade := range b.trades {
-		date := trade.UpdatedAt.AsTime().Format("2006-01-02")
-		dailyResult := b.dailyResults[date]
-		dailyResult.AddTrade(trade)
+
+	if b.Spread == nil {
+		for _, trade := range b.sortedTrades() {
+			date := trade.UpdatedAt.AsTime().Format("2006-01-02")
+			dailyResult := b.dailyResults[date]
+			dailyResult.AddTrade(trade)
+		}
+		b.calculateDailyPnl(b.dailyResults, b.Size, b.Inverse)
+	} else {
+		b.calculateSpreadPnl()
+	}
+
+	results := make([]DailyResult, 0)
+	for _, date := range sortedDates(b.dailyResults) {
+		results = append(results, *b.dailyResults[date])
 	}
 
+	res = dataframe.LoadStructs(results)
+	b.dailyDf = &res
+}
+
+// calculateDailyPnl 按日期顺序逐日计算盈亏，前一日的收盘价和持仓作为后一日的起点
+func (b *BackTestingEngine) calculateDailyPnl(dailyResults map[string]*DailyResult, size float64, inverse bool) {
 	var preClose, startPos float64
 
-	for _, dailyResult := range b.dailyResults {
-		dailyResult.CalculatePnl(preClose, startPos, b.Rate, b.Slippage, b.Size, b.Inverse)
+	for _, date := range sortedDates(dailyResults) {
+		dailyResult := dailyResults[date]
+		dailyResult.CalculatePnl(preClose, startPos, b.Rate, b.Slippage, size, inverse)
 		preClose = dailyResult.ClosePrice
 		startPos = dailyResult.EndPos
 	}
-	results := make([]*DailyResult, 0)
-	for k, v := range b.dailyResults {
-		v.Date = k
-		results = append(results, v)
+}
+
+// calculateSpreadPnl 各腿分别逐日计算盈亏，再汇总到价差的逐日结果上
+func (b *BackTestingEngine) calculateSpreadPnl() {
+	// 腿在成交当天没有行情时按成交价补一条逐日结果
+	for _, trade := range b.legTrades {
+		date := trade.UpdatedAt.AsTime().Format("2006-01-02")
+		legResults, ok := b.legResults[trade.Symbol]
+		if !ok {
+			legResults = make(map[string]*DailyResult)
+			b.legResults[trade.Symbol] = legResults
+		}
+		if _, ok = legResults[date]; !ok {
+			updateDailyResult(legResults, date, trade.Price)
+		}
+		legResults[date].AddTrade(trade)
 	}
 
-	res = dataframe.LoadStructs(results)
-	b.dailyDf = &res
+	for _, leg := range b.Spread.Legs {
+		legResults := b.legResults[leg.Symbol]
+		// 各腿按自己的合约乘数计算盈亏
+		size, inverse := leg.Size, leg.Inverse || b.Inverse
+		if size == 0 {
+			size = b.Size
+		}
+		b.calculateDailyPnl(legResults, size, inverse)
+
+		for date, legResult := range legResults {
+			dailyResult, ok := b.dailyResults[date]
+			if !ok {
+				continue
+			}
+			dailyResult.Trades = append(dailyResult.Trades, legResult.Trades...)
+			dailyResult.TradeCount += legResult.TradeCount
+			dailyResult.Turnover += legResult.Turnover
+			dailyResult.Commission += legResult.Commission
+			dailyResult.Slippage += legResult.Slippage
+			dailyResult.TradingPnl += legResult.TradingPnl
+			dailyResult.HoldingPnl += legResult.HoldingPnl
+			dailyResult.TotalPnl += legResult.TotalPnl
+			dailyResult.NetPnl += legResult.NetPnl
+		}
+	}
+
+	// 价差的持仓和昨收按价差合约本身记录
+	var preClose, startPos float64
+	trades := b.sortedTrades()
+	for _, date := range sortedDates(b.dailyResults) {
+		dailyResult := b.dailyResults[date]
+		dailyResult.PreClose = preClose
+		dailyResult.StartPos = startPos
+		dailyResult.EndPos = startPos
+		for _, trade := range trades {
+			if trade.UpdatedAt.AsTime().Format("2006-01-02") != date {
+				continue
+			}
+			if trade.Direction == expb.Direction_LONG {
+				dailyResult.EndPos += trade.Volume
+			} else {
+				dailyResult.EndPos -= trade.Volume
+			}
+		}
+		preClose = dailyResult.ClosePrice
+		startPos = dailyResult.EndPos
+	}
+}
+
+func sortedDates(dailyResults map[string]*DailyResult) []string {
+	dates := make([]string, 0, len(dailyResults))
+	for date := range dailyResults {
+		dates = append(dates, date)
+	}
+	sort.Strings(dates)
+	return dates
+}
+
+// StatisticKeys calculateStatistics 返回的指标，按输出顺序排列
+var StatisticKeys = []string{
+	"start_date", "end_date", "total_days", "profit_days", "loss_days",
+	"capital", "end_balance", "max_drawdown", "max_ddpercent", "max_drawdown_duration",
+	"total_net_pnl", "daily_net_pnl", "total_commission", "daily_commission",
+	"total_slippage", "daily_slippage", "total_turnover", "daily_turnover",
+	"total_trade_count", "daily_trade_count", "total_return", "annual_return",
+	"daily_return", "return_std", "sharpe_ratio", "return_drawdown_ratio",
+
+	// 相对基准的指标，见 benchmarkStatistics
+	"benchmark_return", "excess_return", "alpha", "beta",
+	"information_ratio", "tracking_error",
+
+	// 逐笔交易统计，见 roundTripStatistics
+	"round_trip_count", "win_count", "loss_count", "win_rate",
+	"average_win", "average_loss", "payoff_ratio", "average_net_pnl",
+	"max_win_streak", "max_loss_streak", "average_holding_hours",
+	"average_mae", "average_mfe",
+	"long_count", "long_win_rate", "long_net_pnl",
+	"short_count", "short_win_rate", "short_net_pnl",
 }
 
 func (b *BackTestingEngine) calculateStatistics() map[string]any {
@@ -364,6 +1121,13 @@ func (b *BackTestingEngine) calculateStatistics() map[string]any {
 
 	b.logger.Println("开始计算策略统计指标")
 
+	dates := sortedDates(b.dailyResults)
+	dailyResults := make([]*DailyResult, 0, len(dates))
+	for _, date := range dates {
+		dailyResults = append(dailyResults, b.dailyResults[date])
+	}
+	returns := balanceReturns(b.Capital, dailyBalances(b.Capital, dailyResults))
+
 	if b.dailyDf != nil {
 		df := b.dailyDf
 		netPnlSeries := df.Col("NetPnl")
@@ -371,11 +1135,10 @@ func (b *BackTestingEngine) calculateStatistics() map[string]any {
 		preBalanceSeries := utils.ShiftSeries(balanceSeries, 1, "PreBalance")
 		preBalanceSeries.Set(0, series.New(b.Capital, series.Float, "PreBalance"))
 
-		// TODO: Highlevel
-		balanceSeries.Rolling(1).Mean()
+		highlevelSeries := utils.CumMaxSeries(balanceSeries, "Highlevel")
 
-		drawdownSeries := utils.SubSeries(balanceSeries, df.Col("Highlevel"), "Drawdown")
-		ddpercentSeries := utils.MutiSeries(utils.DivSeries(drawdownSeries, df.Col("Highlevel"), ""), 100, "ddpercent")
+		drawdownSeries := utils.SubSeries(balanceSeries, highlevelSeries, "Drawdown")
+		ddpercentSeries := utils.MutiSeries(utils.DivSeries(drawdownSeries, highlevelSeries, ""), 100, "ddpercent")
 		startDate = b.Start.Format("2006-01-02")
 		endDate = b.End.Format("2006-01-02")
 		totalDays = balanceSeries.Len()
@@ -387,26 +1150,31 @@ func (b *BackTestingEngine) calculateStatistics() map[string]any {
 		maxDdpercent = ddpercentSeries.Min()
 
 		totalNetPnl = netPnlSeries.Sum()
-		dailyNetPnl = totalNetPnl / float64(totalDays)
+		dailyNetPnl = ratio(totalNetPnl, float64(totalDays))
 
 		totalCommission = df.Col("Commission").Sum()
-		dailyCommission = totalCommission / float64(totalDays)
+		dailyCommission = ratio(totalCommission, float64(totalDays))
 
 		totalSlippage = df.Col("Slippage").Sum()
-		dailySlippage = totalSlippage / float64(totalDays)
+		dailySlippage = ratio(totalSlippage, float64(totalDays))
 
 		totalTurnover = df.Col("Turnover").Sum()
-		dailyTurnover = totalTurnover / float64(totalDays)
+		dailyTurnover = ratio(totalTurnover, float64(totalDays))
 
 		totalTradeCount = df.Col("TradeCount").Sum()
-		dailyTradeCount = totalTradeCount / float64(totalDays)
+		dailyTradeCount = ratio(totalTradeCount, float64(totalDays))
 
-		totalReturn = (endBalance/b.Capital - 1) * 100
-		annualReturn = totalReturn / float64(totalDays) * float64(b.AnnualDays)
+		totalReturn = (ratio(endBalance, b.Capital) - 1) * 100
+		annualReturn = ratio(totalReturn, float64(totalDays)) * float64(b.AnnualDays)
 
-		// TODO: dailyReturn, returnStd, dailyRiskFree, sharpeRatio
+		// 无风险利率按 0 计算
+		mean, std := meanStd(returns)
+		dailyReturn = mean * 100
+		returnStd = std * 100
+		sharpeRatio = ratio(mean, std) * math.Sqrt(float64(b.AnnualDays))
 
-		returnDrawdownRatio = -totalReturn / maxDdpercent
+		// 没有回撤时收益回撤比为 0
+		returnDrawdownRatio = ratio(-totalReturn, maxDdpercent)
 	}
 
 	b.logger.Println("----------------------")
@@ -438,9 +1206,9 @@ func (b *BackTestingEngine) calculateStatistics() map[string]any {
 	b.logger.Printf("日均成交金额：\t%.2f \n", dailyTurnover)
 	b.logger.Printf("日均成交笔数：\t%v \n", dailyTradeCount)
 
-	// b.logger.Printf("日均收益率：\t%.2f \n", dailyReturn)
-	// b.logger.Printf("收益标准差：\t%.2f \n", returnStd)
-	// b.logger.Printf("Sharpe Ratio：\t%.2f \n", sharpeRatio)
+	b.logger.Printf("日均收益率：\t%.2f \n", dailyReturn)
+	b.logger.Printf("收益标准差：\t%.2f \n", returnStd)
+	b.logger.Printf("Sharpe Ratio：\t%.2f \n", sharpeRatio)
 	b.logger.Printf("收益回撤比：\t%.2f \n", returnDrawdownRatio)
 
 	statistics := map[string]any{
@@ -471,6 +1239,26 @@ func (b *BackTestingEngine) calculateStatistics() map[string]any {
 		"sharpe_ratio":          sharpeRatio,
 		"return_drawdown_ratio": returnDrawdownRatio,
 	}
+
+	// 没有设置基准时相关指标为 0
+	benchmark := benchmarkStatistics(returns, benchmarkReturns(b.benchmark), totalReturn, b.benchmark, b.AnnualDays)
+	if b.Benchmark != "" {
+		b.logger.Printf("基准收益率：\t%.2f \n", benchmark["benchmark_return"])
+		b.logger.Printf("超额收益率：\t%.2f \n", benchmark["excess_return"])
+		b.logger.Printf("Alpha：\t%.2f \n", benchmark["alpha"])
+		b.logger.Printf("Beta：\t%.2f \n", benchmark["beta"])
+	}
+	for key, value := range benchmark {
+		statistics[key] = value
+	}
+
+	tripStatistics := roundTripStatistics(b.roundTrips.trips)
+	b.logger.Printf("逐笔交易数：\t%v \n", tripStatistics["round_trip_count"])
+	b.logger.Printf("胜率：\t%.2f \n", tripStatistics["win_rate"])
+	b.logger.Printf("盈亏比：\t%.2f \n", tripStatistics["payoff_ratio"])
+	for key, value := range tripStatistics {
+		statistics[key] = value
+	}
 	b.logger.Println("策略统计指标计算完成")
 	return statistics
 }
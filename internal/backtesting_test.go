@@ -1,6 +1,157 @@
 package internal
 
-import "testing"
+import (
+	"container/list"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+type memoryRepo struct {
+	bars  map[string][]BarData
+	ticks map[string][]TickData
+}
+
+func (m *memoryRepo) GetBarData(symbol string, _ Exchange, _ time.Duration, start, end time.Time) (*list.List, error) {
+	l := list.New()
+	for _, bar := range m.bars[symbol] {
+		t := bar.UpdatedAt.AsTime()
+		if !t.Before(start) && !t.After(end) {
+			l.PushBack(bar)
+		}
+	}
+	return l, nil
+}
+
+func (m *memoryRepo) GetTickData(symbol string, _ Exchange, _ time.Duration, start, end time.Time) (*list.List, error) {
+	l := list.New()
+	for _, tick := range m.ticks[symbol] {
+		t := tick.UpdatedAt.AsTime()
+		if !t.Before(start) && !t.After(end) {
+			l.PushBack(tick)
+		}
+	}
+	return l, nil
+}
+
+func newTestBar(symbol string, t time.Time, open, high, low, close float64) BarData {
+	return BarData{
+		Symbol:     symbol,
+		UpdatedAt:  timestamppb.New(t),
+		Volume:     100,
+		OpenPrice:  open,
+		HighPrice:  high,
+		LowPrice:   low,
+		ClosePrice: close,
+	}
+}
+
+type backtestTestStrategy struct {
+	StrategyTemplate
+	bars int
+}
+
+func (s *backtestTestStrategy) OnBar(bar BarData) {
+	s.bars++
+	switch s.bars {
+	case 1:
+		s.Buy(bar.ClosePrice*1.2, 1)
+	case 3:
+		s.Sell(bar.ClosePrice*0.8, 1)
+	}
+}
+
+// evaluateTestBacktest 收盘价 100、110、90、120、120，第一根K线后买入，第三根K线后卖出
+func evaluateTestBacktest(t *testing.T) *BacktestResult {
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	closes := []float64{100, 110, 90, 120, 120}
+	bars := make([]BarData, 0, len(closes))
+	for i, price := range closes {
+		bars = append(bars, newTestBar("BTCUSDT", start.Add(time.Duration(i)*day), price, price, price, price))
+	}
+
+	result, err := Evaluate(EngineCfg{
+		Strategy:   new(backtestTestStrategy),
+		DataRepo:   &memoryRepo{bars: map[string][]BarData{"BTCUSDT": bars}},
+		Symbol:     "BTCUSDT",
+		Start:      start,
+		End:        start.Add(5 * day),
+		Interval:   day,
+		Capital:    1000,
+		Size:       1,
+		AnnualDays: 365,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
 
 func TestBacktest(t *testing.T) {
+	result := evaluateTestBacktest(t)
+
+	// 第二天开盘110买入，第四天开盘120卖出
+	if len(result.Trades) != 2 || result.Trades[0].Price != 110 || result.Trades[1].Price != 120 {
+		t.Fatalf("trades: %+v", result.Trades)
+	}
+	if len(result.DailyResults) != 4 {
+		t.Fatalf("daily results: %d", len(result.DailyResults))
+	}
+	if pnl := result.Statistics["total_net_pnl"].(float64); pnl != 10 {
+		t.Fatalf("total net pnl: %v", pnl)
+	}
+	if balance := result.Statistics["end_balance"].(float64); balance != 1010 {
+		t.Fatalf("end balance: %v", balance)
+	}
+	if drawdown := result.Statistics["max_drawdown"].(float64); drawdown != -20 {
+		t.Fatalf("max drawdown: %v", drawdown)
+	}
+
+	balances := result.Balances()
+	if len(balances) != 4 || balances[3].Balance != 1010 {
+		t.Fatalf("balances: %+v", balances)
+	}
+	if dd := result.Statistics["max_ddpercent"].(float64); balances[2].DdPercent != dd {
+		t.Fatalf("ddpercent: %v %v", balances[2].DdPercent, dd)
+	}
+
+	// 持有期间最低90，最高为卖出价120
+	trips := result.RoundTrips
+	if len(trips) != 1 || trips[0].NetPnl != 10 || trips[0].Mae != -20 || trips[0].Mfe != 10 {
+		t.Fatalf("round trips: %+v", trips)
+	}
+	if result.Statistics["win_rate"].(float64) != 100 {
+		t.Fatalf("win rate: %v", result.Statistics["win_rate"])
+	}
+}
+
+// 分段加载时分界时间的数据只加载一次，段与段之间不遗漏数据
+func TestLoadChunks(t *testing.T) {
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(20 * 24 * time.Hour)
+	repo := &memoryRepo{ticks: make(map[string][]TickData)}
+	for at := start; !at.After(end); at = at.Add(30 * time.Minute) {
+		repo.ticks["BTCUSDT"] = append(repo.ticks["BTCUSDT"], newTestTick("BTCUSDT", at, 100, 1))
+	}
+
+	for _, interval := range []time.Duration{0, time.Hour} {
+		engine := &BackTestingEngine{EngineCfg: EngineCfg{Interval: interval}}
+		history, err := engine.loadChunks(repo.GetTickData, "BTCUSDT", 0, start, end)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if history.Len() != len(repo.ticks["BTCUSDT"]) {
+			t.Fatalf("interval %v: %d != %d", interval, history.Len(), len(repo.ticks["BTCUSDT"]))
+		}
+		var last time.Time
+		for cur := history.Front(); cur != nil; cur = cur.Next() {
+			if at := dataTime(cur.Value); !at.After(last) {
+				t.Fatalf("interval %v: %v after %v", interval, at, last)
+			} else {
+				last = at
+			}
+		}
+	}
 }
@@ -0,0 +1,78 @@
+package internal
+
+import (
+	"time"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// BarGenerator 由 tick 合成 K 线
+// K 线时间为周期起点，tick 进入下一个周期时推送上一根 K 线；成交量和成交额由 tick 的累计值相减得到
+type BarGenerator struct {
+	Interval time.Duration
+	OnBar    func(bar BarData)
+
+	bar      *BarData
+	start    time.Time
+	lastTick *TickData
+}
+
+func NewBarGenerator(interval time.Duration, onBar func(bar BarData)) *BarGenerator {
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	return &BarGenerator{Interval: interval, OnBar: onBar}
+}
+
+func (g *BarGenerator) UpdateTick(tick TickData) {
+	if tick.LastPrice <= 0 {
+		return
+	}
+
+	datetime := tick.UpdatedAt.AsTime()
+	start := datetime.Truncate(g.Interval)
+
+	// 过滤乱序的 tick
+	if g.lastTick != nil && datetime.Before(g.lastTick.UpdatedAt.AsTime()) {
+		return
+	}
+
+	if g.bar != nil && !start.Equal(g.start) {
+		g.OnBar(*g.bar)
+		g.bar = nil
+	}
+
+	if g.bar == nil {
+		g.start = start
+		g.bar = &BarData{
+			Symbol:       tick.Symbol,
+			Exchange:     tick.Exchange,
+			UpdatedAt:    timestamppb.New(start),
+			OpenPrice:    tick.LastPrice,
+			HighPrice:    tick.LastPrice,
+			LowPrice:     tick.LastPrice,
+			ClosePrice:   tick.LastPrice,
+			OpenInterest: tick.OpenInterest,
+		}
+	} else {
+		g.bar.HighPrice = Max(g.bar.HighPrice, tick.LastPrice)
+		g.bar.LowPrice = Min(g.bar.LowPrice, tick.LastPrice)
+		g.bar.ClosePrice = tick.LastPrice
+		g.bar.OpenInterest = tick.OpenInterest
+	}
+
+	if g.lastTick != nil {
+		g.bar.Volume += Max(tick.Volume-g.lastTick.Volume, 0)
+		g.bar.Turnover += Max(tick.Turnover-g.lastTick.Turnover, 0)
+	}
+	g.lastTick = &tick
+}
+
+// Flush 推送还没走完的 K 线，用于停止时
+func (g *BarGenerator) Flush() {
+	if g.bar == nil {
+		return
+	}
+	g.OnBar(*g.bar)
+	g.bar = nil
+}
@@ -0,0 +1,52 @@
+package internal
+
+import (
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func newTestTick(symbol string, t time.Time, price, volume float64) TickData {
+	return TickData{
+		Symbol:     symbol,
+		UpdatedAt:  timestamppb.New(t),
+		LastPrice:  price,
+		Volume:     volume,
+		BidPrice_1: price - 1,
+		AskPrice_1: price + 1,
+	}
+}
+
+func TestBarGenerator(t *testing.T) {
+	var bars []BarData
+	generator := NewBarGenerator(time.Minute, func(bar BarData) {
+		bars = append(bars, bar)
+	})
+
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	generator.UpdateTick(newTestTick("BTCUSDT", start.Add(10*time.Second), 100, 10))
+	generator.UpdateTick(newTestTick("BTCUSDT", start.Add(20*time.Second), 105, 12))
+	generator.UpdateTick(newTestTick("BTCUSDT", start.Add(15*time.Second), 200, 13))
+	generator.UpdateTick(newTestTick("BTCUSDT", start.Add(30*time.Second), 98, 15))
+	generator.UpdateTick(newTestTick("BTCUSDT", start.Add(70*time.Second), 101, 20))
+
+	if len(bars) != 1 {
+		t.Fatalf("bars: %d", len(bars))
+	}
+	bar := bars[0]
+	if !bar.UpdatedAt.AsTime().Equal(start) {
+		t.Fatalf("datetime: %v", bar.UpdatedAt.AsTime())
+	}
+	if bar.OpenPrice != 100 || bar.HighPrice != 105 || bar.LowPrice != 98 || bar.ClosePrice != 98 {
+		t.Fatalf("ohlc: %+v", bar)
+	}
+	if bar.Volume != 5 {
+		t.Fatalf("volume: %v", bar.Volume)
+	}
+
+	generator.Flush()
+	if len(bars) != 2 || bars[1].Volume != 5 || bars[1].ClosePrice != 101 {
+		t.Fatalf("flushed: %+v", bars)
+	}
+}
@@ -0,0 +1,152 @@
+package internal
+
+import "math"
+
+// BenchmarkPoint 基准合约的逐日价格，Balance 为起始资金买入持有的资金曲线
+type BenchmarkPoint struct {
+	Date    string
+	Price   float64
+	Balance float64
+}
+
+// loadBenchmark 加载基准合约，按日期记录每天最后一个价格
+func (b *BackTestingEngine) loadBenchmark() error {
+	loaded, err := b.loadHistory(b.Benchmark, b.Exchange, b.BackTestingMod, b.Start, b.End)
+	if err != nil {
+		return err
+	}
+
+	b.benchmarkPrices = make(map[string]float64)
+	for cur := loaded.Front(); cur != nil; cur = cur.Next() {
+		switch data := cur.Value.(type) {
+		case BarData:
+			b.benchmarkPrices[data.UpdatedAt.AsTime().Format("2006-01-02")] = data.ClosePrice
+		case TickData:
+			b.benchmarkPrices[data.UpdatedAt.AsTime().Format("2006-01-02")] = data.LastPrice
+		}
+	}
+	b.logger.Println("基准数据加载完成:", b.Benchmark, loaded.Len())
+	return nil
+}
+
+// benchmarkCurve 按回测的交易日对齐基准价格，基准是回测合约本身时使用逐日收盘价
+// 缺失的日期沿用前一日价格，开头缺失时使用第一个有效价格
+func (b *BackTestingEngine) benchmarkCurve() []BenchmarkPoint {
+	if b.Benchmark == "" {
+		return nil
+	}
+
+	dates := sortedDates(b.dailyResults)
+	prices := b.benchmarkPrices
+	if b.Benchmark == b.Symbol {
+		prices = make(map[string]float64, len(dates))
+		for _, date := range dates {
+			prices[date] = b.dailyResults[date].ClosePrice
+		}
+	}
+
+	first := 0.0
+	for _, date := range dates {
+		if price, ok := prices[date]; ok && price != 0 {
+			first = price
+			break
+		}
+	}
+	if first == 0 {
+		b.logger.Println("基准没有有效价格:", b.Benchmark)
+		return nil
+	}
+
+	curve := make([]BenchmarkPoint, 0, len(dates))
+	price := first
+	for _, date := range dates {
+		if p, ok := prices[date]; ok && p != 0 {
+			price = p
+		}
+		curve = append(curve, BenchmarkPoint{Date: date, Price: price, Balance: b.Capital * price / first})
+	}
+	return curve
+}
+
+// balanceReturns 逐日收益率，第一天相对起始资金计算
+func balanceReturns(capital float64, balances []DailyBalance) []float64 {
+	returns := make([]float64, 0, len(balances))
+	pre := capital
+	for _, balance := range balances {
+		returns = append(returns, ratio(balance.Balance, pre)-1)
+		pre = balance.Balance
+	}
+	return returns
+}
+
+// benchmarkReturns 基准的逐日收益率，第一天买入，收益为 0
+func benchmarkReturns(curve []BenchmarkPoint) []float64 {
+	returns := make([]float64, 0, len(curve))
+	for i, point := range curve {
+		if i == 0 {
+			returns = append(returns, 0)
+			continue
+		}
+		returns = append(returns, point.Price/curve[i-1].Price-1)
+	}
+	return returns
+}
+
+// meanStd 均值和样本标准差
+func meanStd(values []float64) (mean, std float64) {
+	if len(values) == 0 {
+		return 0, 0
+	}
+	for _, v := range values {
+		mean += v
+	}
+	mean /= float64(len(values))
+	if len(values) < 2 {
+		return mean, 0
+	}
+	for _, v := range values {
+		std += (v - mean) * (v - mean)
+	}
+	return mean, math.Sqrt(std / float64(len(values)-1))
+}
+
+// benchmarkStatistics 相对基准的超额收益、alpha、beta、信息比率和跟踪误差
+// alpha、跟踪误差为年化百分比，信息比率按年化天数年化
+func benchmarkStatistics(returns, benchmark []float64, totalReturn float64, curve []BenchmarkPoint, annualDays int) map[string]any {
+	statistics := map[string]any{
+		"benchmark_return":  0.0,
+		"excess_return":     0.0,
+		"alpha":             0.0,
+		"beta":              0.0,
+		"information_ratio": 0.0,
+		"tracking_error":    0.0,
+	}
+	if len(curve) == 0 || len(returns) != len(benchmark) {
+		return statistics
+	}
+
+	benchmarkReturn := (curve[len(curve)-1].Price/curve[0].Price - 1) * 100
+	statistics["benchmark_return"] = benchmarkReturn
+	statistics["excess_return"] = totalReturn - benchmarkReturn
+
+	mean, _ := meanStd(returns)
+	benchmarkMean, benchmarkStd := meanStd(benchmark)
+	active := make([]float64, len(returns))
+	var cov float64
+	for i := range returns {
+		active[i] = returns[i] - benchmark[i]
+		cov += (returns[i] - mean) * (benchmark[i] - benchmarkMean)
+	}
+	if len(returns) > 1 {
+		cov /= float64(len(returns) - 1)
+	}
+
+	beta := ratio(cov, benchmarkStd*benchmarkStd)
+	activeMean, activeStd := meanStd(active)
+	annual := float64(annualDays)
+	statistics["beta"] = beta
+	statistics["alpha"] = (mean - beta*benchmarkMean) * annual * 100
+	statistics["tracking_error"] = activeStd * math.Sqrt(annual) * 100
+	statistics["information_ratio"] = ratio(activeMean, activeStd) * math.Sqrt(annual)
+	return statistics
+}
@@ -0,0 +1,84 @@
+package internal
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestBenchmarkStatistics(t *testing.T) {
+	benchmark := []float64{0, 0.01, -0.02, 0.03, 0.01}
+	returns := make([]float64, len(benchmark))
+	for i, r := range benchmark {
+		returns[i] = 2 * r
+	}
+	curve := []BenchmarkPoint{{Price: 100}, {Price: 120}}
+
+	statistics := benchmarkStatistics(returns, benchmark, 50, curve, 365)
+	if beta := statistics["beta"].(float64); math.Abs(beta-2) > 1e-9 {
+		t.Fatalf("beta: %v", beta)
+	}
+	if alpha := statistics["alpha"].(float64); math.Abs(alpha) > 1e-9 {
+		t.Fatalf("alpha: %v", alpha)
+	}
+	if math.Abs(statistics["benchmark_return"].(float64)-20) > 1e-9 || math.Abs(statistics["excess_return"].(float64)-30) > 1e-9 {
+		t.Fatalf("statistics: %v", statistics)
+	}
+
+	// 超额收益等于基准收益，跟踪误差为基准的年化波动
+	_, std := meanStd(benchmark)
+	if te := statistics["tracking_error"].(float64); math.Abs(te-std*math.Sqrt(365)*100) > 1e-9 {
+		t.Fatalf("tracking error: %v", te)
+	}
+
+	empty := benchmarkStatistics(returns, benchmark, 50, nil, 365)
+	if empty["beta"].(float64) != 0 || empty["benchmark_return"].(float64) != 0 {
+		t.Fatalf("empty: %v", empty)
+	}
+}
+
+func TestBacktestBenchmark(t *testing.T) {
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	bars := map[string][]BarData{}
+	for i, price := range []float64{100, 110, 90, 120, 120} {
+		date := start.Add(time.Duration(i) * day)
+		bars["BTCUSDT"] = append(bars["BTCUSDT"], newTestBar("BTCUSDT", date, price, price, price, price))
+		// ETHUSDT 缺少第三天的数据
+		if i != 2 {
+			bars["ETHUSDT"] = append(bars["ETHUSDT"], newTestBar("ETHUSDT", date, price/10, price/10, price/10, price/10))
+		}
+	}
+
+	for _, benchmark := range []string{"BTCUSDT", "ETHUSDT"} {
+		result, err := Evaluate(EngineCfg{
+			Strategy:   new(backtestTestStrategy),
+			DataRepo:   &memoryRepo{bars: bars},
+			Symbol:     "BTCUSDT",
+			Start:      start,
+			End:        start.Add(5 * day),
+			Interval:   day,
+			Capital:    1000,
+			Size:       1,
+			AnnualDays: 365,
+			Benchmark:  benchmark,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		curve := result.Benchmark
+		if len(curve) != len(result.DailyResults) || curve[0].Balance != 1000 || curve[len(curve)-1].Balance != 1200 {
+			t.Fatalf("%s curve: %+v", benchmark, curve)
+		}
+		if r := result.Statistics["benchmark_return"].(float64); math.Abs(r-20) > 1e-9 {
+			t.Fatalf("%s benchmark return: %v", benchmark, r)
+		}
+		if r := result.Statistics["excess_return"].(float64); math.Abs(r+19) > 1e-9 {
+			t.Fatalf("%s excess return: %v", benchmark, r)
+		}
+		if result.Statistics["beta"].(float64) <= 0 {
+			t.Fatalf("%s beta: %v", benchmark, result.Statistics["beta"])
+		}
+	}
+}
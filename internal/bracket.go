@@ -0,0 +1,400 @@
+package internal
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"time"
+
+	expb "newgitlab.com/xquant/exchange-protocols/protocols/src/go"
+)
+
+// BracketRequest 止盈止损委托组，止盈为限价单，止损在价格触及后由引擎发出市价单，一方成交后撤销另一方
+// Entry 为空时是 OCO 委托，直接按 Direction 和 Volume 挂出止盈止损保护已有持仓
+// 有入场委托时，入场委托每次成交后按已成交量挂出或调整反方向的止盈止损，入场委托还在挂单时已成交的部分同样受保护
+type BracketRequest struct {
+	Entry     *OrderRequest
+	Direction expb.Direction
+	Volume    float64
+
+	// 止盈价和止损触发价，为 0 时不设置，至少设置一个
+	TakeProfit float64
+	StopLoss   float64
+	// 止盈止损单是否只减仓
+	ReduceOnly bool
+}
+
+func (r BracketRequest) Check() error {
+	var errs CheckErrors
+	if r.Entry == nil && r.Volume <= 0 {
+		errs = append(errs, errors.New("OCO委托数量必须大于0"))
+	}
+	if r.Entry != nil && r.Entry.Volume <= 0 {
+		errs = append(errs, errors.New("入场委托数量必须大于0"))
+	}
+	if r.TakeProfit < 0 || r.StopLoss < 0 {
+		errs = append(errs, errors.New("止盈止损价不能为负数"))
+	}
+	if r.TakeProfit == 0 && r.StopLoss == 0 {
+		errs = append(errs, errors.New("止盈止损价至少设置一个"))
+	}
+	if r.TakeProfit > 0 && r.StopLoss > 0 {
+		// 平多头时止盈价高于止损价
+		if exit := r.exit(); (exit == expb.Direction_SHORT) != (r.TakeProfit > r.StopLoss) {
+			errs = append(errs, errors.New("止盈价和止损价的方向不对"))
+		}
+	}
+	return errs.Err()
+}
+
+// exit 止盈止损单的方向
+func (r BracketRequest) exit() expb.Direction {
+	if r.Entry == nil {
+		return r.Direction
+	}
+	if r.Entry.Direction == expb.Direction_LONG {
+		return expb.Direction_SHORT
+	}
+	return expb.Direction_LONG
+}
+
+// BracketData 委托组的进度，Status 为 NOT_TRADED 时等待入场，PART_TRADED 时止盈止损生效，ALL_TRADED 时已全部平仓
+type BracketData struct {
+	BracketID string
+	// 入场、止盈和触发后的止损委托编号
+	Entry      string
+	TakeProfit string
+	StopLoss   string
+	// 止盈止损的方向和数量，以及已平仓的数量
+	Direction expb.Direction
+	Volume    float64
+	Closed    float64
+	Status    expb.Status
+	UpdatedAt time.Time
+	Reference string
+}
+
+type bracket struct {
+	BracketData
+	req BracketRequest
+
+	// 入场委托已结束，以及委托回报中的成交量，成交回报到齐前不结束委托组
+	entryDone   bool
+	entryTraded float64
+
+	// 止盈单和止损单是否还在挂单及委托数量，止盈单覆盖的入场成交量，入场继续成交后撤单按新的数量重挂
+	profitLive   bool
+	profitVolume float64
+	profitTarget float64
+	resizing     bool
+	stopLive     bool
+	stopVolume   float64
+	// 止损触发后撤销止盈，止损对剩余的持仓一直有效
+	triggered bool
+	// 已结束的平仓委托在委托回报中的成交量，以及只减仓的委托被持仓截短
+	exitTraded float64
+	flat       bool
+}
+
+// bracketEngine 管理一个策略的委托组，和算法委托一样在事件引擎中处理行情和回报
+type bracketEngine struct {
+	engine CtaEngine
+	symbol string
+	notify func(BracketData)
+	logger Logger
+
+	count int
+	// 回测为行情时间，实盘为系统时间
+	now      func() time.Time
+	brackets map[string]*bracket
+	orders   map[string]*bracket
+	// 正在发送的委托组和要记录的委托编号，同步的事件引擎会在 SendOrder 返回前推送回报
+	sending *bracket
+	field   *string
+}
+
+func newBracketEngine(engine CtaEngine, symbol string, notify func(BracketData), logger Logger, now func() time.Time) *bracketEngine {
+	return &bracketEngine{
+		engine:   engine,
+		symbol:   symbol,
+		notify:   notify,
+		logger:   logger,
+		now:      now,
+		brackets: make(map[string]*bracket),
+		orders:   make(map[string]*bracket),
+	}
+}
+
+func (e *bracketEngine) register(events *EventEngine) {
+	events.Register(EventBar, e.onMarketEvent)
+	events.Register(EventTick, e.onMarketEvent)
+	e.registerOrders(events)
+}
+
+// registerOrders 回测中行情由引擎直接推送，这里只注册委托和成交
+func (e *bracketEngine) registerOrders(events *EventEngine) {
+	events.Register(EventOrder, func(event Event) {
+		e.onOrder(event.Data.(OrderData))
+	})
+	events.Register(EventTrade, func(event Event) {
+		e.onTrade(event.Data.(TradeData))
+	})
+}
+
+func (e *bracketEngine) onMarketEvent(event Event) {
+	switch data := event.Data.(type) {
+	case BarData:
+		if data.Symbol == e.symbol {
+			e.onMarket(algoMarket{data.UpdatedAt.AsTime(), data.ClosePrice, data.HighPrice, data.LowPrice, true})
+		}
+	case TickData:
+		if data.Symbol == e.symbol {
+			e.onMarket(algoMarket{data.UpdatedAt.AsTime(), data.LastPrice, data.LastPrice, data.LastPrice, false})
+		}
+	}
+}
+
+func (e *bracketEngine) sendBracket(req BracketRequest) string {
+	if err := req.Check(); err != nil {
+		e.logger.Println("止盈止损委托失败:", err.Error())
+		return ""
+	}
+
+	e.count++
+	b := &bracket{
+		BracketData: BracketData{
+			BracketID: "bracket." + strconv.Itoa(e.count),
+			Direction: req.exit(),
+			Status:    expb.Status_NOT_TRADED,
+			UpdatedAt: e.now(),
+		},
+		req: req,
+	}
+	e.brackets[b.BracketID] = b
+	e.notify(b.BracketData)
+
+	if req.Entry == nil {
+		b.entryDone, b.entryTraded = true, req.Volume
+		e.protect(b, req.Volume)
+	} else {
+		e.send(b, &b.Entry, *req.Entry)
+	}
+	return b.BracketID
+}
+
+// cancelBracket 撤销还在挂单的入场和止盈委托
+func (e *bracketEngine) cancelBracket(bracketID string) {
+	if b, ok := e.brackets[bracketID]; ok {
+		e.finish(b, expb.Status_CANCELLED, "")
+	}
+}
+
+// send 发送失败时结束委托组
+func (e *bracketEngine) send(b *bracket, field *string, req OrderRequest) {
+	e.sending, e.field = b, field
+	orderNo := e.engine.SendOrder(req)
+	e.sending, e.field = nil, nil
+	if orderNo == "" {
+		e.finish(b, expb.Status_CANCELLED, "委托发送失败")
+		return
+	}
+	// 同步推送的回报已经在 onOrder 中记录
+	if _, handled := e.orders[orderNo]; handled {
+		return
+	}
+	e.orders[orderNo] = b
+	*field = orderNo
+}
+
+// protect 受保护的数量增加到 volume，止损在行情触及后发出
+func (e *bracketEngine) protect(b *bracket, volume float64) {
+	b.Volume = volume
+	b.flat = false
+	b.Status = expb.Status_PART_TRADED
+	b.UpdatedAt = e.now()
+	e.notify(b.BracketData)
+	e.update(b)
+}
+
+// update 按未平仓的数量挂出或调整平仓委托，入场结束且全部平仓后结束委托组
+func (e *bracketEngine) update(b *bracket) {
+	if _, ok := e.brackets[b.BracketID]; !ok || b.profitLive && b.resizing {
+		return
+	}
+	// 已结束的平仓委托的成交回报可能还没到，按委托回报的成交量计算未平仓数量
+	open := b.Volume - Max(b.Closed, b.exitTraded)
+	if open <= 1e-12 || b.flat {
+		if b.entryDone && !b.profitLive && !b.stopLive &&
+			b.Volume >= b.entryTraded-1e-12 && b.Closed >= b.exitTraded-1e-12 {
+			e.finish(b, expb.Status_ALL_TRADED, "")
+		}
+		return
+	}
+
+	switch {
+	case b.triggered:
+		if b.profitLive || b.stopLive {
+			return
+		}
+		e.sendStop(b, open)
+	case b.req.TakeProfit == 0:
+		return
+	case !b.profitLive:
+		e.sendProfit(b, open)
+	case b.Volume > b.profitTarget+1e-12:
+		b.resizing = true
+		e.engine.CancelOrder(b.TakeProfit)
+		return
+	default:
+		return
+	}
+	// 推送新的平仓委托编号
+	if _, ok := e.brackets[b.BracketID]; ok {
+		e.notify(b.BracketData)
+	}
+}
+
+// sendProfit 同步的事件引擎可能在 SendOrder 返回前推送回报，先记录挂单状态
+func (e *bracketEngine) sendProfit(b *bracket, volume float64) {
+	b.profitLive, b.profitVolume, b.profitTarget = true, volume, b.Volume
+	e.send(b, &b.TakeProfit, OrderRequest{
+		Direction:  b.Direction,
+		Price:      b.req.TakeProfit,
+		Volume:     volume,
+		ReduceOnly: b.req.ReduceOnly,
+	})
+}
+
+func (e *bracketEngine) sendStop(b *bracket, volume float64) {
+	b.stopLive, b.stopVolume = true, volume
+	e.send(b, &b.StopLoss, OrderRequest{
+		Direction:  b.Direction,
+		Volume:     volume,
+		Type:       MARKET,
+		ReduceOnly: b.req.ReduceOnly,
+	})
+}
+
+func (e *bracketEngine) finish(b *bracket, status expb.Status, reason string) {
+	if _, ok := e.brackets[b.BracketID]; !ok {
+		return
+	}
+	delete(e.brackets, b.BracketID)
+	if b.Entry != "" && !b.entryDone {
+		e.engine.CancelOrder(b.Entry)
+	}
+	if b.profitLive {
+		e.engine.CancelOrder(b.TakeProfit)
+	}
+	b.Status = status
+	if reason != "" {
+		b.Reference = reason
+		e.logger.Println("止盈止损委托结束:", b.BracketID, reason)
+	}
+	b.UpdatedAt = e.now()
+	e.notify(b.BracketData)
+}
+
+func (e *bracketEngine) onMarket(m algoMarket) {
+	ids := make([]string, 0, len(e.brackets))
+	for id := range e.brackets {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return lessNo(ids[i], ids[j]) })
+
+	for _, id := range ids {
+		b, ok := e.brackets[id]
+		if !ok || b.Status != expb.Status_PART_TRADED || b.req.StopLoss == 0 || b.triggered || b.Volume-b.Closed <= 1e-12 {
+			continue
+		}
+		// 止损单方向为空时保护多头持仓，最低价跌破止损价触发
+		if (b.Direction == expb.Direction_SHORT && m.low > b.req.StopLoss) ||
+			(b.Direction == expb.Direction_LONG && m.high < b.req.StopLoss) {
+			continue
+		}
+		b.triggered = true
+		if !b.entryDone {
+			e.engine.CancelOrder(b.Entry)
+		}
+		if !b.profitLive {
+			e.update(b)
+			continue
+		}
+		// 止盈单撤销后再发止损单，避免两边都成交
+		e.engine.CancelOrder(b.TakeProfit)
+	}
+}
+
+func (e *bracketEngine) onOrder(order OrderData) {
+	b, ok := e.orders[order.OrderNo]
+	if !ok && e.sending != nil {
+		b, ok = e.sending, true
+		e.orders[order.OrderNo] = b
+		*e.field = order.OrderNo
+	}
+	if !ok {
+		return
+	}
+	if _, running := e.brackets[b.BracketID]; !running {
+		return
+	}
+
+	switch order.Status {
+	case expb.Status_ALL_TRADED, expb.Status_CANCELLED, expb.Status_REJECTED:
+	default:
+		return
+	}
+
+	switch order.OrderNo {
+	case b.Entry:
+		b.entryDone = true
+		b.entryTraded = order.Traded
+		if order.Traded == 0 {
+			e.finish(b, expb.Status_CANCELLED, "入场委托未成交")
+			return
+		}
+	case b.TakeProfit:
+		b.profitLive = false
+		b.exitTraded += order.Traded
+		// 只减仓委托的数量可能被持仓截短，此时持仓已经平完
+		b.flat = order.Status == expb.Status_ALL_TRADED && order.Volume < b.profitVolume-1e-12
+		switch {
+		case b.resizing:
+			b.resizing = false
+		case order.Status != expb.Status_ALL_TRADED && !b.triggered:
+			e.finish(b, expb.Status_CANCELLED, "止盈委托已撤销: "+order.Reference)
+			return
+		}
+	case b.StopLoss:
+		b.stopLive = false
+		b.exitTraded += order.Traded
+		if order.Status != expb.Status_ALL_TRADED {
+			e.finish(b, expb.Status_CANCELLED, "止损委托未全部成交: "+order.Reference)
+			return
+		}
+		b.flat = order.Volume < b.stopVolume-1e-12
+	default:
+		return
+	}
+	e.update(b)
+}
+
+func (e *bracketEngine) onTrade(trade TradeData) {
+	b, ok := e.orders[trade.OrderNo]
+	if !ok {
+		return
+	}
+	if _, running := e.brackets[b.BracketID]; !running {
+		return
+	}
+
+	if trade.OrderNo == b.Entry {
+		e.protect(b, b.Volume+trade.Volume)
+		return
+	}
+
+	b.Closed += trade.Volume
+	b.UpdatedAt = e.now()
+	e.notify(b.BracketData)
+	e.update(b)
+}
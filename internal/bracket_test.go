@@ -0,0 +1,303 @@
+package internal
+
+import (
+	"log"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	expb "newgitlab.com/xquant/exchange-protocols/protocols/src/go"
+)
+
+func TestBracketRequestCheck(t *testing.T) {
+	entry := &OrderRequest{Direction: expb.Direction_LONG, Volume: 1, Type: MARKET}
+	valid := []BracketRequest{
+		{Entry: entry, TakeProfit: 110, StopLoss: 95},
+		{Entry: entry, StopLoss: 95},
+		{Direction: expb.Direction_LONG, Volume: 1, TakeProfit: 90, StopLoss: 105},
+	}
+	for _, req := range valid {
+		if err := req.Check(); err != nil {
+			t.Fatalf("%+v: %v", req, err)
+		}
+	}
+	invalid := []BracketRequest{
+		{Entry: entry},
+		{Entry: entry, TakeProfit: 95, StopLoss: 110},
+		{Direction: expb.Direction_SHORT, TakeProfit: 110},
+		{Entry: &OrderRequest{Direction: expb.Direction_LONG}, StopLoss: 95},
+	}
+	for _, req := range invalid {
+		if err := req.Check(); err == nil {
+			t.Fatalf("expect error: %+v", req)
+		}
+	}
+}
+
+type bracketTestStrategy struct {
+	StrategyTemplate
+	onBar    func(s *bracketTestStrategy, bar BarData)
+	bars     int
+	brackets []BracketData
+	orders   map[string]OrderData
+}
+
+func (s *bracketTestStrategy) OnBar(bar BarData) {
+	s.bars++
+	s.onBar(s, bar)
+}
+
+func (s *bracketTestStrategy) OnBracket(bracket BracketData) {
+	s.brackets = append(s.brackets, bracket)
+}
+
+func (s *bracketTestStrategy) OnOrder(order OrderData) {
+	s.orders[order.OrderNo] = order
+}
+
+func (s *bracketTestStrategy) last() BracketData {
+	return s.brackets[len(s.brackets)-1]
+}
+
+func runBracketTest(t *testing.T, bars []BarData, onBar func(s *bracketTestStrategy, bar BarData)) (*bracketTestStrategy, *BacktestResult) {
+	t.Helper()
+	start := bars[0].UpdatedAt.AsTime()
+	strategy := &bracketTestStrategy{onBar: onBar, orders: make(map[string]OrderData)}
+	result, err := Evaluate(EngineCfg{
+		Strategy:   strategy,
+		DataRepo:   &memoryRepo{bars: map[string][]BarData{"BTCUSDT": bars}},
+		Symbol:     "BTCUSDT",
+		Start:      start,
+		End:        start.Add(time.Duration(len(bars)) * time.Hour),
+		Interval:   time.Hour,
+		Capital:    10000,
+		Size:       1,
+		AnnualDays: 365,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strategy, result
+}
+
+func TestBacktestBracket(t *testing.T) {
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	sendBracket := func(s *bracketTestStrategy, bar BarData) {
+		if s.bars == 1 {
+			s.SendBracket(BracketRequest{
+				Entry:      &OrderRequest{Direction: expb.Direction_LONG, Volume: 1, Type: MARKET},
+				TakeProfit: 110,
+				StopLoss:   95,
+				ReduceOnly: true,
+			})
+		}
+	}
+
+	// 入场后止盈成交
+	strategy, result := runBracketTest(t, hourlyBars(start,
+		[4]float64{100, 100, 100, 100},
+		[4]float64{100, 102, 98, 101},
+		[4]float64{105, 111, 104, 108},
+		[4]float64{108, 108, 108, 108},
+	), sendBracket)
+	if trades := result.Trades; len(trades) != 2 || trades[0].Price != 100 || trades[1].Price != 110 || trades[1].Direction != expb.Direction_SHORT {
+		t.Fatalf("trades: %+v", trades)
+	}
+	last := strategy.last()
+	if last.Status != expb.Status_ALL_TRADED || last.Closed != 1 || last.StopLoss != "" || !last.UpdatedAt.Equal(start.Add(2*time.Hour)) {
+		t.Fatalf("bracket: %+v", last)
+	}
+
+	// 止损触发后撤销止盈单，在下一根K线开盘市价平仓
+	strategy, result = runBracketTest(t, hourlyBars(start,
+		[4]float64{100, 100, 100, 100},
+		[4]float64{100, 102, 98, 101},
+		[4]float64{99, 100, 94, 95},
+		[4]float64{93, 93, 93, 93},
+		[4]float64{93, 93, 93, 93},
+	), sendBracket)
+	if trades := result.Trades; len(trades) != 2 || trades[1].Price != 93 || trades[1].Direction != expb.Direction_SHORT {
+		t.Fatalf("trades: %+v", trades)
+	}
+	last = strategy.last()
+	if last.Status != expb.Status_ALL_TRADED || last.StopLoss == "" {
+		t.Fatalf("bracket: %+v", last)
+	}
+	if order := strategy.orders[last.TakeProfit]; order.Status != expb.Status_CANCELLED {
+		t.Fatalf("take profit: %+v", order)
+	}
+}
+
+func TestBacktestOCO(t *testing.T) {
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	bars := hourlyBars(start,
+		[4]float64{100, 100, 100, 100},
+		[4]float64{100, 100, 100, 100},
+		[4]float64{100, 112, 100, 111},
+		[4]float64{111, 111, 111, 111},
+		[4]float64{111, 111, 111, 111},
+	)
+
+	// 空头持仓的 OCO，止盈在低价，止损在高价
+	var entry string
+	strategy, result := runBracketTest(t, bars, func(s *bracketTestStrategy, bar BarData) {
+		switch s.bars {
+		case 1:
+			entry = s.SellMarket(1)
+		case 2:
+			s.SendBracket(BracketRequest{Direction: expb.Direction_LONG, Volume: 1, TakeProfit: 90, StopLoss: 110})
+		}
+	})
+	if strategy.orders[entry].Status != expb.Status_ALL_TRADED {
+		t.Fatalf("entry: %+v", strategy.orders[entry])
+	}
+	if trades := result.Trades; len(trades) != 2 || trades[1].Price != 111 || trades[1].Direction != expb.Direction_LONG {
+		t.Fatalf("trades: %+v", trades)
+	}
+	if last := strategy.last(); last.Status != expb.Status_ALL_TRADED {
+		t.Fatalf("bracket: %+v", last)
+	}
+
+	// 入场委托未成交时撤销委托组
+	var bracketID string
+	strategy, result = runBracketTest(t, bars, func(s *bracketTestStrategy, bar BarData) {
+		switch s.bars {
+		case 1:
+			bracketID = s.SendBracket(BracketRequest{Entry: &OrderRequest{Direction: expb.Direction_LONG, Price: 50, Volume: 1}, StopLoss: 40})
+		case 2:
+			s.CancelBracket(bracketID)
+		}
+	})
+	if last := strategy.last(); last.Status != expb.Status_CANCELLED || last.BracketID != bracketID {
+		t.Fatalf("bracket: %+v", last)
+	}
+	if len(result.Orders) != 1 || result.Orders[0].Status != expb.Status_CANCELLED {
+		t.Fatalf("orders: %+v", result.Orders)
+	}
+}
+
+type liveBracketTestStrategy struct {
+	StrategyTemplate
+	mu       sync.Mutex
+	bars     int
+	brackets []BracketData
+}
+
+func (s *liveBracketTestStrategy) OnBar(bar BarData) {
+	s.bars++
+	if s.bars == 1 {
+		s.SendBracket(BracketRequest{
+			Entry:      &OrderRequest{Direction: expb.Direction_LONG, Volume: 1, Type: MARKET},
+			TakeProfit: 105,
+			StopLoss:   95,
+			ReduceOnly: true,
+		})
+	}
+}
+
+func (s *liveBracketTestStrategy) OnBracket(bracket BracketData) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.brackets = append(s.brackets, bracket)
+}
+
+func TestLiveBracket(t *testing.T) {
+	market := new(fakeMarketGateway)
+	strategy := new(liveBracketTestStrategy)
+	engine, err := NewLiveEngine(LiveEngineCfg{
+		Strategy: strategy,
+		Gateway:  NewPaperGateway(market, 1000, 0, 1),
+		Symbol:   "BTCUSDT",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = engine.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	waiter := newEventWaiter(market.events)
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	prices := [][4]float64{{100, 100, 100, 100}, {100, 101, 99, 100}, {100, 106, 100, 104}}
+	for i, p := range prices {
+		market.events.Put(Event{Type: EventBar, Data: newTestBar("BTCUSDT", start.Add(time.Duration(i)*time.Minute), p[0], p[1], p[2], p[3])})
+		waiter.wait(t)
+	}
+	engine.Stop()
+
+	strategy.mu.Lock()
+	defer strategy.mu.Unlock()
+	last := strategy.brackets[len(strategy.brackets)-1]
+	if last.Status != expb.Status_ALL_TRADED || last.Closed != 1 || engine.Pos() != 0 {
+		t.Fatalf("bracket: %+v pos: %v", last, engine.Pos())
+	}
+}
+
+// bracketTestEngine 记录委托组发出的委托和撤单，回报由测试推送
+type bracketTestEngine struct {
+	CtaEngine
+	sent      []OrderRequest
+	cancelled []string
+}
+
+func (e *bracketTestEngine) SendOrder(req OrderRequest) string {
+	e.sent = append(e.sent, req)
+	return "o." + strconv.Itoa(len(e.sent))
+}
+
+func (e *bracketTestEngine) CancelOrder(orderNo string) {
+	e.cancelled = append(e.cancelled, orderNo)
+}
+
+func TestBracketPartialEntry(t *testing.T) {
+	engine := new(bracketTestEngine)
+	var last BracketData
+	brackets := newBracketEngine(engine, "BTCUSDT", func(b BracketData) { last = b }, log.Default(), time.Now)
+	brackets.sendBracket(BracketRequest{
+		Entry:      &OrderRequest{Direction: expb.Direction_LONG, Price: 100, Volume: 3},
+		TakeProfit: 110,
+		StopLoss:   95,
+	})
+	fill := func(orderNo string, status expb.Status, volume, traded, trade float64) {
+		brackets.onOrder(OrderData{OrderNo: orderNo, Status: status, Volume: volume, Traded: traded})
+		if trade > 0 {
+			brackets.onTrade(TradeData{OrderNo: orderNo, Volume: trade})
+		}
+	}
+
+	// 入场委托还在挂单，已成交的部分马上挂出止盈
+	fill("o.1", expb.Status_PART_TRADED, 3, 1, 1)
+	if len(engine.sent) != 2 || engine.sent[1].Direction != expb.Direction_SHORT || engine.sent[1].Volume != 1 || last.Volume != 1 {
+		t.Fatalf("sent: %+v bracket: %+v", engine.sent, last)
+	}
+	// 入场继续成交后撤销止盈单，按新的数量重挂
+	fill("o.1", expb.Status_PART_TRADED, 3, 2, 1)
+	if len(engine.cancelled) != 1 || engine.cancelled[0] != "o.2" {
+		t.Fatalf("cancelled: %v", engine.cancelled)
+	}
+	fill("o.2", expb.Status_CANCELLED, 1, 0, 0)
+	if len(engine.sent) != 3 || engine.sent[2].Volume != 2 || last.TakeProfit != "o.3" {
+		t.Fatalf("sent: %+v bracket: %+v", engine.sent, last)
+	}
+
+	// 止盈部分成交后止损对剩余的持仓仍然有效，触发后撤销入场和止盈
+	fill("o.3", expb.Status_PART_TRADED, 2, 1, 1)
+	brackets.onMarket(algoMarket{price: 94, high: 96, low: 94})
+	if len(engine.cancelled) != 3 || engine.cancelled[1] != "o.1" || engine.cancelled[2] != "o.3" {
+		t.Fatalf("cancelled: %v", engine.cancelled)
+	}
+	fill("o.3", expb.Status_CANCELLED, 2, 1, 0)
+	if len(engine.sent) != 4 || engine.sent[3].Type != MARKET || engine.sent[3].Volume != 1 || last.StopLoss != "o.4" {
+		t.Fatalf("sent: %+v bracket: %+v", engine.sent, last)
+	}
+
+	fill("o.1", expb.Status_CANCELLED, 3, 2, 0)
+	if last.Status != expb.Status_PART_TRADED {
+		t.Fatalf("bracket: %+v", last)
+	}
+	fill("o.4", expb.Status_ALL_TRADED, 1, 1, 1)
+	if last.Status != expb.Status_ALL_TRADED || last.Volume != 2 || last.Closed != 2 {
+		t.Fatalf("bracket: %+v", last)
+	}
+}
@@ -0,0 +1,329 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// CheckErrors 配置检查发现的所有错误
+type CheckErrors []error
+
+func (e CheckErrors) Error() string {
+	messages := make([]string, 0, len(e))
+	for _, err := range e {
+		messages = append(messages, err.Error())
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Err 没有错误时返回 nil，避免返回非空的空切片
+func (e CheckErrors) Err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+type DataConfig struct {
+	DSN string `yaml:"dsn" toml:"dsn" json:"dsn"`
+	// 设置后从 csv 目录读取行情，不使用数据库
+	Dir string `yaml:"dir" toml:"dir" json:"dir"`
+}
+
+// LatencySetting 延迟写成 time.ParseDuration 的格式，如 50ms，为空时不延迟
+type LatencySetting struct {
+	Submit     string `yaml:"submit" toml:"submit" json:"submit"`
+	Cancel     string `yaml:"cancel" toml:"cancel" json:"cancel"`
+	MarketData string `yaml:"market_data" toml:"market_data" json:"market_data"`
+	Jitter     string `yaml:"jitter" toml:"jitter" json:"jitter"`
+	Seed       int64  `yaml:"seed" toml:"seed" json:"seed"`
+}
+
+func (s LatencySetting) config() (LatencyConfig, error) {
+	var errs CheckErrors
+	cfg := LatencyConfig{Seed: s.Seed}
+	for _, field := range []struct {
+		name  string
+		value string
+		to    *time.Duration
+	}{
+		{"submit", s.Submit, &cfg.Submit},
+		{"cancel", s.Cancel, &cfg.Cancel},
+		{"market_data", s.MarketData, &cfg.MarketData},
+		{"jitter", s.Jitter, &cfg.Jitter},
+	} {
+		if field.value == "" {
+			continue
+		}
+		d, err := time.ParseDuration(field.value)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("latency.%s: 延迟格式错误: %s", field.name, field.value))
+			continue
+		}
+		*field.to = d
+	}
+	return cfg, errs.Err()
+}
+
+func latencySetting(cfg LatencyConfig) LatencySetting {
+	format := func(d time.Duration) string {
+		if d == 0 {
+			return ""
+		}
+		return d.String()
+	}
+	return LatencySetting{
+		Submit:     format(cfg.Submit),
+		Cancel:     format(cfg.Cancel),
+		MarketData: format(cfg.MarketData),
+		Jitter:     format(cfg.Jitter),
+		Seed:       cfg.Seed,
+	}
+}
+
+type StrategySetting struct {
+	Name   string             `yaml:"name" toml:"name" json:"name"`
+	Params map[string]float64 `yaml:"params" toml:"params" json:"params"`
+}
+
+type OutputConfig struct {
+	// 结果输出目录，为空时不写文件
+	Dir string `yaml:"dir" toml:"dir" json:"dir"`
+	// 成交、委托和逐日结果的导出格式: csv 或 jsonl
+	Format ExportFormat `yaml:"format" toml:"format" json:"format"`
+	// 结果库的 mysql 数据源，设置后保存回测记录
+	Database string `yaml:"database" toml:"database" json:"database"`
+}
+
+// BacktestConfig 回测配置文件，按扩展名读取 yaml、toml 或 json
+type BacktestConfig struct {
+	Data DataConfig `yaml:"data" toml:"data" json:"data"`
+
+	Symbol     string      `yaml:"symbol" toml:"symbol" json:"symbol"`
+	Exchange   Exchange    `yaml:"exchange" toml:"exchange" json:"exchange"`
+	Interval   string      `yaml:"interval" toml:"interval" json:"interval"`
+	Start      string      `yaml:"start" toml:"start" json:"start"`
+	End        string      `yaml:"end" toml:"end" json:"end"`
+	Capital    float64     `yaml:"capital" toml:"capital" json:"capital"`
+	Rate       *float64    `yaml:"rate" toml:"rate" json:"rate"`
+	Size       float64     `yaml:"size" toml:"size" json:"size"`
+	Slippage   float64     `yaml:"slippage" toml:"slippage" json:"slippage"`
+	Inverse    bool        `yaml:"inverse" toml:"inverse" json:"inverse"`
+	AnnualDays int         `yaml:"annual_days" toml:"annual_days" json:"annual_days"`
+	Mode       string      `yaml:"mode" toml:"mode" json:"mode"`
+	Spread     *SpreadData `yaml:"spread" toml:"spread" json:"spread"`
+	// 对比买入持有的基准合约，可以是 symbol 本身
+	Benchmark string     `yaml:"benchmark" toml:"benchmark" json:"benchmark"`
+	Risk      RiskConfig `yaml:"risk" toml:"risk" json:"risk"`
+	// tick 模式下按 L2 盘口撮合
+	OrderBook bool `yaml:"order_book" toml:"order_book" json:"order_book"`
+	// tick 模式下回放逐笔成交撮合挂单
+	MarketTrades bool `yaml:"market_trades" toml:"market_trades" json:"market_trades"`
+	// 委托、撤单和行情的模拟延迟
+	Latency LatencySetting `yaml:"latency" toml:"latency" json:"latency"`
+	// 合约规格，也可以写在 contracts 文件中按 symbol 和 exchange 查找
+	Contract  *ContractData `yaml:"contract" toml:"contract" json:"contract"`
+	Contracts string        `yaml:"contracts" toml:"contracts" json:"contracts"`
+
+	Strategy StrategySetting `yaml:"strategy" toml:"strategy" json:"strategy"`
+	Output   OutputConfig    `yaml:"output" toml:"output" json:"output"`
+}
+
+// DefaultBacktestConfig 配置文件中没有写的字段使用这些默认值
+func DefaultBacktestConfig() BacktestConfig {
+	return BacktestConfig{
+		Interval:   "1m",
+		Capital:    1000000,
+		AnnualDays: 365,
+		Mode:       "bar",
+		Output:     OutputConfig{Format: ExportCSV},
+	}
+}
+
+// LoadBacktestConfig 读取配置文件，文件中出现未知字段时报错
+func LoadBacktestConfig(path string) (*BacktestConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := DefaultBacktestConfig()
+	if err = decodeConfig(path, data, &cfg); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// decodeConfig 按扩展名解析 yaml、toml 或 json，出现未知字段时报错
+func decodeConfig(path string, data []byte, v any) error {
+	var err error
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		err = decoder.Decode(v)
+	case ".toml":
+		var meta toml.MetaData
+		meta, err = toml.Decode(string(data), v)
+		if err == nil && len(meta.Undecoded()) > 0 {
+			err = fmt.Errorf("未知字段: %v", meta.Undecoded())
+		}
+	case ".json":
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(v)
+	default:
+		return fmt.Errorf("不支持的配置文件格式: %s", ext)
+	}
+	if err != nil {
+		return fmt.Errorf("解析配置文件%s失败: %w", path, err)
+	}
+	return nil
+}
+
+// EngineCfg 生成引擎配置，策略从策略库按名称创建
+// 没有写 rate 时使用合约规格的费率，写了 rate（包括 0）时覆盖合约规格的费率
+// 解析错误和 EngineCfg.Check 的错误一起返回
+func (c BacktestConfig) EngineCfg() (EngineCfg, error) {
+	var errs CheckErrors
+	cfg := EngineCfg{
+		Symbol:       c.Symbol,
+		Exchange:     c.Exchange,
+		Capital:      c.Capital,
+		Size:         c.Size,
+		Slippage:     c.Slippage,
+		Inverse:      c.Inverse,
+		AnnualDays:   c.AnnualDays,
+		Spread:       c.Spread,
+		Benchmark:    c.Benchmark,
+		Risk:         c.Risk,
+		OrderBook:    c.OrderBook,
+		MarketTrades: c.MarketTrades,
+	}
+
+	var err error
+	if cfg.Interval, err = ParseInterval(c.Interval); err != nil {
+		errs = append(errs, fmt.Errorf("interval: %w", err))
+	}
+	if cfg.Latency, err = c.Latency.config(); err != nil {
+		errs = append(errs, err)
+	}
+	if c.Start != "" {
+		if cfg.Start, err = ParseDate(c.Start); err != nil {
+			errs = append(errs, fmt.Errorf("start: %w", err))
+		}
+	}
+	if c.End != "" {
+		if cfg.End, err = ParseDate(c.End); err != nil {
+			errs = append(errs, fmt.Errorf("end: %w", err))
+		}
+	}
+	contract := c.Contract
+	if contract == nil && c.Contracts != "" {
+		if registry, err := LoadContracts(c.Contracts); err != nil {
+			errs = append(errs, fmt.Errorf("contracts: %w", err))
+		} else if found, ok := registry.Get(c.Symbol, c.Exchange); ok {
+			contract = &found
+		} else {
+			errs = append(errs, fmt.Errorf("contracts: 找不到合约%s", c.Symbol))
+		}
+	}
+	if contract != nil {
+		cfg.SetContract(*contract)
+	}
+	if c.Rate != nil {
+		cfg.Rate = *c.Rate
+	}
+	if cfg.Size == 0 {
+		cfg.Size = 1
+	}
+
+	switch c.Mode {
+	case "bar", "":
+		cfg.BackTestingMod = BAR
+	case "tick":
+		cfg.BackTestingMod = TICK
+	default:
+		errs = append(errs, fmt.Errorf("mode: 不支持的回测模式: %s", c.Mode))
+	}
+
+	switch c.Output.Format {
+	case ExportCSV, ExportJSONL, "":
+	default:
+		errs = append(errs, fmt.Errorf("output.format: 不支持的导出格式: %s", c.Output.Format))
+	}
+
+	switch {
+	case c.Data.Dir != "":
+		if repo, err := NewFileData(c.Data.Dir); err != nil {
+			errs = append(errs, fmt.Errorf("data.dir: %w", err))
+		} else {
+			cfg.DataRepo = repo
+		}
+	case c.Data.DSN != "":
+		if repo, err := NewDataWithDSN(c.Data.DSN); err != nil {
+			errs = append(errs, fmt.Errorf("data.dsn: %w", err))
+		} else {
+			cfg.DataRepo = repo
+		}
+	default:
+		errs = append(errs, errors.New("data.dsn和data.dir不能同时为空"))
+	}
+
+	if c.Strategy.Name == "" {
+		errs = append(errs, errors.New("strategy.name不能为空"))
+	} else if info, err := LookupStrategy(c.Strategy.Name); err != nil {
+		errs = append(errs, fmt.Errorf("strategy.name: %w", err))
+	} else if cfg.Strategy, err = info.New(c.Strategy.Params); err != nil {
+		errs = append(errs, fmt.Errorf("strategy.params: %w", err))
+	}
+
+	if err = cfg.Check(); err != nil {
+		for _, checkErr := range err.(CheckErrors) {
+			// 上面已经报告过原因
+			if checkErr == errNoStrategy || checkErr == errNoDataRepo {
+				continue
+			}
+			errs = append(errs, checkErr)
+		}
+	}
+
+	return cfg, errs.Err()
+}
+
+// ParseInterval 支持 1m、4h、1d 以及 time.ParseDuration 的格式
+func ParseInterval(s string) (time.Duration, error) {
+	if strings.HasSuffix(s, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(s, "d"))
+		if err != nil {
+			return 0, fmt.Errorf("K线周期错误: %s", s)
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+	interval, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("K线周期错误: %s", s)
+	}
+	return interval, nil
+}
+
+// ParseDate 支持 2006-01-02（本地时间）和 RFC3339 格式
+func ParseDate(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, errors.New("日期不能为空")
+	}
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
@@ -0,0 +1,155 @@
+package internal
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testConfigs = map[string]string{
+	"backtest.yaml": `
+data:
+  dir: %DIR%
+symbol: BTCUSDT
+interval: 1h
+start: 2022-01-01
+end: 2022-02-01
+rate: 0.0004
+strategy:
+  name: config_test
+  params:
+    window: 20
+output:
+  dir: out
+`,
+	"backtest.toml": `
+symbol = "BTCUSDT"
+interval = "1h"
+start = "2022-01-01"
+end = "2022-02-01"
+rate = 0.0004
+
+[data]
+dir = "%DIR%"
+
+[strategy]
+name = "config_test"
+params = { window = 20 }
+
+[output]
+dir = "out"
+`,
+	"backtest.json": `{
+  "data": {"dir": "%DIR%"},
+  "symbol": "BTCUSDT",
+  "interval": "1h",
+  "start": "2022-01-01",
+  "end": "2022-02-01",
+  "rate": 0.0004,
+  "strategy": {"name": "config_test", "params": {"window": 20}},
+  "output": {"dir": "out"}
+}`,
+}
+
+// configTestParams 记录 config_test 策略最近一次收到的参数
+var configTestParams map[string]float64
+
+func init() {
+	RegisterStrategy(StrategyInfo{
+		Name:   "config_test",
+		Params: []StrategyParam{{Name: "window", Default: 10}, {Name: "dev", Default: 2}},
+		Factory: func(params map[string]float64) (Strategy, error) {
+			configTestParams = params
+			return new(backtestTestStrategy), nil
+		},
+	})
+}
+
+func writeTestConfig(t *testing.T, name, content string) string {
+	dir := t.TempDir()
+	path := filepath.Join(dir, name)
+	content = strings.ReplaceAll(content, "%DIR%", filepath.ToSlash(dir))
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadBacktestConfig(t *testing.T) {
+	for name, content := range testConfigs {
+		c, err := LoadBacktestConfig(writeTestConfig(t, name, content))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		cfg, err := c.EngineCfg()
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		if cfg.Symbol != "BTCUSDT" || cfg.Interval != time.Hour || cfg.Rate != 0.0004 || cfg.BackTestingMod != BAR {
+			t.Fatalf("%s: %+v", name, cfg)
+		}
+		// 没有写的字段使用默认值
+		if cfg.Capital != 1000000 || cfg.Size != 1 || cfg.AnnualDays != 365 {
+			t.Fatalf("%s: %+v", name, cfg)
+		}
+		// 没有写的策略参数使用注册时的默认值
+		params := configTestParams
+		if !cfg.End.After(cfg.Start) || cfg.Strategy == nil || params["window"] != 20 || params["dev"] != 2 || c.Output.Dir != "out" {
+			t.Fatalf("%s: %+v %v", name, cfg, params)
+		}
+	}
+}
+
+func TestLoadBacktestConfigUnknownField(t *testing.T) {
+	if _, err := LoadBacktestConfig(writeTestConfig(t, "backtest.yaml", "symbl: BTCUSDT\n")); err == nil {
+		t.Fatal("expected error")
+	}
+	if _, err := LoadBacktestConfig(writeTestConfig(t, "backtest.ini", "")); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestBacktestConfigErrors(t *testing.T) {
+	c := DefaultBacktestConfig()
+	c.Interval = "1x"
+	c.Start = "2022-02-01"
+	c.End = "2022-01-01"
+	rate := -1.0
+	c.Rate = &rate
+	c.Mode = "minute"
+	c.Strategy.Name = "unknown"
+
+	_, err := c.EngineCfg()
+	var errs CheckErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("expected CheckErrors, got %v", err)
+	}
+	// interval、mode、data、strategy、symbol、end、rate，以及 interval 为 0 导致的 bar 模式检查
+	if len(errs) != 8 {
+		t.Fatalf("errors: %v", err)
+	}
+}
+
+func TestParseInterval(t *testing.T) {
+	cases := map[string]time.Duration{
+		"1m":  time.Minute,
+		"4h":  4 * time.Hour,
+		"1d":  24 * time.Hour,
+		"30s": 30 * time.Second,
+	}
+	for s, want := range cases {
+		got, err := ParseInterval(s)
+		if err != nil || got != want {
+			t.Fatalf("%s: %v %v", s, got, err)
+		}
+	}
+	for _, s := range []string{"xd", "1x", ""} {
+		if _, err := ParseInterval(s); err == nil {
+			t.Fatalf("%q: expected error", s)
+		}
+	}
+}
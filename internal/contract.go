@@ -0,0 +1,206 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ContractData 合约规格，为 0 的字段不限制
+type ContractData struct {
+	Symbol   string   `yaml:"symbol" toml:"symbol" json:"symbol"`
+	Exchange Exchange `yaml:"exchange" toml:"exchange" json:"exchange"`
+	// 最小变动价位和数量步长，委托价取最近的价位，数量向下取整
+	PriceTick  float64 `yaml:"price_tick" toml:"price_tick" json:"price_tick"`
+	VolumeStep float64 `yaml:"volume_step" toml:"volume_step" json:"volume_step"`
+	// 最小下单金额，只减仓委托不检查
+	MinNotional float64 `yaml:"min_notional" toml:"min_notional" json:"min_notional"`
+	// 合约乘数、是否反向合约和手续费率
+	Size    float64 `yaml:"size" toml:"size" json:"size"`
+	Inverse bool    `yaml:"inverse" toml:"inverse" json:"inverse"`
+	Rate    float64 `yaml:"rate" toml:"rate" json:"rate"`
+	// 各费率档位的手续费率，键为档位名称，选中档位后覆盖 Rate，见 ContractRegistry.SetFeeTier
+	FeeTiers map[string]float64 `yaml:"fee_tiers" toml:"fee_tiers" json:"fee_tiers"`
+}
+
+func (c ContractData) Check() error {
+	var errs CheckErrors
+	if c.Symbol == "" {
+		errs = append(errs, errors.New("contract.symbol不能为空"))
+	}
+	if c.PriceTick < 0 {
+		errs = append(errs, errors.New("contract.price_tick不能为负数"))
+	}
+	if c.VolumeStep < 0 {
+		errs = append(errs, errors.New("contract.volume_step不能为负数"))
+	}
+	if c.MinNotional < 0 {
+		errs = append(errs, errors.New("contract.min_notional不能为负数"))
+	}
+	if c.Size < 0 {
+		errs = append(errs, errors.New("contract.size不能为负数"))
+	}
+	if c.Rate < 0 {
+		errs = append(errs, errors.New("contract.rate不能为负数"))
+	}
+	var negative []string
+	for tier, rate := range c.FeeTiers {
+		if rate < 0 {
+			negative = append(negative, tier)
+		}
+	}
+	sort.Strings(negative)
+	for _, tier := range negative {
+		errs = append(errs, fmt.Errorf("contract.fee_tiers.%s不能为负数", tier))
+	}
+	return errs.Err()
+}
+
+// normalize 按合约规格取整委托价和数量，并检查最小下单金额
+// price 为最新价，用于估算市价单的金额，为 0 时不检查市价单
+func (c *ContractData) normalize(req OrderRequest, price float64) (OrderRequest, error) {
+	if c == nil {
+		return req, nil
+	}
+	if c.PriceTick > 0 && req.Type != MARKET {
+		req.Price = roundStep(req.Price, c.PriceTick, math.Round)
+	}
+	if c.VolumeStep > 0 {
+		if req.Volume = roundStep(req.Volume, c.VolumeStep, math.Floor); req.Volume <= 0 {
+			return req, fmt.Errorf("委托数量小于数量步长%v", c.VolumeStep)
+		}
+	}
+	if c.MinNotional > 0 && !req.ReduceOnly {
+		if req.Type != MARKET {
+			price = req.Price
+		}
+		if notional := c.notional(price, req.Volume); price > 0 && notional < c.MinNotional {
+			return req, fmt.Errorf("委托金额%v小于最小下单金额%v", notional, c.MinNotional)
+		}
+	}
+	return req, nil
+}
+
+// notional 委托金额，反向合约按面值计算
+func (c *ContractData) notional(price, volume float64) float64 {
+	size := c.Size
+	if size == 0 {
+		size = 1
+	}
+	if c.Inverse {
+		return volume * size
+	}
+	return price * volume * size
+}
+
+// roundStep 把 value 取整到 step 的整数倍，结果保留 step 的小数位数，避免浮点误差
+func roundStep(value, step float64, round func(float64) float64) float64 {
+	n := round(value/step + 1e-9)
+	decimals := 0
+	if s := strconv.FormatFloat(step, 'f', -1, 64); strings.Contains(s, ".") {
+		decimals = len(s) - strings.Index(s, ".") - 1
+	}
+	pow := math.Pow10(decimals)
+	return math.Round(n*step*pow) / pow
+}
+
+type contractKey struct {
+	symbol   string
+	exchange Exchange
+}
+
+// ContractRegistry 按合约代码和交易所查找合约规格
+type ContractRegistry struct {
+	contracts map[contractKey]ContractData
+}
+
+// NewContractRegistry 检查每个合约规格，合约重复时报错
+func NewContractRegistry(contracts []ContractData) (*ContractRegistry, error) {
+	var errs CheckErrors
+	r := &ContractRegistry{contracts: make(map[contractKey]ContractData, len(contracts))}
+	for _, contract := range contracts {
+		if err := contract.Check(); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		key := contractKey{contract.Symbol, contract.Exchange}
+		if _, ok := r.contracts[key]; ok {
+			errs = append(errs, fmt.Errorf("合约重复: %s", contract.Symbol))
+			continue
+		}
+		r.contracts[key] = contract
+	}
+	if err := errs.Err(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// SetFeeTier 按账户所在的费率档位设置各合约的 Rate
+// 没有设置 FeeTiers 的合约保持 Rate 不变，设置了 FeeTiers 但没有该档位的合约报错
+func (r *ContractRegistry) SetFeeTier(tier string) error {
+	var errs CheckErrors
+	for key, contract := range r.contracts {
+		if len(contract.FeeTiers) == 0 {
+			continue
+		}
+		rate, ok := contract.FeeTiers[tier]
+		if !ok {
+			errs = append(errs, fmt.Errorf("合约%s没有费率档位%s", contract.Symbol, tier))
+			continue
+		}
+		contract.Rate = rate
+		r.contracts[key] = contract
+	}
+	return errs.Err()
+}
+
+// LoadContracts 读取合约规格文件，按扩展名读取 yaml、toml 或 json，合约列在 contracts 下
+// fee_tier 为账户的费率档位，设置后各合约按 fee_tiers 中该档位的费率收取手续费
+func LoadContracts(path string) (*ContractRegistry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file struct {
+		FeeTier   string         `yaml:"fee_tier" toml:"fee_tier" json:"fee_tier"`
+		Contracts []ContractData `yaml:"contracts" toml:"contracts" json:"contracts"`
+	}
+	if err = decodeConfig(path, data, &file); err != nil {
+		return nil, err
+	}
+	registry, err := NewContractRegistry(file.Contracts)
+	if err != nil {
+		return nil, err
+	}
+	if file.FeeTier != "" {
+		if err = registry.SetFeeTier(file.FeeTier); err != nil {
+			return nil, err
+		}
+	}
+	return registry, nil
+}
+
+func (r *ContractRegistry) Get(symbol string, exchange Exchange) (ContractData, bool) {
+	contract, ok := r.contracts[contractKey{symbol, exchange}]
+	return contract, ok
+}
+
+// SetContract 设置合约规格，Size 为 0 时使用合约规格的值，合约规格为反向合约时设置 Inverse
+// 合约规格设置了费率时使用合约规格的费率，需要另外指定费率（包括 0）时在之后设置 Rate
+func (c *EngineCfg) SetContract(contract ContractData) {
+	c.Contract = &contract
+	if c.Size == 0 {
+		c.Size = contract.Size
+	}
+	if contract.Rate > 0 {
+		c.Rate = contract.Rate
+	}
+	if contract.Inverse {
+		c.Inverse = true
+	}
+}
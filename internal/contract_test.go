@@ -0,0 +1,240 @@
+package internal
+
+import (
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	expb "newgitlab.com/xquant/exchange-protocols/protocols/src/go"
+)
+
+func TestContractNormalize(t *testing.T) {
+	c := &ContractData{Symbol: "BTCUSDT", PriceTick: 0.1, VolumeStep: 0.001, MinNotional: 5}
+
+	req, err := c.normalize(OrderRequest{Price: 20000.06, Volume: 0.0019}, 0)
+	if err != nil || req.Price != 20000.1 || req.Volume != 0.001 {
+		t.Fatalf("%+v %v", req, err)
+	}
+	if _, err = c.normalize(OrderRequest{Price: 20000, Volume: 0.0009}, 0); err == nil {
+		t.Fatal("volume below step")
+	}
+	if _, err = c.normalize(OrderRequest{Price: 1000, Volume: 0.001}, 0); err == nil {
+		t.Fatal("notional below min")
+	}
+	if _, err = c.normalize(OrderRequest{Price: 1000, Volume: 0.001, ReduceOnly: true}, 0); err != nil {
+		t.Fatal(err)
+	}
+	// 市价单按最新价估算金额
+	if _, err = c.normalize(OrderRequest{Type: MARKET, Volume: 0.001}, 1000); err == nil {
+		t.Fatal("market notional below min")
+	}
+	if _, err = c.normalize(OrderRequest{Type: MARKET, Volume: 0.001}, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	// 反向合约按面值计算金额
+	inverse := &ContractData{Symbol: "BTCUSD", Size: 100, Inverse: true, MinNotional: 100}
+	if _, err = inverse.normalize(OrderRequest{Price: 20000, Volume: 1}, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	var none *ContractData
+	if req, _ = none.normalize(OrderRequest{Price: 1.23456, Volume: 0.1}, 0); req.Price != 1.23456 {
+		t.Fatalf("%+v", req)
+	}
+	if v := roundStep(0.1+0.2, 0.1, math.Floor); v != 0.3 {
+		t.Fatalf("round step: %v", v)
+	}
+}
+
+func TestLoadContracts(t *testing.T) {
+	path := writeTestConfig(t, "contracts.yaml", `
+contracts:
+  - symbol: BTCUSDT
+    price_tick: 0.1
+    volume_step: 0.001
+    min_notional: 5
+    rate: 0.0004
+  - symbol: BTCUSD
+    size: 100
+    inverse: true
+`)
+	registry, err := LoadContracts(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c, ok := registry.Get("BTCUSDT", 0); !ok || c.PriceTick != 0.1 || c.MinNotional != 5 {
+		t.Fatalf("%+v", c)
+	}
+	if _, ok := registry.Get("ETHUSDT", 0); ok {
+		t.Fatal("unknown contract")
+	}
+
+	if _, err = NewContractRegistry([]ContractData{{Symbol: "BTCUSDT"}, {Symbol: "BTCUSDT"}}); err == nil {
+		t.Fatal("duplicate contract")
+	}
+
+	// 配置文件按 symbol 查找合约规格，补齐乘数、费率和反向合约
+	config := writeTestConfig(t, "backtest.yaml", `
+data:
+  dir: %DIR%
+symbol: BTCUSD
+interval: 1h
+start: 2022-01-01
+contracts: %DIR%/contracts.yaml
+strategy:
+  name: config_test
+`)
+	data, _ := os.ReadFile(path)
+	if err = os.WriteFile(filepath.Join(filepath.Dir(config), "contracts.yaml"), data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	c, err := LoadBacktestConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := c.EngineCfg()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Size != 100 || !cfg.Inverse || cfg.Contract == nil || cfg.Contract.Symbol != "BTCUSD" {
+		t.Fatalf("%+v", cfg)
+	}
+
+	c.Symbol = "ETHUSDT"
+	if _, err = c.EngineCfg(); err == nil {
+		t.Fatal("missing contract")
+	}
+}
+
+func TestContractFeeTier(t *testing.T) {
+	path := writeTestConfig(t, "contracts.yaml", `
+fee_tier: vip1
+contracts:
+  - symbol: BTCUSDT
+    rate: 0.0005
+    fee_tiers:
+      vip0: 0.0004
+      vip1: 0.00036
+  - symbol: ETHUSDT
+    rate: 0.0004
+`)
+	registry, err := LoadContracts(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c, _ := registry.Get("BTCUSDT", 0); c.Rate != 0.00036 {
+		t.Fatalf("btc rate: %v", c.Rate)
+	}
+	// 没有档位费率的合约保留 rate
+	if c, _ := registry.Get("ETHUSDT", 0); c.Rate != 0.0004 {
+		t.Fatalf("eth rate: %v", c.Rate)
+	}
+	if err = registry.SetFeeTier("vip9"); err == nil || !strings.Contains(err.Error(), "vip9") {
+		t.Fatalf("unknown tier: %v", err)
+	}
+	if err = (ContractData{Symbol: "BTCUSDT", FeeTiers: map[string]float64{"vip0": -1}}).Check(); err == nil {
+		t.Fatal("negative tier rate")
+	}
+}
+
+// 没有写 rate 时使用合约规格的费率，写了 rate 时即使为 0 也覆盖合约规格
+func TestContractRate(t *testing.T) {
+	path := writeTestConfig(t, "contracts.yaml", `
+contracts:
+  - symbol: BTCUSDT
+    rate: 0.0004
+`)
+	zero := 0.0
+	for _, want := range []*float64{nil, &zero} {
+		c := DefaultBacktestConfig()
+		c.Data.Dir = t.TempDir()
+		c.Symbol = "BTCUSDT"
+		c.Start = "2022-01-01"
+		c.Contracts = path
+		c.Rate = want
+		c.Strategy.Name = "config_test"
+		cfg, err := c.EngineCfg()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (want == nil && cfg.Rate != 0.0004) || (want != nil && cfg.Rate != *want) {
+			t.Fatalf("rate %v: %v", want, cfg.Rate)
+		}
+	}
+
+	// 合约规格没有费率时保留已设置的费率
+	cfg := EngineCfg{Symbol: "BTCUSDT", Rate: 0.001}
+	cfg.SetContract(ContractData{Symbol: "BTCUSDT"})
+	if cfg.Rate != 0.001 {
+		t.Fatalf("rate: %v", cfg.Rate)
+	}
+}
+
+// 直接写在配置中的合约规格要和回测合约一致
+func TestContractMismatch(t *testing.T) {
+	for _, contract := range []ContractData{{Symbol: "ETHUSDT"}, {Symbol: "BTCUSDT", Exchange: 1}} {
+		c := DefaultBacktestConfig()
+		c.Data.Dir = t.TempDir()
+		c.Symbol = "BTCUSDT"
+		c.Start = "2022-01-01"
+		c.Contract = &contract
+		c.Strategy.Name = "config_test"
+
+		_, err := c.EngineCfg()
+		var errs CheckErrors
+		if !errors.As(err, &errs) || len(errs) != 1 || !strings.Contains(errs[0].Error(), "不一致") {
+			t.Fatalf("%+v: %v", contract, err)
+		}
+	}
+}
+
+func TestBacktestContract(t *testing.T) {
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	bars := hourlyBars(start,
+		[4]float64{100, 100, 100, 100},
+		[4]float64{100, 101, 99, 100},
+		[4]float64{100, 100, 100, 100},
+	)
+
+	var rounded, small string
+	strategy := &orderTypeTestStrategy{orders: make(map[string]OrderData), onBar: func(s *orderTypeTestStrategy, bar BarData) {
+		if s.bars == 1 {
+			rounded = s.Buy(100.04, 1.2345)
+			small = s.Buy(100, 0.04)
+		}
+	}}
+	cfg := EngineCfg{
+		Strategy:   strategy,
+		DataRepo:   &memoryRepo{bars: map[string][]BarData{"BTCUSDT": bars}},
+		Symbol:     "BTCUSDT",
+		Start:      start,
+		End:        start.Add(3 * time.Hour),
+		Interval:   time.Hour,
+		Capital:    10000,
+		AnnualDays: 365,
+	}
+	cfg.SetContract(ContractData{Symbol: "BTCUSDT", PriceTick: 0.1, VolumeStep: 0.01, MinNotional: 50, Size: 10})
+	if cfg.Size != 10 {
+		t.Fatalf("size: %v", cfg.Size)
+	}
+	result, err := Evaluate(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if order := strategy.orders[rounded]; order.Price != 100 || order.Volume != 1.23 || order.Status != expb.Status_ALL_TRADED {
+		t.Fatalf("rounded: %+v", order)
+	}
+	// 金额 100*0.04*10 低于最小下单金额
+	if order := strategy.orders[small]; order.Status != expb.Status_REJECTED {
+		t.Fatalf("small: %+v", order)
+	}
+	if len(result.Trades) != 1 {
+		t.Fatalf("trades: %+v", result.Trades)
+	}
+}
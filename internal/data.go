@@ -2,9 +2,13 @@ package internal
 
 import (
 	"container/list"
+	"fmt"
 	"google.golang.org/protobuf/types/known/timestamppb"
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"regexp"
+	"strings"
 	"time"
 )
 
@@ -13,19 +17,105 @@ type Data struct {
 }
 
 func NewData() DataRepo {
-	db, err := gorm.Open(mysql.Open("xg:xg1234@tcp(10.8.0.121:3306)/binance_data?charset=utf8mb4&parseTime=True&loc=Local"))
+	data, err := NewDataWithDSN("xg:xg1234@tcp(10.8.0.121:3306)/binance_data?charset=utf8mb4&parseTime=True&loc=Local")
 	if err != nil {
 		panic(err)
 	}
 
-	return &Data{db}
+	return data
+}
+
+func NewDataWithDSN(dsn string) (*Data, error) {
+	db, err := gorm.Open(mysql.Open(dsn))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Data{db}, nil
 }
 
 type LoadFunc func(string, Exchange, time.Duration, time.Time, time.Time) (*list.List, error)
 
+// DataSaver 行情写入，FileData 同一合约同一时间的数据只保留第一条，Data 只在表上有 (symbol, datetime) 唯一索引时去重
+type DataSaver interface {
+	SaveBarData(interval time.Duration, bars []BarData) error
+	SaveTickData(ticks []TickData) error
+}
+
+// intervalName K线周期在表名和文件名中的写法，只支持整数分钟
+func intervalName(interval time.Duration) (string, error) {
+	switch {
+	case interval >= 24*time.Hour && interval%(24*time.Hour) == 0:
+		return fmt.Sprintf("%dd", interval/(24*time.Hour)), nil
+	case interval >= time.Hour && interval%time.Hour == 0:
+		return fmt.Sprintf("%dh", interval/time.Hour), nil
+	case interval >= time.Minute && interval%time.Minute == 0:
+		return fmt.Sprintf("%dm", interval/time.Minute), nil
+	default:
+		return "", fmt.Errorf("不支持的K线周期%v，必须是整数分钟", interval)
+	}
+}
+
+var symbolPattern = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+// tableSymbol 合约代码转成表名和文件名中的写法，只允许字母、数字和下划线，避免拼接出非法的表名或路径
+func tableSymbol(symbol string) (string, error) {
+	name := strings.ToLower(symbol)
+	if !symbolPattern.MatchString(name) {
+		return "", fmt.Errorf("合约代码%q只能包含字母、数字和下划线", symbol)
+	}
+	return name, nil
+}
+
+func barTable(symbol string, interval time.Duration) (string, error) {
+	name, err := tableSymbol(symbol)
+	if err != nil {
+		return "", err
+	}
+	period, err := intervalName(interval)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("bars_%s_%s", name, period), nil
+}
+
+func tickTable(symbol string) (string, error) {
+	name, err := tableSymbol(symbol)
+	if err != nil {
+		return "", err
+	}
+	return "ticks_" + name, nil
+}
+
 func (d *Data) GetBarData(symbol string, _ Exchange, interval time.Duration, start, end time.Time) (*list.List, error) {
+	// 没有指定合约时和原来一样读取 BTCUSDT 日线
+	if symbol == "" {
+		symbol, interval = "BTCUSDT", 24*time.Hour
+	}
+	table, err := barTable(symbol, interval)
+	if err != nil {
+		return nil, err
+	}
 	var raw []dbBarData
-	err := d.db.Raw("select * from bars_btcusdt_1d where datetime between ? and ?;", start, end).Scan(&raw).Error
+	err = d.db.Table(table).Where("datetime between ? and ?", start, end).Order("datetime").Find(&raw).Error
+	if err != nil {
+		return nil, err
+	}
+
+	list := list.New()
+	for i := 0; i < len(raw); i++ {
+		list.PushBack(raw[i].ToPb())
+	}
+	return list, nil
+}
+
+func (d *Data) GetTickData(symbol string, _ Exchange, _ time.Duration, start, end time.Time) (*list.List, error) {
+	table, err := tickTable(symbol)
+	if err != nil {
+		return nil, err
+	}
+	var raw []dbTickData
+	err = d.db.Table(table).Where("datetime between ? and ?", start, end).Order("datetime").Find(&raw).Error
 	if err != nil {
 		return nil, err
 	}
@@ -37,8 +127,38 @@ func (d *Data) GetBarData(symbol string, _ Exchange, interval time.Duration, sta
 	return list, nil
 }
 
-func (d *Data) GetTickData(symbol string, exchange Exchange, interval time.Duration, start, end time.Time) (*list.List, error) {
-	panic("implement me")
+// SaveBarData 依赖表上 (symbol, datetime) 的唯一索引去重，没有索引时由调用方保证不重复写入
+func (d *Data) SaveBarData(interval time.Duration, bars []BarData) error {
+	if len(bars) == 0 {
+		return nil
+	}
+	table, err := barTable(bars[0].Symbol, interval)
+	if err != nil {
+		return err
+	}
+	period, _ := intervalName(interval)
+	raw := make([]dbBarData, 0, len(bars))
+	for _, bar := range bars {
+		row := newDbBarData(bar)
+		row.Interval = period
+		raw = append(raw, row)
+	}
+	return d.db.Table(table).Clauses(clause.OnConflict{DoNothing: true}).Create(&raw).Error
+}
+
+func (d *Data) SaveTickData(ticks []TickData) error {
+	if len(ticks) == 0 {
+		return nil
+	}
+	table, err := tickTable(ticks[0].Symbol)
+	if err != nil {
+		return err
+	}
+	raw := make([]dbTickData, 0, len(ticks))
+	for _, tick := range ticks {
+		raw = append(raw, newDbTickData(tick))
+	}
+	return d.db.Table(table).Clauses(clause.OnConflict{DoNothing: true}).Create(&raw).Error
 }
 
 type dbBarData struct {
@@ -70,3 +190,61 @@ func (d dbBarData) ToPb() BarData {
 		//Interval:     d.Interval,
 	}
 }
+
+func newDbBarData(bar BarData) dbBarData {
+	return dbBarData{
+		Symbol:       bar.Symbol,
+		Datetime:     bar.UpdatedAt.AsTime(),
+		Volume:       bar.Volume,
+		Turnover:     bar.Turnover,
+		OpenInterest: bar.OpenInterest,
+		OpenPrice:    bar.OpenPrice,
+		HighPrice:    bar.HighPrice,
+		LowPrice:     bar.LowPrice,
+		ClosePrice:   bar.ClosePrice,
+	}
+}
+
+type dbTickData struct {
+	Symbol       string
+	Exchange     string
+	Datetime     time.Time
+	Volume       float64
+	Turnover     float64
+	OpenInterest float64
+	LastPrice    float64
+	BidPrice1    float64
+	AskPrice1    float64
+	BidVolume1   float64
+	AskVolume1   float64
+}
+
+func newDbTickData(tick TickData) dbTickData {
+	return dbTickData{
+		Symbol:       tick.Symbol,
+		Datetime:     tick.UpdatedAt.AsTime(),
+		Volume:       tick.Volume,
+		Turnover:     tick.Turnover,
+		OpenInterest: tick.OpenInterest,
+		LastPrice:    tick.LastPrice,
+		BidPrice1:    tick.BidPrice_1,
+		AskPrice1:    tick.AskPrice_1,
+		BidVolume1:   tick.BidVolume_1,
+		AskVolume1:   tick.AskVolume_1,
+	}
+}
+
+func (d dbTickData) ToPb() TickData {
+	return TickData{
+		Symbol:       d.Symbol,
+		UpdatedAt:    timestamppb.New(d.Datetime),
+		Volume:       d.Volume,
+		Turnover:     d.Turnover,
+		OpenInterest: d.OpenInterest,
+		LastPrice:    d.LastPrice,
+		BidPrice_1:   d.BidPrice1,
+		AskPrice_1:   d.AskPrice1,
+		BidVolume_1:  d.BidVolume1,
+		AskVolume_1:  d.AskVolume1,
+	}
+}
@@ -18,3 +18,22 @@ func TestNewData(t *testing.T) {
 		fmt.Printf("%+v\n", bar.UpdatedAt.AsTime().String())
 	}
 }
+
+func TestTableName(t *testing.T) {
+	if table, err := barTable("BTCUSDT", time.Hour); err != nil || table != "bars_btcusdt_1h" {
+		t.Fatalf("%s %v", table, err)
+	}
+	for _, symbol := range []string{"", "BTC-USDT", "a;b", "../btc", "btc usdt"} {
+		if _, err := tickTable(symbol); err == nil {
+			t.Fatalf("%q: expect error", symbol)
+		}
+	}
+
+	repo, err := NewFileData(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = repo.GetBarData("../btcusdt", 0, time.Hour, time.Time{}, time.Now()); err == nil {
+		t.Fatal("expect error")
+	}
+}
@@ -0,0 +1,262 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+type EventType int
+
+const (
+	EventTick = EventType(iota)
+	EventBar
+	EventOrder
+	EventTrade
+	EventPosition
+	EventTimer
+	EventLog
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventTick:
+		return "eTick"
+	case EventBar:
+		return "eBar"
+	case EventOrder:
+		return "eOrder"
+	case EventTrade:
+		return "eTrade"
+	case EventPosition:
+		return "ePosition"
+	case EventTimer:
+		return "eTimer"
+	case EventLog:
+		return "eLog"
+	default:
+		return "eUnknown"
+	}
+}
+
+// Event 的 Data 按类型分别为 BarData、TickData、OrderData、TradeData、float64(仓位变化)、time.Time、string
+type Event struct {
+	Type EventType
+	Data any
+}
+
+type EventHandler func(event Event)
+
+// EventEngine 事件分发
+// 未启动时 Put 同步调用处理函数，用于回测；Start 之后事件进入队列由单独的协程处理，并按间隔产生 EventTimer，用于实盘
+// 队列不限长度，处理函数中再 Put 事件不会因为队列满而阻塞唯一的处理协程
+type EventEngine struct {
+	mu       sync.RWMutex
+	handlers map[EventType][]EventHandler
+	general  []EventHandler
+
+	interval time.Duration
+	// queue 和 active 由 mu 保护，入队和停止不会交错，Stop 之前入队的事件都会被处理
+	queue  []Event
+	notify chan struct{}
+	active bool
+	stop   chan struct{}
+	wg     sync.WaitGroup
+	// 已经通过 RegisterStrategy 注册过策略
+	strategy bool
+}
+
+func NewEventEngine(interval time.Duration) *EventEngine {
+	if interval <= 0 {
+		interval = time.Second
+	}
+	return &EventEngine{
+		handlers: make(map[EventType][]EventHandler),
+		interval: interval,
+	}
+}
+
+func (e *EventEngine) Register(eventType EventType, handler EventHandler) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.handlers[eventType] = append(e.handlers[eventType], handler)
+}
+
+// RegisterFirst 把处理函数放在已注册的处理函数之前，模拟盘用它保证先撮合再把行情推给策略
+func (e *EventEngine) RegisterFirst(eventType EventType, handler EventHandler) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.handlers[eventType] = append([]EventHandler{handler}, e.handlers[eventType]...)
+}
+
+// RegisterGeneral 注册接收所有类型事件的处理函数
+func (e *EventEngine) RegisterGeneral(handler EventHandler) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.general = append(e.general, handler)
+}
+
+func (e *EventEngine) Put(event Event) {
+	if !e.enqueue(event) {
+		e.process(event)
+	}
+}
+
+// enqueue 未启动时返回 false，由调用方决定同步处理还是丢弃
+func (e *EventEngine) enqueue(event Event) bool {
+	e.mu.Lock()
+	if !e.active {
+		e.mu.Unlock()
+		return false
+	}
+	e.queue = append(e.queue, event)
+	e.mu.Unlock()
+
+	select {
+	case e.notify <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+func (e *EventEngine) process(event Event) {
+	e.mu.RLock()
+	handlers := e.handlers[event.Type]
+	general := e.general
+	e.mu.RUnlock()
+
+	for _, handler := range handlers {
+		handler(event)
+	}
+	for _, handler := range general {
+		handler(event)
+	}
+}
+
+func (e *EventEngine) Start() {
+	e.mu.Lock()
+	if e.active {
+		e.mu.Unlock()
+		return
+	}
+	e.active = true
+	e.notify = make(chan struct{}, 1)
+	e.stop = make(chan struct{})
+	e.mu.Unlock()
+
+	e.wg.Add(2)
+	go e.run()
+	go e.runTimer()
+}
+
+// Stop 停止计时器，处理完队列中剩余的事件后返回，之后的 Put 同步处理
+func (e *EventEngine) Stop() {
+	e.mu.Lock()
+	if !e.active {
+		e.mu.Unlock()
+		return
+	}
+	e.active = false
+	e.mu.Unlock()
+
+	close(e.stop)
+	e.wg.Wait()
+}
+
+func (e *EventEngine) run() {
+	defer e.wg.Done()
+	for {
+		select {
+		case <-e.notify:
+			e.drain()
+		case <-e.stop:
+			e.drain()
+			return
+		}
+	}
+}
+
+// drain 按入队顺序处理队列中的事件，处理过程中新入队的事件也一并处理
+func (e *EventEngine) drain() {
+	for {
+		e.mu.Lock()
+		events := e.queue
+		e.queue = nil
+		e.mu.Unlock()
+		if len(events) == 0 {
+			return
+		}
+		for _, event := range events {
+			e.process(event)
+		}
+	}
+}
+
+func (e *EventEngine) runTimer() {
+	defer e.wg.Done()
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			e.enqueue(Event{Type: EventTimer, Data: now})
+		case <-e.stop:
+			return
+		}
+	}
+}
+
+// RegisterStrategy 把策略的回调注册到对应的事件上
+func (e *EventEngine) RegisterStrategy(strategy Strategy) {
+	e.mu.Lock()
+	e.strategy = true
+	e.mu.Unlock()
+	e.Register(EventTick, func(event Event) {
+		strategy.OnTick(event.Data.(TickData))
+	})
+	e.Register(EventBar, func(event Event) {
+		strategy.OnBar(event.Data.(BarData))
+	})
+	e.Register(EventOrder, func(event Event) {
+		strategy.OnOrder(event.Data.(OrderData))
+	})
+	e.Register(EventTrade, func(event Event) {
+		strategy.OnTrade(event.Data.(TradeData))
+	})
+	e.Register(EventPosition, func(event Event) {
+		strategy.OnPosition(event.Data.(float64))
+	})
+}
+
+// checkUnused 回测在调用方的协程里同步处理事件，已启动或已注册过策略的事件引擎不能再用于回测
+func (e *EventEngine) checkUnused() error {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	if e.active {
+		return errors.New("eventEngine已启动，回测需要未启动的事件引擎")
+	}
+	if e.strategy {
+		return errors.New("eventEngine已注册过策略，不能重复用于回测")
+	}
+	return nil
+}
+
+func logHandler(event Event) {
+	log.Print(event.Data)
+}
+
+// eventLogger 把日志作为 EventLog 发出，由注册的处理函数决定输出到哪里
+type eventLogger struct {
+	events *EventEngine
+}
+
+func (l eventLogger) Println(v ...any) {
+	l.events.Put(Event{Type: EventLog, Data: strings.TrimSuffix(fmt.Sprintln(v...), "\n")})
+}
+
+func (l eventLogger) Printf(format string, v ...any) {
+	l.events.Put(Event{Type: EventLog, Data: fmt.Sprintf(format, v...)})
+}
@@ -0,0 +1,130 @@
+package internal
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestEventEngineSync(t *testing.T) {
+	events := NewEventEngine(0)
+
+	var got []EventType
+	events.Register(EventBar, func(event Event) {
+		got = append(got, event.Type)
+	})
+	events.RegisterGeneral(func(event Event) {
+		got = append(got, event.Type)
+	})
+
+	events.Put(Event{Type: EventBar, Data: BarData{}})
+	events.Put(Event{Type: EventTick, Data: TickData{}})
+
+	want := []EventType{EventBar, EventBar, EventTick}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+}
+
+func TestEventEngineAsync(t *testing.T) {
+	events := NewEventEngine(10 * time.Millisecond)
+
+	var (
+		mu     sync.Mutex
+		logs   []string
+		timers int
+	)
+	events.Register(EventLog, func(event Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		logs = append(logs, event.Data.(string))
+	})
+	events.Register(EventTimer, func(event Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		timers++
+	})
+
+	events.Start()
+	logger := eventLogger{events}
+	logger.Println("hello", 1)
+	logger.Printf("world %d", 2)
+	time.Sleep(50 * time.Millisecond)
+	events.Stop()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(logs) != 2 || logs[0] != "hello 1" || logs[1] != "world 2" {
+		t.Fatalf("logs: %q", logs)
+	}
+	if timers == 0 {
+		t.Fatal("no timer event")
+	}
+}
+
+func TestEventEnginePutFromHandler(t *testing.T) {
+	events := NewEventEngine(time.Hour)
+
+	// 处理函数中放入超过原队列长度的事件，不会阻塞处理协程
+	const count = 5000
+	var ticks int
+	done := make(chan struct{})
+	events.Register(EventBar, func(event Event) {
+		for i := 0; i < count; i++ {
+			events.Put(Event{Type: EventTick, Data: TickData{}})
+		}
+	})
+	events.Register(EventTick, func(event Event) {
+		if ticks++; ticks == count {
+			close(done)
+		}
+	})
+
+	events.Start()
+	events.Put(Event{Type: EventBar, Data: BarData{}})
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("event engine blocked")
+	}
+	events.Stop()
+}
+
+func TestEventEnginePutStop(t *testing.T) {
+	events := NewEventEngine(time.Millisecond)
+	var (
+		mu   sync.Mutex
+		bars int
+	)
+	events.Register(EventBar, func(event Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		bars++
+	})
+	events.Start()
+
+	// 和 Stop 并发的 Put 不会丢失也不会阻塞
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 500; j++ {
+				events.Put(Event{Type: EventBar, Data: BarData{}})
+			}
+		}()
+	}
+	events.Stop()
+	wg.Wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if bars != 8*500 {
+		t.Fatalf("bars: %d", bars)
+	}
+}
@@ -0,0 +1,249 @@
+package internal
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	expb "newgitlab.com/xquant/exchange-protocols/protocols/src/go"
+)
+
+type ExportFormat string
+
+const (
+	ExportCSV   ExportFormat = "csv"
+	ExportJSONL ExportFormat = "jsonl"
+)
+
+// exportTable 导出的一张表，CSV 和 JSON Lines 使用同样的列
+type exportTable struct {
+	header []string
+	rows   [][]any
+}
+
+func tradeTable(trades []*TradeData) exportTable {
+	t := exportTable{header: []string{"trade_no", "order_no", "datetime", "symbol", "exchange", "direction", "offset", "price", "volume"}}
+	for _, trade := range trades {
+		t.rows = append(t.rows, []any{
+			trade.TradeNo, trade.OrderNo, formatTimestamp(trade.UpdatedAt.AsTime()), trade.Symbol, int32(trade.Exchange),
+			directionName(trade.Direction), offsetName(trade.Offset), trade.Price, trade.Volume,
+		})
+	}
+	return t
+}
+
+func orderTable(orders []*OrderData) exportTable {
+	t := exportTable{header: []string{"order_no", "datetime", "symbol", "exchange", "direction", "offset", "price", "volume", "traded", "status", "reference"}}
+	for _, order := range orders {
+		t.rows = append(t.rows, []any{
+			order.OrderNo, formatTimestamp(order.UpdatedAt.AsTime()), order.Symbol, int32(order.Exchange),
+			directionName(order.Direction), offsetName(order.Offset), order.Price, order.Volume, order.Traded,
+			statusName(order.Status), order.Reference,
+		})
+	}
+	return t
+}
+
+func roundTripTable(trips []RoundTrip) exportTable {
+	t := exportTable{header: []string{
+		"symbol", "direction", "entry_time", "exit_time", "entry_price", "exit_price", "volume",
+		"pnl", "commission", "slippage", "net_pnl", "holding_hours", "mae", "mfe",
+	}}
+	for _, trip := range trips {
+		t.rows = append(t.rows, []any{
+			trip.Symbol, directionName(trip.Direction), formatTimestamp(trip.EntryTime), formatTimestamp(trip.ExitTime),
+			trip.EntryPrice, trip.ExitPrice, trip.Volume, trip.Pnl, trip.Commission, trip.Slippage, trip.NetPnl,
+			trip.HoldingTime.Hours(), trip.Mae, trip.Mfe,
+		})
+	}
+	return t
+}
+
+func dailyTable(result *BacktestResult) exportTable {
+	t := exportTable{header: []string{
+		"date", "close_price", "pre_close", "trade_count", "start_pos", "end_pos", "turnover", "commission",
+		"slippage", "trading_pnl", "holding_pnl", "total_pnl", "net_pnl", "balance", "drawdown", "ddpercent",
+	}}
+	balances := result.Balances()
+	for i, daily := range result.DailyResults {
+		balance := balances[i]
+		t.rows = append(t.rows, []any{
+			daily.Date, daily.ClosePrice, daily.PreClose, daily.TradeCount, daily.StartPos, daily.EndPos,
+			daily.Turnover, daily.Commission, daily.Slippage, daily.TradingPnl, daily.HoldingPnl, daily.TotalPnl,
+			daily.NetPnl, balance.Balance, balance.Drawdown, balance.DdPercent,
+		})
+	}
+	return t
+}
+
+func (t exportTable) write(w io.Writer, format ExportFormat) error {
+	switch format {
+	case ExportCSV:
+		return t.writeCSV(w)
+	case ExportJSONL:
+		return t.writeJSONL(w)
+	default:
+		return fmt.Errorf("不支持的导出格式: %s", format)
+	}
+}
+
+func (t exportTable) writeCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(t.header); err != nil {
+		return err
+	}
+	record := make([]string, len(t.header))
+	for _, row := range t.rows {
+		for i, value := range row {
+			switch v := value.(type) {
+			case float64:
+				record[i] = strconv.FormatFloat(v, 'f', -1, 64)
+			default:
+				record[i] = fmt.Sprint(v)
+			}
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// writeJSONL 每行一个 JSON 对象，键的顺序与 CSV 的列一致
+func (t exportTable) writeJSONL(w io.Writer) error {
+	writer := bufio.NewWriter(w)
+	var line bytes.Buffer
+	for _, row := range t.rows {
+		line.Reset()
+		line.WriteByte('{')
+		for i, value := range row {
+			if i > 0 {
+				line.WriteByte(',')
+			}
+			key, _ := json.Marshal(t.header[i])
+			data, err := json.Marshal(value)
+			if err != nil {
+				return fmt.Errorf("%s: %w", t.header[i], err)
+			}
+			line.Write(key)
+			line.WriteByte(':')
+			line.Write(data)
+		}
+		line.WriteString("}\n")
+		if _, err := writer.Write(line.Bytes()); err != nil {
+			return err
+		}
+	}
+	return writer.Flush()
+}
+
+func WriteTrades(w io.Writer, format ExportFormat, trades []*TradeData) error {
+	return tradeTable(trades).write(w, format)
+}
+
+func WriteOrders(w io.Writer, format ExportFormat, orders []*OrderData) error {
+	return orderTable(orders).write(w, format)
+}
+
+func WriteRoundTrips(w io.Writer, format ExportFormat, trips []RoundTrip) error {
+	return roundTripTable(trips).write(w, format)
+}
+
+// WriteDailyResults 逐日结果附带资金、回撤和回撤百分比
+func WriteDailyResults(w io.Writer, format ExportFormat, result *BacktestResult) error {
+	return dailyTable(result).write(w, format)
+}
+
+// ExportResult 把成交、委托、逐笔交易和逐日结果分别写入 dir 下的 trades、orders、round_trips、daily 文件，返回写入的文件
+func ExportResult(dir string, format ExportFormat, result *BacktestResult) ([]string, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	tables := []struct {
+		name  string
+		table exportTable
+	}{
+		{"trades", tradeTable(result.Trades)},
+		{"orders", orderTable(result.Orders)},
+		{"round_trips", roundTripTable(result.RoundTrips)},
+		{"daily", dailyTable(result)},
+	}
+	paths := make([]string, 0, len(tables))
+	for _, item := range tables {
+		path := filepath.Join(dir, item.name+"."+string(format))
+		if err := writeExportFile(path, item.table, format); err != nil {
+			return paths, err
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+func writeExportFile(path string, table exportTable, format ExportFormat) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err = table.write(f, format); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+func formatTimestamp(t time.Time) string {
+	return t.Format(time.RFC3339Nano)
+}
+
+func directionName(direction expb.Direction) string {
+	switch direction {
+	case expb.Direction_LONG:
+		return "LONG"
+	case expb.Direction_SHORT:
+		return "SHORT"
+	default:
+		return strconv.Itoa(int(direction))
+	}
+}
+
+func offsetName(offset expb.Offset) string {
+	switch offset {
+	case expb.Offset_NONE:
+		return "NONE"
+	case expb.Offset_OPEN:
+		return "OPEN"
+	case expb.Offset_CLOSE:
+		return "CLOSE"
+	default:
+		return strconv.Itoa(int(offset))
+	}
+}
+
+func statusName(status expb.Status) string {
+	switch status {
+	case expb.Status_SUBMITTING:
+		return "SUBMITTING"
+	case expb.Status_NOT_TRADED:
+		return "NOT_TRADED"
+	case expb.Status_PART_TRADED:
+		return "PART_TRADED"
+	case expb.Status_ALL_TRADED:
+		return "ALL_TRADED"
+	case expb.Status_CANCELLED:
+		return "CANCELLED"
+	case expb.Status_REJECTED:
+		return "REJECTED"
+	default:
+		return strconv.Itoa(int(status))
+	}
+}
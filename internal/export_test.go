@@ -0,0 +1,65 @@
+package internal
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteTrades(t *testing.T) {
+	result := evaluateTestBacktest(t)
+
+	var b strings.Builder
+	if err := WriteTrades(&b, ExportCSV, result.Trades); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	if len(lines) != 3 || lines[0] != "trade_no,order_no,datetime,symbol,exchange,direction,offset,price,volume" {
+		t.Fatalf("trades: %q", lines)
+	}
+	if !strings.HasPrefix(lines[1], "1,1,2022-01-02T00:00:00Z,BTCUSDT,0,LONG,") || !strings.HasSuffix(lines[2], ",SHORT,NONE,120,1") {
+		t.Fatalf("trades: %q", lines)
+	}
+}
+
+func TestExportResult(t *testing.T) {
+	result := evaluateTestBacktest(t)
+
+	dir := t.TempDir()
+	paths, err := ExportResult(dir, ExportJSONL, result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != 4 {
+		t.Fatalf("paths: %v", paths)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "daily.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != len(result.DailyResults) {
+		t.Fatalf("daily: %d", len(lines))
+	}
+	var last map[string]any
+	if err = json.Unmarshal([]byte(lines[len(lines)-1]), &last); err != nil {
+		t.Fatal(err)
+	}
+	if last["balance"] != 1010.0 || last["date"] != result.DailyResults[len(lines)-1].Date {
+		t.Fatalf("daily: %v", last)
+	}
+	if !strings.HasPrefix(lines[0], `{"date":`) {
+		t.Fatalf("column order: %s", lines[0])
+	}
+
+	data, err = os.ReadFile(filepath.Join(dir, "orders.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(data), `"status":"ALL_TRADED"`); n != 2 {
+		t.Fatalf("orders: %s", data)
+	}
+}
@@ -0,0 +1,543 @@
+package internal
+
+import (
+	"container/list"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+var (
+	barHeader  = []string{"datetime", "symbol", "volume", "turnover", "open_interest", "open", "high", "low", "close"}
+	tickHeader = []string{"datetime", "symbol", "volume", "turnover", "open_interest", "last", "bid_1", "ask_1", "bid_volume_1", "ask_volume_1"}
+	// bids、asks 每档写成 价格:数量，档与档之间用 | 分隔
+	depthHeader       = []string{"datetime", "symbol", "snapshot", "bids", "asks", "last", "last_volume"}
+	marketTradeHeader = []string{"datetime", "symbol", "price", "volume"}
+)
+
+// FileData 以 csv 文件保存行情，每个合约每个周期一个文件，时间按 RFC3339Nano 写入
+type FileData struct {
+	dir string
+
+	mu   sync.Mutex
+	seen map[string]map[int64]struct{}
+}
+
+func NewFileData(dir string) (*FileData, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &FileData{dir: dir, seen: make(map[string]map[int64]struct{})}, nil
+}
+
+func (f *FileData) barFile(symbol string, interval time.Duration) (string, error) {
+	table, err := barTable(symbol, interval)
+	return filepath.Join(f.dir, table+".csv"), err
+}
+
+func (f *FileData) tickFile(symbol string) (string, error) {
+	table, err := tickTable(symbol)
+	return filepath.Join(f.dir, table+".csv"), err
+}
+
+func (f *FileData) depthFile(symbol string) (string, error) {
+	name, err := tableSymbol(symbol)
+	return filepath.Join(f.dir, "depth_"+name+".csv"), err
+}
+
+func (f *FileData) marketTradeFile(symbol string) (string, error) {
+	name, err := tableSymbol(symbol)
+	return filepath.Join(f.dir, "trades_"+name+".csv"), err
+}
+
+func (f *FileData) GetBarData(symbol string, _ Exchange, interval time.Duration, start, end time.Time) (*list.List, error) {
+	path, err := f.barFile(symbol, interval)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := readRows(path, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	l := list.New()
+	for _, row := range rows {
+		bar, err := parseBar(row)
+		if err != nil {
+			return nil, err
+		}
+		l.PushBack(bar)
+	}
+	return l, nil
+}
+
+func (f *FileData) GetTickData(symbol string, _ Exchange, _ time.Duration, start, end time.Time) (*list.List, error) {
+	path, err := f.tickFile(symbol)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := readRows(path, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	l := list.New()
+	for _, row := range rows {
+		tick, err := parseTick(row)
+		if err != nil {
+			return nil, err
+		}
+		l.PushBack(tick)
+	}
+	return l, nil
+}
+
+func (f *FileData) GetDepthData(symbol string, _ Exchange, start, end time.Time) (*list.List, error) {
+	path, err := f.depthFile(symbol)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := readRows(path, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	l := list.New()
+	for _, row := range rows {
+		depth, err := parseDepth(row)
+		if err != nil {
+			return nil, err
+		}
+		l.PushBack(depth)
+	}
+	return l, nil
+}
+
+func (f *FileData) GetMarketTradeData(symbol string, _ Exchange, start, end time.Time) (*list.List, error) {
+	path, err := f.marketTradeFile(symbol)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := readRows(path, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	l := list.New()
+	for _, row := range rows {
+		trade, err := parseMarketTrade(row)
+		if err != nil {
+			return nil, err
+		}
+		l.PushBack(trade)
+	}
+	return l, nil
+}
+
+func (f *FileData) SaveBarData(interval time.Duration, bars []BarData) error {
+	if len(bars) == 0 {
+		return nil
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	path, err := f.barFile(bars[0].Symbol, interval)
+	if err != nil {
+		return err
+	}
+	seen, err := f.loadSeen(path)
+	if err != nil {
+		return err
+	}
+
+	rows := make([][]string, 0, len(bars))
+	for _, bar := range bars {
+		key := bar.UpdatedAt.AsTime().UnixNano()
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+		rows = append(rows, formatBar(bar))
+	}
+	return appendRows(path, barHeader, rows)
+}
+
+func (f *FileData) SaveTickData(ticks []TickData) error {
+	if len(ticks) == 0 {
+		return nil
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	path, err := f.tickFile(ticks[0].Symbol)
+	if err != nil {
+		return err
+	}
+	seen, err := f.loadSeen(path)
+	if err != nil {
+		return err
+	}
+
+	rows := make([][]string, 0, len(ticks))
+	for _, tick := range ticks {
+		key := tick.UpdatedAt.AsTime().UnixNano()
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+		rows = append(rows, formatTick(tick))
+	}
+	return appendRows(path, tickHeader, rows)
+}
+
+// SaveDepthData 盘口增量可能有相同的时间，不按时间去重
+func (f *FileData) SaveDepthData(depths []DepthData) error {
+	if len(depths) == 0 {
+		return nil
+	}
+
+	path, err := f.depthFile(depths[0].Symbol)
+	if err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	rows := make([][]string, 0, len(depths))
+	for _, depth := range depths {
+		rows = append(rows, formatDepth(depth))
+	}
+	return appendRows(path, depthHeader, rows)
+}
+
+// SaveMarketTradeData 同一时间可能有多笔成交，不按时间去重
+func (f *FileData) SaveMarketTradeData(trades []MarketTradeData) error {
+	if len(trades) == 0 {
+		return nil
+	}
+
+	path, err := f.marketTradeFile(trades[0].Symbol)
+	if err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	rows := make([][]string, 0, len(trades))
+	for _, trade := range trades {
+		rows = append(rows, formatMarketTrade(trade))
+	}
+	return appendRows(path, marketTradeHeader, rows)
+}
+
+// loadSeen 首次写入某个文件时读出已有的时间，用于去重
+func (f *FileData) loadSeen(path string) (map[int64]struct{}, error) {
+	if seen, ok := f.seen[path]; ok {
+		return seen, nil
+	}
+
+	seen := make(map[int64]struct{})
+	rows, err := readRows(path, time.Time{}, time.Time{})
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		t, err := time.Parse(time.RFC3339Nano, row[0])
+		if err != nil {
+			return nil, err
+		}
+		seen[t.UnixNano()] = struct{}{}
+	}
+	f.seen[path] = seen
+	return seen, nil
+}
+
+// readRows 读取 [start, end] 范围内的数据行并按时间排序，start 和 end 为零值时不限制
+func readRows(path string, start, end time.Time) ([][]string, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	if _, err = reader.Read(); err != nil {
+		if err == io.EOF {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	type timedRow struct {
+		t   time.Time
+		row []string
+	}
+	timed := make([]timedRow, 0)
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		t, err := time.Parse(time.RFC3339Nano, row[0])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if (!start.IsZero() && t.Before(start)) || (!end.IsZero() && t.After(end)) {
+			continue
+		}
+		timed = append(timed, timedRow{t, row})
+	}
+	sort.SliceStable(timed, func(i, j int) bool { return timed[i].t.Before(timed[j].t) })
+
+	rows := make([][]string, 0, len(timed))
+	for _, r := range timed {
+		rows = append(rows, r.row)
+	}
+	return rows, nil
+}
+
+func appendRows(path string, header []string, rows [][]string) error {
+	if len(rows) == 0 {
+		return nil
+	}
+
+	_, err := os.Stat(path)
+	exists := err == nil
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	if !exists {
+		if err = writer.Write(header); err != nil {
+			return err
+		}
+	}
+	if err = writer.WriteAll(rows); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+func parseFloats(row []string) ([]float64, error) {
+	values := make([]float64, len(row))
+	for i, s := range row {
+		v, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = v
+	}
+	return values, nil
+}
+
+func formatBar(bar BarData) []string {
+	return []string{
+		bar.UpdatedAt.AsTime().Format(time.RFC3339Nano),
+		bar.Symbol,
+		formatFloat(bar.Volume),
+		formatFloat(bar.Turnover),
+		formatFloat(bar.OpenInterest),
+		formatFloat(bar.OpenPrice),
+		formatFloat(bar.HighPrice),
+		formatFloat(bar.LowPrice),
+		formatFloat(bar.ClosePrice),
+	}
+}
+
+func parseBar(row []string) (BarData, error) {
+	if len(row) != len(barHeader) {
+		return BarData{}, fmt.Errorf("K线数据列数错误: %v", row)
+	}
+	t, err := time.Parse(time.RFC3339Nano, row[0])
+	if err != nil {
+		return BarData{}, err
+	}
+	values, err := parseFloats(row[2:])
+	if err != nil {
+		return BarData{}, err
+	}
+	return BarData{
+		Symbol:       row[1],
+		UpdatedAt:    timestamppb.New(t),
+		Volume:       values[0],
+		Turnover:     values[1],
+		OpenInterest: values[2],
+		OpenPrice:    values[3],
+		HighPrice:    values[4],
+		LowPrice:     values[5],
+		ClosePrice:   values[6],
+	}, nil
+}
+
+func formatTick(tick TickData) []string {
+	return []string{
+		tick.UpdatedAt.AsTime().Format(time.RFC3339Nano),
+		tick.Symbol,
+		formatFloat(tick.Volume),
+		formatFloat(tick.Turnover),
+		formatFloat(tick.OpenInterest),
+		formatFloat(tick.LastPrice),
+		formatFloat(tick.BidPrice_1),
+		formatFloat(tick.AskPrice_1),
+		formatFloat(tick.BidVolume_1),
+		formatFloat(tick.AskVolume_1),
+	}
+}
+
+func parseTick(row []string) (TickData, error) {
+	if len(row) != len(tickHeader) {
+		return TickData{}, fmt.Errorf("tick数据列数错误: %v", row)
+	}
+	t, err := time.Parse(time.RFC3339Nano, row[0])
+	if err != nil {
+		return TickData{}, err
+	}
+	values, err := parseFloats(row[2:])
+	if err != nil {
+		return TickData{}, err
+	}
+	return TickData{
+		Symbol:       row[1],
+		UpdatedAt:    timestamppb.New(t),
+		Volume:       values[0],
+		Turnover:     values[1],
+		OpenInterest: values[2],
+		LastPrice:    values[3],
+		BidPrice_1:   values[4],
+		AskPrice_1:   values[5],
+		BidVolume_1:  values[6],
+		AskVolume_1:  values[7],
+	}, nil
+}
+
+func formatDepth(depth DepthData) []string {
+	return []string{
+		depth.UpdatedAt.Format(time.RFC3339Nano),
+		depth.Symbol,
+		strconv.FormatBool(depth.Snapshot),
+		formatLevels(depth.Bids),
+		formatLevels(depth.Asks),
+		formatFloat(depth.LastPrice),
+		formatFloat(depth.LastVolume),
+	}
+}
+
+func parseDepth(row []string) (DepthData, error) {
+	if len(row) != len(depthHeader) {
+		return DepthData{}, fmt.Errorf("盘口数据列数错误: %v", row)
+	}
+	t, err := time.Parse(time.RFC3339Nano, row[0])
+	if err != nil {
+		return DepthData{}, err
+	}
+	snapshot, err := strconv.ParseBool(row[2])
+	if err != nil {
+		return DepthData{}, err
+	}
+	bids, err := parseLevels(row[3])
+	if err != nil {
+		return DepthData{}, err
+	}
+	asks, err := parseLevels(row[4])
+	if err != nil {
+		return DepthData{}, err
+	}
+	values, err := parseFloats(row[5:])
+	if err != nil {
+		return DepthData{}, err
+	}
+	return DepthData{
+		Symbol:     row[1],
+		UpdatedAt:  t,
+		Snapshot:   snapshot,
+		Bids:       bids,
+		Asks:       asks,
+		LastPrice:  values[0],
+		LastVolume: values[1],
+	}, nil
+}
+
+func formatLevels(levels []BookLevel) string {
+	parts := make([]string, 0, len(levels))
+	for _, level := range levels {
+		parts = append(parts, formatFloat(level.Price)+":"+formatFloat(level.Volume))
+	}
+	return strings.Join(parts, "|")
+}
+
+func parseLevels(s string) ([]BookLevel, error) {
+	if s == "" {
+		return nil, nil
+	}
+	parts := strings.Split(s, "|")
+	levels := make([]BookLevel, 0, len(parts))
+	for _, part := range parts {
+		price, volume, ok := strings.Cut(part, ":")
+		if !ok {
+			return nil, fmt.Errorf("盘口档位格式错误: %s", part)
+		}
+		values, err := parseFloats([]string{price, volume})
+		if err != nil {
+			return nil, err
+		}
+		levels = append(levels, BookLevel{values[0], values[1]})
+	}
+	return levels, nil
+}
+
+func formatMarketTrade(trade MarketTradeData) []string {
+	return []string{
+		trade.UpdatedAt.Format(time.RFC3339Nano),
+		trade.Symbol,
+		formatFloat(trade.Price),
+		formatFloat(trade.Volume),
+	}
+}
+
+func parseMarketTrade(row []string) (MarketTradeData, error) {
+	if len(row) != len(marketTradeHeader) {
+		return MarketTradeData{}, fmt.Errorf("逐笔成交数据列数错误: %v", row)
+	}
+	t, err := time.Parse(time.RFC3339Nano, row[0])
+	if err != nil {
+		return MarketTradeData{}, err
+	}
+	values, err := parseFloats(row[2:])
+	if err != nil {
+		return MarketTradeData{}, err
+	}
+	return MarketTradeData{
+		Symbol:    row[1],
+		UpdatedAt: t,
+		Price:     values[0],
+		Volume:    values[1],
+	}, nil
+}
@@ -0,0 +1,251 @@
+package internal
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+)
+
+// RunFingerprint 回测配置、行情数据和结果各自的 sha256
+// 两次回测的 Config 和 Data 相同而 Result 不同时，说明回测过程不确定
+type RunFingerprint struct {
+	Config string
+	Data   string
+	Result string
+}
+
+// String 三者合起来的指纹，用于比较两次回测是否完全一致
+func (f RunFingerprint) String() string {
+	sum := sha256.Sum256([]byte(f.Config + f.Data + f.Result))
+	return hex.EncodeToString(sum[:])
+}
+
+// hashJSON 按 JSON 写入摘要，JSON 不能编码的值（如 NaN、±Inf 和函数）改用 writeCanonical 写入
+func hashJSON(h hash.Hash, values ...any) string {
+	for _, v := range values {
+		fmt.Fprintf(h, "%T\n", v)
+		writeValue(h, v)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func writeValue(w io.Writer, v any) {
+	if data, err := json.Marshal(v); err == nil {
+		w.Write(append(data, '\n'))
+		return
+	}
+	writeCanonical(w, reflect.ValueOf(v), 0)
+	io.WriteString(w, "\n")
+}
+
+// writeCanonical 与 JSON 一样只写导出字段，浮点数按文本写入，map 按键排序，指针写指向的值
+// 能按 JSON 编码的部分仍按 JSON 写入，函数和 channel 只写类型名，嵌套过深时截断
+func writeCanonical(w io.Writer, v reflect.Value, depth int) {
+	if !v.IsValid() {
+		io.WriteString(w, "null")
+		return
+	}
+	if depth > 32 {
+		io.WriteString(w, "...")
+		return
+	}
+	if v.CanInterface() {
+		if data, err := json.Marshal(v.Interface()); err == nil {
+			w.Write(data)
+			return
+		}
+	}
+
+	switch v.Kind() {
+	case reflect.Float32, reflect.Float64:
+		io.WriteString(w, strconv.FormatFloat(v.Float(), 'g', -1, 64))
+	case reflect.Complex64, reflect.Complex128:
+		io.WriteString(w, strconv.FormatComplex(v.Complex(), 'g', -1, 128))
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			io.WriteString(w, "null")
+			return
+		}
+		writeCanonical(w, v.Elem(), depth+1)
+	case reflect.Struct:
+		io.WriteString(w, "{")
+		for i := 0; i < v.NumField(); i++ {
+			if field := v.Type().Field(i); field.IsExported() {
+				fmt.Fprintf(w, "%q:", field.Name)
+				writeCanonical(w, v.Field(i), depth+1)
+				io.WriteString(w, ",")
+			}
+		}
+		io.WriteString(w, "}")
+	case reflect.Map:
+		keys := v.MapKeys()
+		names := make([]string, len(keys))
+		for i, key := range keys {
+			names[i] = fmt.Sprint(key.Interface())
+		}
+		sort.Sort(canonicalKeys{names, keys})
+		io.WriteString(w, "{")
+		for i, key := range keys {
+			fmt.Fprintf(w, "%q:", names[i])
+			writeCanonical(w, v.MapIndex(key), depth+1)
+			io.WriteString(w, ",")
+		}
+		io.WriteString(w, "}")
+	case reflect.Slice, reflect.Array:
+		io.WriteString(w, "[")
+		for i := 0; i < v.Len(); i++ {
+			writeCanonical(w, v.Index(i), depth+1)
+			io.WriteString(w, ",")
+		}
+		io.WriteString(w, "]")
+	default:
+		io.WriteString(w, v.Type().String())
+	}
+}
+
+type canonicalKeys struct {
+	names []string
+	keys  []reflect.Value
+}
+
+func (k canonicalKeys) Len() int           { return len(k.names) }
+func (k canonicalKeys) Less(i, j int) bool { return k.names[i] < k.names[j] }
+func (k canonicalKeys) Swap(i, j int) {
+	k.names[i], k.names[j] = k.names[j], k.names[i]
+	k.keys[i], k.keys[j] = k.keys[j], k.keys[i]
+}
+
+// configHash 在回放之前计算，策略按导出字段计入（见 Strategy），数据源和事件引擎不计入
+func (b *BackTestingEngine) configHash() string {
+	cfg := b.EngineCfg
+	cfg.Strategy, cfg.DataRepo, cfg.EventEngine = nil, nil, nil
+	return hashJSON(sha256.New(), cfg, b.Strategy)
+}
+
+// dataHash 按回放顺序计入全部行情，价差回测还计入各腿的价格
+// 行情数量大，按固定的二进制格式写入摘要，不经过 JSON 编码
+func (b *BackTestingEngine) dataHash() string {
+	w := &dataWriter{h: sha256.New()}
+	for cur := b.historyData.Front(); cur != nil; cur = cur.Next() {
+		w.write(cur.Value)
+	}
+
+	keys := make([]int64, 0, len(b.legHistory))
+	for key := range b.legHistory {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	w.int(int64(len(keys)))
+	for _, key := range keys {
+		w.int(key)
+		w.prices(b.legHistory[key])
+	}
+	w.prices(b.benchmarkPrices)
+	w.flush()
+	return hex.EncodeToString(w.h.Sum(nil))
+}
+
+// dataWriter 数值按小端序写入，字符串和列表先写长度，每条数据先写一个字节的类型标记
+type dataWriter struct {
+	h   hash.Hash
+	buf []byte
+}
+
+func (w *dataWriter) write(data any) {
+	switch data := data.(type) {
+	case BarData:
+		w.buf = append(w.buf, 'b')
+		w.string(data.Symbol)
+		w.int(int64(data.Exchange), data.UpdatedAt.AsTime().UnixNano(), int64(data.Interval))
+		w.float(data.Volume, data.Turnover, data.OpenInterest, data.OpenPrice, data.HighPrice, data.LowPrice, data.ClosePrice)
+	case TickData:
+		w.buf = append(w.buf, 't')
+		w.string(data.Symbol)
+		w.int(int64(data.Exchange), data.UpdatedAt.AsTime().UnixNano())
+		w.float(data.Volume, data.Turnover, data.OpenInterest, data.LastPrice, data.LastVolume,
+			data.OpenPrice, data.HighPrice, data.LowPrice,
+			data.BidPrice_1, data.BidPrice_2, data.BidPrice_3, data.BidPrice_4, data.BidPrice_5,
+			data.AskPrice_1, data.AskPrice_2, data.AskPrice_3, data.AskPrice_4, data.AskPrice_5,
+			data.BidVolume_1, data.BidVolume_2, data.BidVolume_3, data.BidVolume_4, data.BidVolume_5,
+			data.AskVolume_1, data.AskVolume_2, data.AskVolume_3, data.AskVolume_4, data.AskVolume_5)
+	case DepthData:
+		w.buf = append(w.buf, 'd')
+		w.string(data.Symbol)
+		snapshot := int64(0)
+		if data.Snapshot {
+			snapshot = 1
+		}
+		w.int(data.UpdatedAt.UnixNano(), snapshot)
+		w.levels(data.Bids)
+		w.levels(data.Asks)
+		w.float(data.LastPrice, data.LastVolume)
+	case MarketTradeData:
+		w.buf = append(w.buf, 'm')
+		w.string(data.Symbol)
+		w.int(data.UpdatedAt.UnixNano())
+		w.float(data.Price, data.Volume)
+	default:
+		w.flush()
+		fmt.Fprintf(w.h, "%T\n", data)
+		writeValue(w.h, data)
+	}
+	if len(w.buf) >= 4096 {
+		w.flush()
+	}
+}
+
+func (w *dataWriter) int(values ...int64) {
+	for _, v := range values {
+		w.buf = binary.LittleEndian.AppendUint64(w.buf, uint64(v))
+	}
+}
+
+func (w *dataWriter) float(values ...float64) {
+	for _, v := range values {
+		w.buf = binary.LittleEndian.AppendUint64(w.buf, math.Float64bits(v))
+	}
+}
+
+func (w *dataWriter) string(s string) {
+	w.int(int64(len(s)))
+	w.buf = append(w.buf, s...)
+}
+
+func (w *dataWriter) levels(levels []BookLevel) {
+	w.int(int64(len(levels)))
+	for _, level := range levels {
+		w.float(level.Price, level.Volume)
+	}
+}
+
+// prices 按键排序写入
+func (w *dataWriter) prices(prices map[string]float64) {
+	keys := make([]string, 0, len(prices))
+	for key := range prices {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	w.int(int64(len(keys)))
+	for _, key := range keys {
+		w.string(key)
+		w.float(prices[key])
+	}
+}
+
+func (w *dataWriter) flush() {
+	w.h.Write(w.buf)
+	w.buf = w.buf[:0]
+}
+
+// resultHash 计入委托、成交、逐日结果和逐笔交易，统计指标由这些计算得到，不再计入
+func resultHash(result *BacktestResult) string {
+	return hashJSON(sha256.New(), result.Orders, result.Trades, result.DailyResults, result.RoundTrips)
+}
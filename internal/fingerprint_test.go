@@ -0,0 +1,187 @@
+package internal
+
+import (
+	"container/list"
+	"math"
+	"testing"
+	"time"
+
+	expb "newgitlab.com/xquant/exchange-protocols/protocols/src/go"
+)
+
+func fingerprintTestRun(t *testing.T, bars []BarData, latency LatencyConfig) *BacktestResult {
+	t.Helper()
+	start := bars[0].UpdatedAt.AsTime()
+	strategy := &orderTypeTestStrategy{orders: make(map[string]OrderData), onBar: func(s *orderTypeTestStrategy, bar BarData) {
+		for i := 0; i < 5; i++ {
+			s.Buy(bar.ClosePrice+float64(i), 1)
+			s.Sell(bar.ClosePrice-float64(i), 1)
+		}
+	}}
+	result, err := Evaluate(EngineCfg{
+		Strategy:   strategy,
+		DataRepo:   &memoryRepo{bars: map[string][]BarData{"BTCUSDT": bars}},
+		Symbol:     "BTCUSDT",
+		Start:      start,
+		End:        start.Add(time.Duration(len(bars)) * time.Hour),
+		Interval:   time.Hour,
+		Capital:    10000,
+		Rate:       0.001,
+		Size:       1,
+		AnnualDays: 365,
+		Latency:    latency,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func TestBacktestFingerprint(t *testing.T) {
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	bars := make([]BarData, 0)
+	for i := 0; i < 72; i++ {
+		price := 100 + float64(i%7) - float64(i%3)
+		bars = append(bars, newTestBar("BTCUSDT", start.Add(time.Duration(i)*time.Hour), price, price+3, price-3, price+0.5))
+	}
+	latency := LatencyConfig{Submit: time.Minute, Jitter: time.Hour, Seed: 7}
+
+	first := fingerprintTestRun(t, bars, latency)
+	for i := 0; i < 5; i++ {
+		if again := fingerprintTestRun(t, bars, latency); again.Fingerprint != first.Fingerprint {
+			t.Fatalf("run %d: %+v != %+v", i, again.Fingerprint, first.Fingerprint)
+		}
+	}
+	// 逐日结果中的成交按成交顺序排列
+	for _, daily := range first.DailyResults {
+		for i := 1; i < len(daily.Trades); i++ {
+			if !lessNo(daily.Trades[i-1].TradeNo, daily.Trades[i].TradeNo) {
+				t.Fatalf("%s: trades out of order", daily.Date)
+			}
+		}
+	}
+
+	seed := fingerprintTestRun(t, bars, LatencyConfig{Submit: time.Minute, Jitter: time.Hour, Seed: 8})
+	if seed.Fingerprint.Config == first.Fingerprint.Config || seed.Fingerprint.Data != first.Fingerprint.Data {
+		t.Fatalf("seed: %+v", seed.Fingerprint)
+	}
+
+	changed := append([]BarData(nil), bars...)
+	changed[10] = newTestBar("BTCUSDT", start.Add(10*time.Hour), 90, 95, 85, 90)
+	data := fingerprintTestRun(t, changed, latency)
+	if data.Fingerprint.Config != first.Fingerprint.Config || data.Fingerprint.Data == first.Fingerprint.Data {
+		t.Fatalf("data: %+v", data.Fingerprint)
+	}
+	if data.Fingerprint.String() == first.Fingerprint.String() {
+		t.Fatal("fingerprint unchanged")
+	}
+}
+
+func TestPaperQueryPositionOrder(t *testing.T) {
+	events := NewEventEngine(0)
+	gateway := NewPaperGateway(new(fakeMarketGateway), 1000, 0, 1)
+	if err := gateway.Connect(events); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	symbols := []string{"SOLUSDT", "BTCUSDT", "ETHUSDT", "ADAUSDT"}
+	for _, symbol := range symbols {
+		if _, err := gateway.SendOrder(OrderRequest{Symbol: symbol, Direction: expb.Direction_LONG, Volume: 1, Type: MARKET}); err != nil {
+			t.Fatal(err)
+		}
+		events.Put(Event{Type: EventBar, Data: newTestBar(symbol, start, 10, 10, 10, 10)})
+	}
+
+	positions, _ := gateway.QueryPosition()
+	if len(positions) != len(symbols) {
+		t.Fatalf("positions: %+v", positions)
+	}
+	for i := 1; i < len(positions); i++ {
+		if positions[i-1].Symbol >= positions[i].Symbol {
+			t.Fatalf("positions: %+v", positions)
+		}
+	}
+}
+
+type fingerprintParamStrategy struct {
+	StrategyTemplate
+	Threshold float64
+	Filter    func(BarData) bool
+	Weights   map[string]*float64
+}
+
+// JSON 不能编码 NaN、±Inf 和函数，这些参数也要计入配置指纹
+func TestFingerprintNonFinite(t *testing.T) {
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	bars := []BarData{
+		newTestBar("BTCUSDT", start, 100, 100, 100, 100),
+		newTestBar("BTCUSDT", start.Add(time.Hour), 100, 100, 100, 100),
+	}
+	configHash := func(threshold, weight float64) string {
+		result, err := Evaluate(EngineCfg{
+			Strategy:   &fingerprintParamStrategy{Threshold: threshold, Weights: map[string]*float64{"a": &weight, "b": nil}},
+			DataRepo:   &memoryRepo{bars: map[string][]BarData{"BTCUSDT": bars}},
+			Symbol:     "BTCUSDT",
+			Start:      start,
+			End:        start.Add(2 * time.Hour),
+			Interval:   time.Hour,
+			Capital:    10000,
+			Size:       1,
+			AnnualDays: 365,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return result.Fingerprint.Config
+	}
+
+	seen := make(map[string]float64)
+	for _, threshold := range []float64{math.NaN(), math.Inf(1), math.Inf(-1), 1} {
+		hash := configHash(threshold, 1)
+		if hash != configHash(threshold, 1) {
+			t.Fatalf("%v: not deterministic", threshold)
+		}
+		if other, ok := seen[hash]; ok {
+			t.Fatalf("%v and %v: same fingerprint", threshold, other)
+		}
+		seen[hash] = threshold
+	}
+	if configHash(math.NaN(), 1) == configHash(math.NaN(), 2) {
+		t.Fatal("weights not hashed")
+	}
+}
+
+func TestDataHash(t *testing.T) {
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	hash := func(modify func(tick *TickData, depth *DepthData, trade *MarketTradeData)) string {
+		tick := newTestTick("BTCUSDT", start, 100, 1)
+		depth := DepthData{Symbol: "BTCUSDT", UpdatedAt: start, Bids: []BookLevel{{99, 1}, {98, 2}}, Asks: []BookLevel{{101, 1}}}
+		trade := MarketTradeData{Symbol: "BTCUSDT", UpdatedAt: start, Price: 100, Volume: 1}
+		modify(&tick, &depth, &trade)
+		engine := &BackTestingEngine{historyData: list.New()}
+		engine.historyData.PushBack(tick)
+		engine.historyData.PushBack(depth)
+		engine.historyData.PushBack(trade)
+		return engine.dataHash()
+	}
+
+	base := hash(func(*TickData, *DepthData, *MarketTradeData) {})
+	if again := hash(func(*TickData, *DepthData, *MarketTradeData) {}); again != base {
+		t.Fatal("hash not stable")
+	}
+	changes := map[string]func(tick *TickData, depth *DepthData, trade *MarketTradeData){
+		"ask volume 5": func(tick *TickData, _ *DepthData, _ *MarketTradeData) { tick.AskVolume_5 = 1 },
+		"depth level":  func(_ *TickData, depth *DepthData, _ *MarketTradeData) { depth.Bids[1].Volume = 3 },
+		// 档位从买盘移到卖盘，各档的值不变
+		"depth side": func(_ *TickData, depth *DepthData, _ *MarketTradeData) {
+			depth.Asks = append([]BookLevel{depth.Bids[1]}, depth.Asks...)
+			depth.Bids = depth.Bids[:1]
+		},
+		"trade volume": func(_ *TickData, _ *DepthData, trade *MarketTradeData) { trade.Volume = 2 },
+	}
+	for name, modify := range changes {
+		if hash(modify) == base {
+			t.Fatalf("%s: hash unchanged", name)
+		}
+	}
+}
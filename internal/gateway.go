@@ -0,0 +1,47 @@
+package internal
+
+import "time"
+
+type SubscribeRequest struct {
+	Symbol   string
+	Exchange Exchange
+	Interval time.Duration
+}
+
+type CancelRequest struct {
+	Symbol   string
+	Exchange Exchange
+	OrderNo  string
+}
+
+type AccountData struct {
+	AccountID string
+	Balance   float64
+	Frozen    float64
+}
+
+func (a AccountData) Available() float64 {
+	return a.Balance - a.Frozen
+}
+
+// PositionData 净持仓，多头为正空头为负
+type PositionData struct {
+	Symbol   string
+	Exchange Exchange
+	Volume   float64
+	Price    float64
+	Pnl      float64
+}
+
+// Gateway 交易接口
+// Connect 时传入事件引擎，之后行情和委托、成交回报都以 EventTick、EventBar、EventOrder、EventTrade 推送
+type Gateway interface {
+	Connect(events *EventEngine) error
+	Close()
+
+	Subscribe(req SubscribeRequest) error
+	SendOrder(req OrderRequest) (string, error)
+	CancelOrder(req CancelRequest) error
+	QueryAccount() (AccountData, error)
+	QueryPosition() ([]PositionData, error)
+}
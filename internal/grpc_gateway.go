@@ -0,0 +1,314 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	expb "newgitlab.com/xquant/exchange-protocols/protocols/src/go"
+)
+
+// RecvStream 服务端推送流，和 protoc-gen-go-grpc 生成的流客户端的 Recv 一致
+type RecvStream[T any] interface {
+	Recv() (*T, error)
+}
+
+// ExchangeClient exchange-protocols 行情和交易服务的客户端
+// 由生成的服务客户端包装实现，GrpcGateway 只依赖这个接口，方法名和编解码都由生成代码负责
+type ExchangeClient interface {
+	SubscribeTick(ctx context.Context, req SubscribeRequest) (RecvStream[expb.TickData], error)
+	SubscribeBar(ctx context.Context, req SubscribeRequest) (RecvStream[expb.BarData], error)
+	SubscribeOrder(ctx context.Context) (RecvStream[expb.OrderData], error)
+	SubscribeTrade(ctx context.Context) (RecvStream[expb.TradeData], error)
+	// SendOrder 返回交易所的委托编号
+	SendOrder(ctx context.Context, order *expb.OrderData) (string, error)
+	CancelOrder(ctx context.Context, order *expb.OrderData) error
+	QueryAccount(ctx context.Context) (AccountData, error)
+	QueryPosition(ctx context.Context) ([]PositionData, error)
+}
+
+// GrpcMethods 行情和交易服务各方法的完整名称，如 "/expb.MarketData/SubscribeTick"
+// 请求和应答都是协议里的行情和委托消息：订阅行情发送带合约的 TickData、BarData，订阅回报发送空的 OrderData、TradeData，
+// 下单和撤单发送 OrderData 并返回 OrderData
+type GrpcMethods struct {
+	SubscribeTick  string
+	SubscribeBar   string
+	SubscribeOrder string
+	SubscribeTrade string
+	SendOrder      string
+	CancelOrder    string
+}
+
+// NewClient 按方法名直接在连接上调用服务，可以作为 GrpcGatewayCfg.NewClient
+// 协议里没有账户和持仓的消息，需要查询时自己包装生成的客户端
+func (m GrpcMethods) NewClient(conn grpc.ClientConnInterface) ExchangeClient {
+	return &methodClient{conn: conn, methods: m}
+}
+
+type methodClient struct {
+	conn    grpc.ClientConnInterface
+	methods GrpcMethods
+}
+
+func (c *methodClient) SubscribeTick(ctx context.Context, req SubscribeRequest) (RecvStream[expb.TickData], error) {
+	return openStream[expb.TickData](ctx, c.conn, c.methods.SubscribeTick, &expb.TickData{Symbol: req.Symbol, Exchange: expb.Exchange(req.Exchange)})
+}
+
+// SubscribeBar K线周期由服务端决定
+func (c *methodClient) SubscribeBar(ctx context.Context, req SubscribeRequest) (RecvStream[expb.BarData], error) {
+	return openStream[expb.BarData](ctx, c.conn, c.methods.SubscribeBar, &expb.BarData{Symbol: req.Symbol, Exchange: expb.Exchange(req.Exchange)})
+}
+
+func (c *methodClient) SubscribeOrder(ctx context.Context) (RecvStream[expb.OrderData], error) {
+	return openStream[expb.OrderData](ctx, c.conn, c.methods.SubscribeOrder, &expb.OrderData{})
+}
+
+func (c *methodClient) SubscribeTrade(ctx context.Context) (RecvStream[expb.TradeData], error) {
+	return openStream[expb.TradeData](ctx, c.conn, c.methods.SubscribeTrade, &expb.TradeData{})
+}
+
+func (c *methodClient) SendOrder(ctx context.Context, order *expb.OrderData) (string, error) {
+	reply := new(expb.OrderData)
+	if err := c.conn.Invoke(ctx, c.methods.SendOrder, order, reply); err != nil {
+		return "", err
+	}
+	if reply.OrderNo == "" {
+		return "", errors.New("服务端没有返回委托编号")
+	}
+	return reply.OrderNo, nil
+}
+
+func (c *methodClient) CancelOrder(ctx context.Context, order *expb.OrderData) error {
+	return c.conn.Invoke(ctx, c.methods.CancelOrder, order, new(expb.OrderData))
+}
+
+func (c *methodClient) QueryAccount(context.Context) (AccountData, error) {
+	return AccountData{}, errors.New("gRPC协议没有账户查询")
+}
+
+func (c *methodClient) QueryPosition(context.Context) ([]PositionData, error) {
+	return nil, errors.New("gRPC协议没有持仓查询")
+}
+
+// openStream 发送一条请求后关闭发送端，和生成代码的服务端流一样
+func openStream[T any](ctx context.Context, conn grpc.ClientConnInterface, method string, req any) (RecvStream[T], error) {
+	if method == "" {
+		return nil, errors.New("gRPC方法名不能为空")
+	}
+	s, err := conn.NewStream(ctx, &grpc.StreamDesc{ServerStreams: true}, method)
+	if err != nil {
+		return nil, err
+	}
+	if err = s.SendMsg(req); err != nil {
+		return nil, err
+	}
+	if err = s.CloseSend(); err != nil {
+		return nil, err
+	}
+	return clientStream[T]{s}, nil
+}
+
+type clientStream[T any] struct {
+	grpc.ClientStream
+}
+
+func (s clientStream[T]) Recv() (*T, error) {
+	msg := new(T)
+	if err := s.RecvMsg(msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+type GrpcGatewayCfg struct {
+	Target      string
+	DialOptions []grpc.DialOption
+	// NewClient 用建立的连接创建服务客户端，可以用 GrpcMethods.NewClient
+	NewClient func(grpc.ClientConnInterface) ExchangeClient
+
+	// 流断开后重连的间隔
+	RetryInterval time.Duration
+	Timeout       time.Duration
+}
+
+// GrpcGateway 连接 exchange-protocols 的 gRPC 行情和交易服务，把推送流转成引擎事件
+type GrpcGateway struct {
+	GrpcGatewayCfg
+
+	conn   *grpc.ClientConn
+	client ExchangeClient
+	events *EventEngine
+	logger Logger
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func NewGrpcGateway(cfg GrpcGatewayCfg) *GrpcGateway {
+	if cfg.RetryInterval <= 0 {
+		cfg.RetryInterval = time.Second
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 5 * time.Second
+	}
+	return &GrpcGateway{GrpcGatewayCfg: cfg}
+}
+
+func (g *GrpcGateway) Connect(events *EventEngine) error {
+	if g.Target == "" {
+		return errors.New("gRPC服务地址不能为空")
+	}
+	if g.NewClient == nil {
+		return errors.New("gRPC服务客户端不能为空")
+	}
+
+	options := g.DialOptions
+	if len(options) == 0 {
+		options = []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
+	}
+	conn, err := grpc.Dial(g.Target, options...)
+	if err != nil {
+		return err
+	}
+
+	g.conn = conn
+	g.client = g.NewClient(conn)
+	g.events = events
+	g.logger = eventLogger{events}
+	g.ctx, g.cancel = context.WithCancel(context.Background())
+
+	stream(g, "委托回报", g.client.SubscribeOrder, func(order *expb.OrderData) {
+		events.Put(Event{Type: EventOrder, Data: OrderData(*order)})
+	})
+	stream(g, "成交回报", g.client.SubscribeTrade, func(trade *expb.TradeData) {
+		events.Put(Event{Type: EventTrade, Data: TradeData(*trade)})
+	})
+
+	return nil
+}
+
+func (g *GrpcGateway) Close() {
+	if g.cancel == nil {
+		return
+	}
+	g.cancel()
+	g.wg.Wait()
+	g.conn.Close()
+}
+
+func (g *GrpcGateway) Subscribe(req SubscribeRequest) error {
+	if g.client == nil {
+		return errors.New("gRPC接口未连接")
+	}
+
+	stream(g, "tick行情", func(ctx context.Context) (RecvStream[expb.TickData], error) {
+		return g.client.SubscribeTick(ctx, req)
+	}, func(tick *expb.TickData) {
+		g.events.Put(Event{Type: EventTick, Data: TickData(*tick)})
+	})
+	stream(g, "K线行情", func(ctx context.Context) (RecvStream[expb.BarData], error) {
+		return g.client.SubscribeBar(ctx, req)
+	}, func(bar *expb.BarData) {
+		g.events.Put(Event{Type: EventBar, Data: BarData(*bar)})
+	})
+
+	return nil
+}
+
+func (g *GrpcGateway) SendOrder(req OrderRequest) (string, error) {
+	if g.client == nil {
+		return "", errors.New("gRPC接口未连接")
+	}
+	// 协议的委托中没有类型和有效方式的字段
+	if req.Type != LIMIT || req.TimeInForce != GTC || req.ReduceOnly {
+		return "", errors.New("gRPC接口只支持GTC限价单")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), g.Timeout)
+	defer cancel()
+	return g.client.SendOrder(ctx, &expb.OrderData{
+		Symbol:    req.Symbol,
+		Exchange:  expb.Exchange(req.Exchange),
+		Direction: req.Direction,
+		Offset:    req.Offset,
+		Price:     req.Price,
+		Volume:    req.Volume,
+	})
+}
+
+func (g *GrpcGateway) CancelOrder(req CancelRequest) error {
+	if g.client == nil {
+		return errors.New("gRPC接口未连接")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), g.Timeout)
+	defer cancel()
+	return g.client.CancelOrder(ctx, &expb.OrderData{
+		Symbol:   req.Symbol,
+		Exchange: expb.Exchange(req.Exchange),
+		OrderNo:  req.OrderNo,
+	})
+}
+
+func (g *GrpcGateway) QueryAccount() (AccountData, error) {
+	if g.client == nil {
+		return AccountData{}, errors.New("gRPC接口未连接")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), g.Timeout)
+	defer cancel()
+	return g.client.QueryAccount(ctx)
+}
+
+func (g *GrpcGateway) QueryPosition() ([]PositionData, error) {
+	if g.client == nil {
+		return nil, errors.New("gRPC接口未连接")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), g.Timeout)
+	defer cancel()
+	return g.client.QueryPosition(ctx)
+}
+
+// stream 在单独的协程里接收服务端推送，断开后按间隔重连，直到 Close
+func stream[T any](g *GrpcGateway, name string, open func(context.Context) (RecvStream[T], error), handle func(*T)) {
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		for {
+			err := recv(g.ctx, open, handle)
+			if g.ctx.Err() != nil {
+				return
+			}
+			g.logger.Println("gRPC推送流断开:", name, err)
+
+			select {
+			case <-time.After(g.RetryInterval):
+			case <-g.ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+func recv[T any](ctx context.Context, open func(context.Context) (RecvStream[T], error), handle func(*T)) error {
+	s, err := open(ctx)
+	if err != nil {
+		return err
+	}
+	for {
+		msg, err := s.Recv()
+		if err != nil {
+			if err == io.EOF {
+				return errors.New("服务端关闭了推送流")
+			}
+			return err
+		}
+		handle(msg)
+	}
+}
@@ -0,0 +1,361 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+	expb "newgitlab.com/xquant/exchange-protocols/protocols/src/go"
+)
+
+// chanStream 从 channel 读取推送，channel 关闭时返回 io.EOF
+type chanStream[T any] struct {
+	ctx context.Context
+	ch  chan *T
+}
+
+func (s chanStream[T]) Recv() (*T, error) {
+	select {
+	case msg, ok := <-s.ch:
+		if !ok {
+			return nil, io.EOF
+		}
+		return msg, nil
+	case <-s.ctx.Done():
+		return nil, s.ctx.Err()
+	}
+}
+
+// mockExchangeClient 进程内的行情和交易服务，第一条 tick 流推送一条后断开，用于检查重连
+type mockExchangeClient struct {
+	mu        sync.Mutex
+	tickOpens int
+	cancelled []string
+
+	orders chan *expb.OrderData
+	trades chan *expb.TradeData
+}
+
+func (m *mockExchangeClient) SubscribeTick(ctx context.Context, req SubscribeRequest) (RecvStream[expb.TickData], error) {
+	m.mu.Lock()
+	m.tickOpens++
+	price := 99 + float64(m.tickOpens)
+	m.mu.Unlock()
+
+	ch := make(chan *expb.TickData, 1)
+	ch <- &expb.TickData{Symbol: req.Symbol, LastPrice: price}
+	if price == 100 {
+		close(ch)
+	}
+	return chanStream[expb.TickData]{ctx, ch}, nil
+}
+
+func (m *mockExchangeClient) SubscribeBar(ctx context.Context, req SubscribeRequest) (RecvStream[expb.BarData], error) {
+	ch := make(chan *expb.BarData, 1)
+	ch <- &expb.BarData{Symbol: req.Symbol, ClosePrice: 100}
+	return chanStream[expb.BarData]{ctx, ch}, nil
+}
+
+func (m *mockExchangeClient) SubscribeOrder(ctx context.Context) (RecvStream[expb.OrderData], error) {
+	return chanStream[expb.OrderData]{ctx, m.orders}, nil
+}
+
+func (m *mockExchangeClient) SubscribeTrade(ctx context.Context) (RecvStream[expb.TradeData], error) {
+	return chanStream[expb.TradeData]{ctx, m.trades}, nil
+}
+
+func (m *mockExchangeClient) SendOrder(_ context.Context, order *expb.OrderData) (string, error) {
+	order.OrderNo = "mock.1"
+	order.Status = expb.Status_ALL_TRADED
+	order.Traded = order.Volume
+	m.orders <- order
+	m.trades <- &expb.TradeData{Symbol: order.Symbol, OrderNo: order.OrderNo, TradeNo: "mock.1", Direction: order.Direction, Price: order.Price, Volume: order.Volume}
+	return order.OrderNo, nil
+}
+
+func (m *mockExchangeClient) CancelOrder(_ context.Context, order *expb.OrderData) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.cancelled = append(m.cancelled, order.OrderNo)
+	return nil
+}
+
+func (m *mockExchangeClient) QueryAccount(context.Context) (AccountData, error) {
+	return AccountData{AccountID: "mock", Balance: 1000, Frozen: 100}, nil
+}
+
+func (m *mockExchangeClient) QueryPosition(context.Context) ([]PositionData, error) {
+	return []PositionData{{Symbol: "BTCUSDT", Volume: 2, Price: 100}}, nil
+}
+
+func TestGrpcGateway(t *testing.T) {
+	client := &mockExchangeClient{orders: make(chan *expb.OrderData, 8), trades: make(chan *expb.TradeData, 8)}
+	gateway := NewGrpcGateway(GrpcGatewayCfg{
+		Target:        "passthrough:///mock",
+		NewClient:     func(grpc.ClientConnInterface) ExchangeClient { return client },
+		RetryInterval: time.Millisecond,
+	})
+	if _, err := gateway.SendOrder(OrderRequest{}); err == nil {
+		t.Fatal("not connected")
+	}
+
+	received := make(chan Event, 16)
+	events := NewEventEngine(0)
+	events.RegisterGeneral(func(event Event) {
+		if event.Type != EventLog {
+			received <- event
+		}
+	})
+	if err := gateway.Connect(events); err != nil {
+		t.Fatal(err)
+	}
+	defer gateway.Close()
+
+	if err := gateway.Subscribe(SubscribeRequest{Symbol: "BTCUSDT"}); err != nil {
+		t.Fatal(err)
+	}
+	orderNo, err := gateway.SendOrder(OrderRequest{Symbol: "BTCUSDT", Direction: expb.Direction_LONG, Price: 100, Volume: 2})
+	if err != nil || orderNo != "mock.1" {
+		t.Fatalf("order no: %s %v", orderNo, err)
+	}
+	if _, err = gateway.SendOrder(OrderRequest{Symbol: "BTCUSDT", Volume: 1, Type: MARKET}); err == nil {
+		t.Fatal("market order")
+	}
+	if err = gateway.CancelOrder(CancelRequest{Symbol: "BTCUSDT", OrderNo: orderNo}); err != nil || client.cancelled[0] != orderNo {
+		t.Fatalf("cancel: %v %v", client.cancelled, err)
+	}
+
+	// tick 流断开后重连，收到两条 tick
+	counts := make(map[EventType]int)
+	var prices []float64
+	timeout := time.After(5 * time.Second)
+	for counts[EventTick] < 2 || counts[EventBar] < 1 || counts[EventOrder] < 1 || counts[EventTrade] < 1 {
+		select {
+		case event := <-received:
+			counts[event.Type]++
+			if tick, ok := event.Data.(TickData); ok {
+				prices = append(prices, tick.LastPrice)
+			}
+		case <-timeout:
+			t.Fatalf("events: %v", counts)
+		}
+	}
+	if prices[0] != 100 || prices[1] != 101 {
+		t.Fatalf("ticks: %v", prices)
+	}
+
+	account, err := gateway.QueryAccount()
+	if err != nil || account.AccountID != "mock" || account.Available() != 900 {
+		t.Fatalf("account: %+v %v", account, err)
+	}
+	positions, err := gateway.QueryPosition()
+	if err != nil || len(positions) != 1 || positions[0].Volume != 2 {
+		t.Fatalf("positions: %+v %v", positions, err)
+	}
+}
+
+// jsonCodec 测试服务端和客户端都用 json 编解码，不依赖协议消息的 proto 实现
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v any) ([]byte, error)      { return json.Marshal(v) }
+func (jsonCodec) Unmarshal(data []byte, v any) error { return json.Unmarshal(data, v) }
+func (jsonCodec) Name() string                       { return "json" }
+
+// grpcTestServer 进程内的行情和交易服务，第一条 tick 流推送一条后结束，用于检查重连
+type grpcTestServer struct {
+	mu        sync.Mutex
+	tickOpens int
+	symbols   []string
+	cancelled []string
+
+	orders chan *expb.OrderData
+	trades chan *expb.TradeData
+}
+
+func (s *grpcTestServer) subscribeTick(_ any, stream grpc.ServerStream) error {
+	req := new(expb.TickData)
+	if err := stream.RecvMsg(req); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.tickOpens++
+	s.symbols = append(s.symbols, req.Symbol)
+	price := 99 + float64(s.tickOpens)
+	s.mu.Unlock()
+
+	if err := stream.SendMsg(&expb.TickData{Symbol: req.Symbol, LastPrice: price}); err != nil || price == 100 {
+		return err
+	}
+	<-stream.Context().Done()
+	return nil
+}
+
+func (s *grpcTestServer) subscribeBar(_ any, stream grpc.ServerStream) error {
+	req := new(expb.BarData)
+	if err := stream.RecvMsg(req); err != nil {
+		return err
+	}
+	if err := stream.SendMsg(&expb.BarData{Symbol: req.Symbol, ClosePrice: 100}); err != nil {
+		return err
+	}
+	<-stream.Context().Done()
+	return nil
+}
+
+func serveChan[T any](ch chan *T) grpc.StreamHandler {
+	return func(_ any, stream grpc.ServerStream) error {
+		if err := stream.RecvMsg(new(T)); err != nil {
+			return err
+		}
+		for {
+			select {
+			case msg := <-ch:
+				if err := stream.SendMsg(msg); err != nil {
+					return err
+				}
+			case <-stream.Context().Done():
+				return nil
+			}
+		}
+	}
+}
+
+func (s *grpcTestServer) sendOrder(_ any, _ context.Context, dec func(any) error, _ grpc.UnaryServerInterceptor) (any, error) {
+	order := new(expb.OrderData)
+	if err := dec(order); err != nil {
+		return nil, err
+	}
+	order.OrderNo = "grpc.1"
+	order.Status = expb.Status_ALL_TRADED
+	order.Traded = order.Volume
+	s.orders <- order
+	s.trades <- &expb.TradeData{Symbol: order.Symbol, OrderNo: order.OrderNo, TradeNo: "grpc.1", Direction: order.Direction, Price: order.Price, Volume: order.Volume}
+	return order, nil
+}
+
+func (s *grpcTestServer) cancelOrder(_ any, _ context.Context, dec func(any) error, _ grpc.UnaryServerInterceptor) (any, error) {
+	order := new(expb.OrderData)
+	if err := dec(order); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cancelled = append(s.cancelled, order.OrderNo)
+	return order, nil
+}
+
+func (s *grpcTestServer) register(server *grpc.Server) {
+	server.RegisterService(&grpc.ServiceDesc{
+		ServiceName: "expb.MarketData",
+		HandlerType: (*any)(nil),
+		Streams: []grpc.StreamDesc{
+			{StreamName: "SubscribeTick", Handler: s.subscribeTick, ServerStreams: true},
+			{StreamName: "SubscribeBar", Handler: s.subscribeBar, ServerStreams: true},
+		},
+	}, s)
+	server.RegisterService(&grpc.ServiceDesc{
+		ServiceName: "expb.Trade",
+		HandlerType: (*any)(nil),
+		Methods: []grpc.MethodDesc{
+			{MethodName: "SendOrder", Handler: s.sendOrder},
+			{MethodName: "CancelOrder", Handler: s.cancelOrder},
+		},
+		Streams: []grpc.StreamDesc{
+			{StreamName: "SubscribeOrder", Handler: serveChan(s.orders), ServerStreams: true},
+			{StreamName: "SubscribeTrade", Handler: serveChan(s.trades), ServerStreams: true},
+		},
+	}, s)
+}
+
+func TestGrpcGatewayServer(t *testing.T) {
+	listener := bufconn.Listen(1 << 20)
+	server := grpc.NewServer(grpc.ForceServerCodec(jsonCodec{}))
+	service := &grpcTestServer{orders: make(chan *expb.OrderData, 8), trades: make(chan *expb.TradeData, 8)}
+	service.register(server)
+	go server.Serve(listener)
+	defer server.Stop()
+
+	methods := GrpcMethods{
+		SubscribeTick:  "/expb.MarketData/SubscribeTick",
+		SubscribeBar:   "/expb.MarketData/SubscribeBar",
+		SubscribeOrder: "/expb.Trade/SubscribeOrder",
+		SubscribeTrade: "/expb.Trade/SubscribeTrade",
+		SendOrder:      "/expb.Trade/SendOrder",
+		CancelOrder:    "/expb.Trade/CancelOrder",
+	}
+	gateway := NewGrpcGateway(GrpcGatewayCfg{
+		Target: "passthrough:///bufnet",
+		DialOptions: []grpc.DialOption{
+			grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+			grpc.WithTransportCredentials(insecure.NewCredentials()),
+			grpc.WithDefaultCallOptions(grpc.ForceCodec(jsonCodec{})),
+		},
+		NewClient:     methods.NewClient,
+		RetryInterval: time.Millisecond,
+	})
+
+	received := make(chan Event, 16)
+	events := NewEventEngine(0)
+	events.RegisterGeneral(func(event Event) {
+		if event.Type != EventLog {
+			received <- event
+		}
+	})
+	if err := gateway.Connect(events); err != nil {
+		t.Fatal(err)
+	}
+	defer gateway.Close()
+
+	if err := gateway.Subscribe(SubscribeRequest{Symbol: "BTCUSDT"}); err != nil {
+		t.Fatal(err)
+	}
+	orderNo, err := gateway.SendOrder(OrderRequest{Symbol: "BTCUSDT", Direction: expb.Direction_LONG, Price: 100, Volume: 2})
+	if err != nil || orderNo != "grpc.1" {
+		t.Fatalf("order no: %s %v", orderNo, err)
+	}
+	if err = gateway.CancelOrder(CancelRequest{Symbol: "BTCUSDT", OrderNo: orderNo}); err != nil {
+		t.Fatal(err)
+	}
+
+	// tick 流结束后重连，收到两条 tick
+	counts := make(map[EventType]int)
+	var prices []float64
+	var order OrderData
+	timeout := time.After(5 * time.Second)
+	for counts[EventTick] < 2 || counts[EventBar] < 1 || counts[EventOrder] < 1 || counts[EventTrade] < 1 {
+		select {
+		case event := <-received:
+			counts[event.Type]++
+			switch data := event.Data.(type) {
+			case TickData:
+				prices = append(prices, data.LastPrice)
+			case OrderData:
+				order = data
+			}
+		case <-timeout:
+			t.Fatalf("events: %v", counts)
+		}
+	}
+	if prices[0] != 100 || prices[1] != 101 {
+		t.Fatalf("ticks: %v", prices)
+	}
+	if order.OrderNo != "grpc.1" || order.Volume != 2 || order.Status != expb.Status_ALL_TRADED {
+		t.Fatalf("order: %+v", order)
+	}
+
+	service.mu.Lock()
+	defer service.mu.Unlock()
+	if len(service.symbols) != 2 || service.symbols[1] != "BTCUSDT" || len(service.cancelled) != 1 || service.cancelled[0] != orderNo {
+		t.Fatalf("symbols: %v cancelled: %v", service.symbols, service.cancelled)
+	}
+	if _, err = gateway.QueryAccount(); err == nil {
+		t.Fatal("account query")
+	}
+}
@@ -0,0 +1,135 @@
+package internal
+
+import (
+	"container/heap"
+	"errors"
+	"math/rand"
+	"time"
+
+	expb "newgitlab.com/xquant/exchange-protocols/protocols/src/go"
+)
+
+// LatencyConfig 回测中模拟的延迟，为 0 时立即生效
+type LatencyConfig struct {
+	// 委托发出到在交易所生效
+	Submit time.Duration
+	// 撤单发出到在交易所生效，生效前委托仍可能成交
+	Cancel time.Duration
+	// 行情产生到策略收到
+	MarketData time.Duration
+	// 不为 0 的延迟每次再加上 [0, Jitter) 的随机延迟，随机数由 Seed 决定
+	Jitter time.Duration
+	Seed   int64
+}
+
+func (c LatencyConfig) Check() error {
+	var errs CheckErrors
+	if c.Submit < 0 {
+		errs = append(errs, errors.New("latency.submit不能为负数"))
+	}
+	if c.Cancel < 0 {
+		errs = append(errs, errors.New("latency.cancel不能为负数"))
+	}
+	if c.MarketData < 0 {
+		errs = append(errs, errors.New("latency.market_data不能为负数"))
+	}
+	if c.Jitter < 0 {
+		errs = append(errs, errors.New("latency.jitter不能为负数"))
+	}
+	return errs.Err()
+}
+
+type delayedAction struct {
+	at  time.Time
+	seq int
+	fn  func()
+}
+
+// delayQueue 按生效时间排序，时间相同时按加入的顺序
+type delayQueue []delayedAction
+
+func (q delayQueue) Len() int { return len(q) }
+
+func (q delayQueue) Less(i, j int) bool {
+	if q[i].at.Equal(q[j].at) {
+		return q[i].seq < q[j].seq
+	}
+	return q[i].at.Before(q[j].at)
+}
+
+func (q delayQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q *delayQueue) Push(x any) { *q = append(*q, x.(delayedAction)) }
+
+func (q *delayQueue) Pop() any {
+	old := *q
+	item := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return item
+}
+
+type latencySim struct {
+	LatencyConfig
+	rand  *rand.Rand
+	queue delayQueue
+	seq   int
+}
+
+func newLatencySim(cfg LatencyConfig) *latencySim {
+	return &latencySim{LatencyConfig: cfg, rand: rand.New(rand.NewSource(cfg.Seed))}
+}
+
+// delay 在 base 上加随机延迟，base 为 0 时不延迟
+func (l *latencySim) delay(base time.Duration) time.Duration {
+	if base > 0 && l.Jitter > 0 {
+		base += time.Duration(l.rand.Int63n(int64(l.Jitter)))
+	}
+	return base
+}
+
+func (l *latencySim) schedule(at time.Time, fn func()) {
+	l.seq++
+	heap.Push(&l.queue, delayedAction{at: at, seq: l.seq, fn: fn})
+}
+
+// runDelayed 依次执行 now 之前到期的动作，执行期间 datetime 为动作的生效时间
+// 动作中新加入的到期动作也会在这次执行
+func (b *BackTestingEngine) runDelayed(now time.Time) {
+	for b.latency.queue.Len() > 0 && !b.latency.queue[0].at.After(now) {
+		action := heap.Pop(&b.latency.queue).(delayedAction)
+		b.datetime = action.at
+		action.fn()
+	}
+	b.datetime = now
+}
+
+// drainDelayed 回放结束后执行剩余的动作，之后没有行情，激活的委托不会再成交
+func (b *BackTestingEngine) drainDelayed() {
+	for b.latency.queue.Len() > 0 {
+		b.runDelayed(b.latency.queue[0].at)
+	}
+}
+
+// publish 行情按 MarketData 延迟推给策略
+// 算法委托和止盈止损在交易所一侧执行，按行情时间收到行情
+func (b *BackTestingEngine) publish(event Event) {
+	if d := b.latency.delay(b.latency.MarketData); d > 0 {
+		b.latency.schedule(b.datetime.Add(d), func() { b.events.Put(event) })
+	} else {
+		b.events.Put(event)
+	}
+	b.algos.onMarketEvent(event)
+	b.brackets.onMarketEvent(event)
+}
+
+// activateOrder 委托到达交易所，之后才参与撮合
+func (b *BackTestingEngine) activateOrder(order *OrderData) {
+	if _, ok := b.pendingOrders[order.OrderNo]; !ok {
+		return
+	}
+	delete(b.pendingOrders, order.OrderNo)
+	order.Status = expb.Status_NOT_TRADED
+	if b.acceptOrder(order) {
+		b.events.Put(Event{Type: EventOrder, Data: *order})
+	}
+}
@@ -0,0 +1,162 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	expb "newgitlab.com/xquant/exchange-protocols/protocols/src/go"
+)
+
+func TestLatencyDelay(t *testing.T) {
+	a := newLatencySim(LatencyConfig{Jitter: 10 * time.Millisecond, Seed: 1})
+	b := newLatencySim(LatencyConfig{Jitter: 10 * time.Millisecond, Seed: 1})
+	if d := a.delay(0); d != 0 {
+		t.Fatalf("zero latency delayed: %v", d)
+	}
+	for i := 0; i < 100; i++ {
+		d := a.delay(time.Millisecond)
+		if d < time.Millisecond || d >= 11*time.Millisecond || d != b.delay(time.Millisecond) {
+			t.Fatalf("delay: %v", d)
+		}
+	}
+
+	cfg, err := LatencySetting{Submit: "50ms", MarketData: "1s", Seed: 7}.config()
+	if err != nil || cfg.Submit != 50*time.Millisecond || cfg.MarketData != time.Second || cfg.Seed != 7 {
+		t.Fatalf("config: %+v %v", cfg, err)
+	}
+	if latencySetting(cfg) != (LatencySetting{Submit: "50ms", MarketData: "1s", Seed: 7}) {
+		t.Fatalf("setting: %+v", latencySetting(cfg))
+	}
+	if _, err = (LatencySetting{Cancel: "abc"}).config(); err == nil || !strings.Contains(err.Error(), "latency.cancel") {
+		t.Fatalf("err: %v", err)
+	}
+}
+
+type latencyTestStrategy struct {
+	StrategyTemplate
+	onBar  func(s *latencyTestStrategy, bar BarData)
+	bars   []BarData
+	orders []OrderData
+}
+
+func (s *latencyTestStrategy) OnBar(bar BarData) {
+	s.bars = append(s.bars, bar)
+	s.onBar(s, bar)
+}
+
+func (s *latencyTestStrategy) OnOrder(order OrderData) {
+	s.orders = append(s.orders, order)
+}
+
+func runLatencyTest(t *testing.T, latency LatencyConfig, lows []float64, onBar func(s *latencyTestStrategy, bar BarData)) (*latencyTestStrategy, *BacktestResult) {
+	t.Helper()
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	bars := make([]BarData, 0, len(lows))
+	for i, low := range lows {
+		bars = append(bars, newTestBar("BTCUSDT", start.Add(time.Duration(i)*time.Hour), 100, 100, low, 100))
+	}
+
+	strategy := &latencyTestStrategy{onBar: onBar}
+	result, err := Evaluate(EngineCfg{
+		Strategy:   strategy,
+		DataRepo:   &memoryRepo{bars: map[string][]BarData{"BTCUSDT": bars}},
+		Symbol:     "BTCUSDT",
+		Start:      start,
+		End:        start.Add(time.Duration(len(lows)) * time.Hour),
+		Interval:   time.Hour,
+		Capital:    1000,
+		Size:       1,
+		AnnualDays: 365,
+		Latency:    latency,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strategy, result
+}
+
+func TestBacktestSubmitLatency(t *testing.T) {
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	buyFirst := func(s *latencyTestStrategy, bar BarData) {
+		if len(s.bars) == 1 {
+			s.Buy(bar.ClosePrice, 1)
+		}
+	}
+
+	_, result := runLatencyTest(t, LatencyConfig{}, []float64{100, 100, 100, 100}, buyFirst)
+	if len(result.Trades) != 1 || !result.Trades[0].UpdatedAt.AsTime().Equal(start.Add(time.Hour)) {
+		t.Fatalf("trades: %+v", result.Trades)
+	}
+
+	// 委托 1.5 小时后才到达，错过第二根K线
+	strategy, result := runLatencyTest(t, LatencyConfig{Submit: 90 * time.Minute}, []float64{100, 100, 100, 100}, buyFirst)
+	if len(result.Trades) != 1 || !result.Trades[0].UpdatedAt.AsTime().Equal(start.Add(2*time.Hour)) {
+		t.Fatalf("trades: %+v", result.Trades)
+	}
+	if len(strategy.orders) != 2 || strategy.orders[0].Status != expb.Status_NOT_TRADED || strategy.orders[1].Status != expb.Status_ALL_TRADED {
+		t.Fatalf("orders: %+v", strategy.orders)
+	}
+}
+
+func TestBacktestCancelLatency(t *testing.T) {
+	var orderNo string
+	buyThenCancel := func(s *latencyTestStrategy, bar BarData) {
+		switch len(s.bars) {
+		case 1:
+			orderNo = s.Buy(90, 1)
+		case 2:
+			s.CancelOrder(orderNo)
+		}
+	}
+	lows := []float64{100, 100, 80, 100}
+
+	_, result := runLatencyTest(t, LatencyConfig{}, lows, buyThenCancel)
+	if len(result.Trades) != 0 || result.Orders[0].Status != expb.Status_CANCELLED {
+		t.Fatalf("orders: %+v trades: %+v", result.Orders, result.Trades)
+	}
+
+	// 撤单还没生效时价格跌到委托价，委托成交
+	_, result = runLatencyTest(t, LatencyConfig{Cancel: 90 * time.Minute}, lows, buyThenCancel)
+	if len(result.Trades) != 1 || result.Orders[0].Status != expb.Status_ALL_TRADED {
+		t.Fatalf("orders: %+v trades: %+v", result.Orders, result.Trades)
+	}
+}
+
+func TestBacktestMarketDataLatency(t *testing.T) {
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	strategy, result := runLatencyTest(t, LatencyConfig{MarketData: 30 * time.Minute}, []float64{100, 100, 100, 100}, func(s *latencyTestStrategy, bar BarData) {
+		if len(s.bars) == 1 {
+			s.Buy(bar.ClosePrice, 1)
+		}
+	})
+
+	// 第一根K线在第二根K线到来时才推给策略，委托时间为收到行情的时间
+	// 最后一根K线在回放结束后推给策略
+	if len(strategy.bars) != 3 || !strategy.bars[0].UpdatedAt.AsTime().Equal(start) {
+		t.Fatalf("bars: %+v", strategy.bars)
+	}
+	if !result.Orders[0].UpdatedAt.AsTime().Equal(start.Add(30 * time.Minute)) {
+		t.Fatalf("order time: %v", result.Orders[0].UpdatedAt.AsTime())
+	}
+	if len(result.Trades) != 1 || !result.Trades[0].UpdatedAt.AsTime().Equal(start.Add(time.Hour)) {
+		t.Fatalf("trades: %+v", result.Trades)
+	}
+}
+
+func TestBacktestMarketDataLatencyBracket(t *testing.T) {
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	_, result := runLatencyTest(t, LatencyConfig{MarketData: 30 * time.Minute}, []float64{100, 100, 85, 100, 100}, func(s *latencyTestStrategy, bar BarData) {
+		if len(s.bars) == 1 {
+			s.SendBracket(BracketRequest{Entry: &OrderRequest{Direction: expb.Direction_LONG, Price: 100, Volume: 1}, StopLoss: 90})
+		}
+	})
+
+	// 止损在交易所一侧按行情时间触发，不等策略收到行情
+	if len(result.Orders) != 2 || !result.Orders[1].UpdatedAt.AsTime().Equal(start.Add(2*time.Hour)) {
+		t.Fatalf("orders: %+v", result.Orders)
+	}
+	if len(result.Trades) != 2 {
+		t.Fatalf("trades: %+v", result.Trades)
+	}
+}
@@ -0,0 +1,367 @@
+package internal
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	expb "newgitlab.com/xquant/exchange-protocols/protocols/src/go"
+)
+
+type LiveEngineCfg struct {
+	Strategy
+	Gateway
+
+	Symbol   string
+	Exchange Exchange
+	Interval time.Duration
+
+	// 策略调用 LoadBar、LoadTick 预热时使用，为空时不能预热
+	DataRepo DataRepo
+
+	// 下单前的风控规则，Size 为合约乘数，用于计算当日盈亏，为 0 时按 1 计算
+	Risk RiskConfig
+	Size float64
+
+	// 合约规格，设置后委托按规格取整并检查最小下单金额，Size 为 0 时使用合约规格的乘数
+	Contract *ContractData
+
+	// 为空时引擎自己创建，多个引擎可以共用同一个事件引擎和交易接口
+	EventEngine *EventEngine
+}
+
+func (c LiveEngineCfg) Check() error {
+	if c.Symbol == "" {
+		return errors.New("symbol不能为空")
+	}
+	if c.Strategy == nil {
+		return errors.New("strategy不能为空")
+	}
+	if c.Gateway == nil {
+		return errors.New("gateway不能为空")
+	}
+	if c.Contract != nil {
+		if err := c.Contract.Check(); err != nil {
+			return err
+		}
+	}
+
+	return c.Risk.Check()
+}
+
+// LiveEngine 实盘引擎，把交易接口推送的行情和回报转给策略，策略的委托发到交易接口
+type LiveEngine struct {
+	LiveEngineCfg
+
+	logger Logger
+	events *EventEngine
+
+	mu        sync.Mutex
+	orders    map[string]struct{}
+	pos       float64
+	risk      *riskManager
+	timers    *scheduler
+	algos     *algoEngine
+	brackets  *bracketEngine
+	warmingUp bool
+
+	// 正在调用 Gateway.SendOrder 的次数，期间收到的不认识的回报先按委托号缓存，发单返回后补发给策略
+	sending int
+	early   map[string][]Event
+
+	rejectCount int
+}
+
+func NewLiveEngine(cfg LiveEngineCfg) (*LiveEngine, error) {
+	if err := cfg.Check(); err != nil {
+		return nil, err
+	}
+
+	if cfg.Size == 0 && cfg.Contract != nil {
+		cfg.Size = cfg.Contract.Size
+	}
+	events := cfg.EventEngine
+	if events == nil {
+		events = NewEventEngine(0)
+		events.Register(EventLog, logHandler)
+	}
+
+	engine := &LiveEngine{
+		LiveEngineCfg: cfg,
+		logger:        eventLogger{events},
+		events:        events,
+		orders:        make(map[string]struct{}),
+		early:         make(map[string][]Event),
+		risk:          newRiskManager(cfg.Risk, cfg.Size),
+		timers:        newScheduler(),
+	}
+	engine.algos = newAlgoEngine(engine, cfg.Symbol, cfg.Strategy.OnAlgo, engine.logger, time.Now)
+	engine.brackets = newBracketEngine(engine, cfg.Symbol, cfg.Strategy.OnBracket, engine.logger, time.Now)
+	engine.Strategy.SetEngine(engine)
+	return engine, nil
+}
+
+// Start 先注册回调再连接交易接口，连接后立即推送的回报和行情不会丢失
+func (l *LiveEngine) Start() error {
+	l.registerStrategy()
+	l.algos.register(l.events)
+	l.brackets.register(l.events)
+	l.events.Start()
+
+	if err := l.Gateway.Connect(l.events); err != nil {
+		l.logger.Println("连接交易接口失败:", err.Error())
+		return err
+	}
+
+	l.Strategy.OnInit()
+	l.logger.Println("策略初始化完成")
+
+	l.Strategy.OnStart()
+
+	err := l.Gateway.Subscribe(SubscribeRequest{Symbol: l.Symbol, Exchange: l.Exchange, Interval: l.Interval})
+	if err != nil {
+		l.logger.Println("订阅行情失败:", err.Error())
+		return err
+	}
+	l.logger.Println("策略启动完成")
+
+	return nil
+}
+
+// Stop 先停止事件引擎，保证策略的回调都已处理完，再停止策略和交易接口
+func (l *LiveEngine) Stop() {
+	l.events.Stop()
+	l.Strategy.OnStop()
+	l.Gateway.Close()
+	l.logger.Println("策略已停止")
+}
+
+func (l *LiveEngine) Pos() float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.pos
+}
+
+func (l *LiveEngine) SendOrder(req OrderRequest) string {
+	req.Symbol = l.Symbol
+	req.Exchange = l.Exchange
+
+	l.mu.Lock()
+	if l.warmingUp {
+		l.mu.Unlock()
+		l.logger.Println("委托失败:", errWarmupOrder.Error())
+		return ""
+	}
+
+	now := time.Now()
+	req, err := l.Contract.normalize(req, l.risk.latestPrice())
+	if err == nil {
+		err = l.risk.check(req, now)
+	}
+	if err != nil {
+		l.rejectCount++
+		order := OrderData{
+			Symbol:    req.Symbol,
+			Exchange:  expb.Exchange(req.Exchange),
+			OrderNo:   "risk." + strconv.Itoa(l.rejectCount),
+			Direction: req.Direction,
+			Offset:    req.Offset,
+			Price:     req.Price,
+			Volume:    req.Volume,
+			Status:    expb.Status_REJECTED,
+			UpdatedAt: timestamppb.New(now),
+			Reference: err.Error(),
+		}
+		l.orders[order.OrderNo] = struct{}{}
+		l.mu.Unlock()
+
+		// 解锁之后再推送，事件队列满时不会阻塞回报的处理
+		l.logger.Println("委托被拒绝:", err.Error())
+		l.events.Put(Event{Type: EventOrder, Data: order})
+		return order.OrderNo
+	}
+	l.sending++
+	l.mu.Unlock()
+
+	// 不持锁调用交易接口，交易接口同步推送回报时不会和回报处理互相等待
+	orderNo, err := l.Gateway.SendOrder(req)
+
+	l.mu.Lock()
+	l.sending--
+	var early []Event
+	if err == nil {
+		l.orders[orderNo] = struct{}{}
+		l.risk.addOrder(OrderData{
+			Symbol:    req.Symbol,
+			OrderNo:   orderNo,
+			Direction: req.Direction,
+			Price:     req.Price,
+			Volume:    req.Volume,
+			Status:    expb.Status_SUBMITTING,
+		}, now)
+		early = l.early[orderNo]
+		delete(l.early, orderNo)
+	}
+	if l.sending == 0 {
+		// 其余缓存的回报属于别的引擎
+		l.early = make(map[string][]Event)
+	}
+	l.mu.Unlock()
+
+	if err != nil {
+		l.logger.Println("委托失败:", err.Error())
+		return ""
+	}
+	for _, event := range early {
+		l.onReport(event)
+	}
+	return orderNo
+}
+
+// SendAlgo 在策略回调中调用，算法和策略回调在同一个事件线程中处理
+func (l *LiveEngine) SendAlgo(req AlgoRequest) string {
+	return l.algos.sendAlgo(req)
+}
+
+func (l *LiveEngine) CancelAlgo(algoID string) {
+	l.algos.cancelAlgo(algoID)
+}
+
+// SendBracket 和 SendAlgo 一样在策略回调中调用
+func (l *LiveEngine) SendBracket(req BracketRequest) string {
+	return l.brackets.sendBracket(req)
+}
+
+func (l *LiveEngine) CancelBracket(bracketID string) {
+	l.brackets.cancelBracket(bracketID)
+}
+
+func (l *LiveEngine) CancelOrder(orderNo string) {
+	err := l.Gateway.CancelOrder(CancelRequest{Symbol: l.Symbol, Exchange: l.Exchange, OrderNo: orderNo})
+	if err != nil {
+		l.logger.Println("撤单失败:", err.Error())
+	}
+}
+
+// LoadBar 从 DataRepo 加载最近 days 天的K线推给策略，期间不能下单
+func (l *LiveEngine) LoadBar(days int) {
+	if l.Interval <= 0 {
+		l.logger.Println("加载预热数据失败: interval必须大于0")
+		return
+	}
+	l.warmup(BAR, days)
+}
+
+func (l *LiveEngine) LoadTick(days int) {
+	l.warmup(TICK, days)
+}
+
+func (l *LiveEngine) warmup(mod BackTestingMod, days int) {
+	if l.DataRepo == nil {
+		l.logger.Println("加载预热数据失败: dataRepo为空")
+		return
+	}
+	load := l.DataRepo.GetBarData
+	if mod == TICK {
+		load = l.DataRepo.GetTickData
+	}
+	start, end, err := warmupRange(time.Now(), days)
+	if err != nil {
+		l.logger.Println("加载预热数据失败:", err.Error())
+		return
+	}
+	history, err := load(l.Symbol, l.Exchange, l.Interval, start, end)
+	if err != nil {
+		l.logger.Println("加载预热数据失败:", err.Error())
+		return
+	}
+
+	l.setWarmingUp(true)
+	count := replayHistory(l.Strategy, history, end, nil)
+	l.setWarmingUp(false)
+	l.logger.Println("预热数据回放完成，数据量:", count)
+}
+
+func (l *LiveEngine) setWarmingUp(warmingUp bool) {
+	l.mu.Lock()
+	l.warmingUp = warmingUp
+	l.mu.Unlock()
+}
+
+func (l *LiveEngine) AddTimer(name string, schedule Schedule) {
+	l.timers.add(name, schedule)
+}
+
+func (l *LiveEngine) RemoveTimer(name string) {
+	l.timers.remove(name)
+}
+
+// ownOrder 不是本引擎的委托时，如果有委托正在发送，先缓存回报，委托号确定后再处理
+func (l *LiveEngine) ownOrder(orderNo string, event Event) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, ok := l.orders[orderNo]; ok {
+		return true
+	}
+	if l.sending > 0 {
+		l.early[orderNo] = append(l.early[orderNo], event)
+	}
+	return false
+}
+
+// registerStrategy 只把本策略合约的行情和本策略的委托、成交转给策略，定时任务按 EventTimer 的时间触发
+func (l *LiveEngine) registerStrategy() {
+	l.events.Register(EventTimer, func(event Event) {
+		for _, fired := range l.timers.update(event.Data.(time.Time)) {
+			l.Strategy.OnTimer(fired.name, fired.at)
+		}
+	})
+	l.events.Register(EventTick, func(event Event) {
+		if tick := event.Data.(TickData); tick.Symbol == l.Symbol {
+			l.risk.updatePrice(tick.LastPrice, tick.UpdatedAt.AsTime())
+			l.Strategy.OnTick(tick)
+		}
+	})
+	l.events.Register(EventBar, func(event Event) {
+		if bar := event.Data.(BarData); bar.Symbol == l.Symbol {
+			l.risk.updatePrice(bar.ClosePrice, bar.UpdatedAt.AsTime())
+			l.Strategy.OnBar(bar)
+		}
+	})
+	l.events.Register(EventOrder, func(event Event) {
+		if order := event.Data.(OrderData); l.ownOrder(order.OrderNo, event) {
+			l.onReport(event)
+		}
+	})
+	l.events.Register(EventTrade, func(event Event) {
+		if trade := event.Data.(TradeData); l.ownOrder(trade.OrderNo, event) {
+			l.onReport(event)
+		}
+	})
+}
+
+// onReport 处理本策略的委托和成交回报
+func (l *LiveEngine) onReport(event Event) {
+	if event.Type == EventOrder {
+		order := event.Data.(OrderData)
+		l.risk.updateOrder(order)
+		l.Strategy.OnOrder(order)
+		return
+	}
+
+	trade := event.Data.(TradeData)
+	posChange := trade.Volume
+	if trade.Direction == expb.Direction_SHORT {
+		posChange = -trade.Volume
+	}
+	l.mu.Lock()
+	l.pos += posChange
+	l.mu.Unlock()
+	l.risk.updateTrade(trade)
+
+	l.Strategy.OnPosition(posChange)
+	l.Strategy.OnTrade(trade)
+}
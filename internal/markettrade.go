@@ -0,0 +1,95 @@
+package internal
+
+import (
+	"container/list"
+	"time"
+
+	expb "newgitlab.com/xquant/exchange-protocols/protocols/src/go"
+)
+
+// MarketTradeData 市场上的逐笔（归集）成交，不是本策略的成交
+type MarketTradeData struct {
+	Symbol    string
+	UpdatedAt time.Time
+	Price     float64
+	Volume    float64
+}
+
+// MarketTradeRepo 能提供逐笔成交的数据源，开启 MarketTrades 时与 tick 按时间合并回放
+type MarketTradeRepo interface {
+	GetMarketTradeData(symbol string, exchange Exchange, start, end time.Time) (*list.List, error)
+}
+
+// newMarketTrade 用市场成交撮合挂单，成交价在委托价上或穿过委托价时按委托价成交
+// 开启 OrderBook 时交给盘口撮合估算排队，否则成交量按提交顺序分给各委托，总量不超过市场成交的数量
+// 市场成交的价格和 tick 一样更新持仓的最大浮盈浮亏、风控价格和每日收盘价
+func (b *BackTestingEngine) newMarketTrade(trade MarketTradeData) {
+	b.datetime = trade.UpdatedAt
+	b.runDelayed(b.datetime)
+
+	if b.book != nil {
+		b.lastPrice, b.lastVolume = trade.Price, trade.Volume
+		b.crossOrderBook()
+		b.lastVolume = 0
+	} else {
+		b.crossMarketTrade(trade)
+	}
+	b.roundTrips.updatePrice(trade.Price, trade.Price)
+	b.risk.updatePrice(trade.Price, b.datetime)
+	b.updateDailyClose(trade.Price)
+}
+
+// crossMarketTrade 挂单只由市场成交撮合，tick 的报价不会让已挂出的被动委托整笔成交
+func (b *BackTestingEngine) crossMarketTrade(trade MarketTradeData) {
+	available := trade.Volume
+	for _, order := range b.sortedActiveOrders() {
+		if available <= 0 {
+			break
+		}
+		// 市价、IOC 和 FOK 委托是吃单，不会被市场成交动到
+		if b.requests[order.OrderNo].immediate() || !tradeThrough(order, trade.Price) {
+			continue
+		}
+		volume := Min(order.Volume-order.Traded, available)
+		available -= volume
+		b.fillOrder(order, order.Price, volume)
+	}
+}
+
+func tradeThrough(order *OrderData, price float64) bool {
+	if order.Direction == expb.Direction_LONG {
+		return price <= order.Price
+	}
+	return price >= order.Price
+}
+
+// mergeByTime 按时间合并两个已排序的数据列表，时间相同时 a 在前
+func mergeByTime(a, b *list.List) *list.List {
+	merged := list.New()
+	x, y := a.Front(), b.Front()
+	for x != nil || y != nil {
+		if y == nil || (x != nil && !dataTime(y.Value).Before(dataTime(x.Value))) {
+			merged.PushBack(x.Value)
+			x = x.Next()
+		} else {
+			merged.PushBack(y.Value)
+			y = y.Next()
+		}
+	}
+	return merged
+}
+
+func dataTime(data any) time.Time {
+	switch data := data.(type) {
+	case BarData:
+		return data.UpdatedAt.AsTime()
+	case TickData:
+		return data.UpdatedAt.AsTime()
+	case DepthData:
+		return data.UpdatedAt
+	case MarketTradeData:
+		return data.UpdatedAt
+	default:
+		return time.Time{}
+	}
+}
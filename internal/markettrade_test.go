@@ -0,0 +1,203 @@
+package internal
+
+import (
+	"container/list"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+	expb "newgitlab.com/xquant/exchange-protocols/protocols/src/go"
+)
+
+type marketTradeTestRepo struct {
+	memoryRepo
+	trades []MarketTradeData
+}
+
+func (m *marketTradeTestRepo) GetMarketTradeData(_ string, _ Exchange, start, end time.Time) (*list.List, error) {
+	l := list.New()
+	for _, trade := range m.trades {
+		if !trade.UpdatedAt.Before(start) && !trade.UpdatedAt.After(end) {
+			l.PushBack(trade)
+		}
+	}
+	return l, nil
+}
+
+func TestMergeByTime(t *testing.T) {
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	quotes, trades := list.New(), list.New()
+	quotes.PushBack(TickData{UpdatedAt: timestamppb.New(start)})
+	quotes.PushBack(TickData{UpdatedAt: timestamppb.New(start.Add(2 * time.Second))})
+	trades.PushBack(MarketTradeData{UpdatedAt: start.Add(time.Second)})
+	trades.PushBack(MarketTradeData{UpdatedAt: start.Add(2 * time.Second)})
+	trades.PushBack(MarketTradeData{UpdatedAt: start.Add(3 * time.Second)})
+
+	var kinds []string
+	for cur := mergeByTime(quotes, trades).Front(); cur != nil; cur = cur.Next() {
+		switch cur.Value.(type) {
+		case TickData:
+			kinds = append(kinds, "tick")
+		case MarketTradeData:
+			kinds = append(kinds, "trade")
+		}
+	}
+	if want := []string{"tick", "trade", "tick", "trade", "trade"}; !reflect.DeepEqual(kinds, want) {
+		t.Fatalf("merged: %v", kinds)
+	}
+}
+
+type marketTradeTestStrategy struct {
+	StrategyTemplate
+	ticks int
+}
+
+func (s *marketTradeTestStrategy) OnTick(tick TickData) {
+	s.ticks++
+	if s.ticks == 1 {
+		s.Buy(tick.BidPrice_1, 3)
+	}
+}
+
+func TestBacktestMarketTrades(t *testing.T) {
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	ticks := make([]TickData, 0)
+	for i := 0; i < 4; i++ {
+		ticks = append(ticks, TickData{
+			Symbol:      "BTCUSDT",
+			UpdatedAt:   timestamppb.New(start.Add(time.Duration(i) * time.Minute)),
+			LastPrice:   100,
+			BidPrice_1:  99,
+			AskPrice_1:  101,
+			BidVolume_1: 10,
+			AskVolume_1: 10,
+		})
+	}
+	repo := &marketTradeTestRepo{
+		memoryRepo: memoryRepo{ticks: map[string][]TickData{"BTCUSDT": ticks}},
+		trades: []MarketTradeData{
+			{Symbol: "BTCUSDT", UpdatedAt: start.Add(30 * time.Second), Price: 100, Volume: 5},
+			{Symbol: "BTCUSDT", UpdatedAt: start.Add(70 * time.Second), Price: 99, Volume: 2},
+			{Symbol: "BTCUSDT", UpdatedAt: start.Add(130 * time.Second), Price: 98.5, Volume: 5},
+		},
+	}
+	cfg := EngineCfg{
+		DataRepo:       repo,
+		Symbol:         "BTCUSDT",
+		Start:          start,
+		End:            start.Add(time.Hour),
+		Capital:        1000,
+		Size:           1,
+		AnnualDays:     365,
+		BackTestingMod: TICK,
+	}
+
+	// 只有报价时买一的挂单不会成交
+	cfg.Strategy = new(marketTradeTestStrategy)
+	result, err := Evaluate(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Trades) != 0 {
+		t.Fatalf("trades without market trades: %+v", result.Trades)
+	}
+
+	cfg.Strategy = new(marketTradeTestStrategy)
+	cfg.MarketTrades = true
+	result, err = Evaluate(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	trades := result.Trades
+	if len(trades) != 2 || trades[0].Volume != 2 || trades[1].Volume != 1 || trades[0].Price != 99 || trades[1].Price != 99 {
+		t.Fatalf("trades: %+v", trades)
+	}
+	if !trades[0].UpdatedAt.AsTime().Equal(start.Add(70*time.Second)) || result.Orders[0].Status != expb.Status_ALL_TRADED {
+		t.Fatalf("trade time: %v orders: %+v", trades[0].UpdatedAt.AsTime(), result.Orders)
+	}
+
+	cfg.DataRepo = &repo.memoryRepo
+	if err = cfg.Check(); err == nil || !strings.Contains(err.Error(), "不支持逐笔成交") {
+		t.Fatalf("check: %v", err)
+	}
+}
+
+func TestBacktestMarketTradesResting(t *testing.T) {
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	ticks := make([]TickData, 0)
+	for i, ask := range []float64{101, 101, 99, 101} {
+		ticks = append(ticks, TickData{
+			Symbol:      "BTCUSDT",
+			UpdatedAt:   timestamppb.New(start.Add(time.Duration(i) * time.Minute)),
+			LastPrice:   100,
+			BidPrice_1:  ask - 2,
+			AskPrice_1:  ask,
+			BidVolume_1: 10,
+			AskVolume_1: 10,
+		})
+	}
+	repo := &marketTradeTestRepo{
+		memoryRepo: memoryRepo{ticks: map[string][]TickData{"BTCUSDT": ticks}},
+		trades: []MarketTradeData{
+			{Symbol: "BTCUSDT", UpdatedAt: start.Add(70 * time.Second), Price: 99, Volume: 2},
+			{Symbol: "BTCUSDT", UpdatedAt: start.Add(150 * time.Second), Price: 97, Volume: 1},
+		},
+	}
+	strategy := new(marketTradeTestStrategy)
+	result, err := Evaluate(EngineCfg{
+		Strategy:       strategy,
+		DataRepo:       repo,
+		Symbol:         "BTCUSDT",
+		Start:          start,
+		End:            start.Add(time.Hour),
+		Capital:        1000,
+		Size:           1,
+		AnnualDays:     365,
+		BackTestingMod: TICK,
+		MarketTrades:   true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 卖一价降到委托价时已挂出的委托不整笔成交，剩余部分等下一笔市场成交
+	trades := result.Trades
+	if len(trades) != 2 || trades[0].Volume != 2 || trades[1].Volume != 1 || !trades[1].UpdatedAt.AsTime().Equal(start.Add(150*time.Second)) {
+		t.Fatalf("trades: %+v", trades)
+	}
+	// 每日收盘价取最后一笔市场成交的价格
+	if daily := result.DailyResults; len(daily) != 1 || daily[0].ClosePrice != 97 {
+		t.Fatalf("daily: %+v", daily)
+	}
+}
+
+func TestFileDataMarketTrades(t *testing.T) {
+	data, err := NewFileData(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	trades := []MarketTradeData{
+		{Symbol: "BTCUSDT", UpdatedAt: start, Price: 100, Volume: 0.5},
+		{Symbol: "BTCUSDT", UpdatedAt: start, Price: 100.5, Volume: 1},
+	}
+	if err = data.SaveMarketTradeData(trades); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := data.GetMarketTradeData("BTCUSDT", 0, start, start.Add(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make([]MarketTradeData, 0)
+	for cur := loaded.Front(); cur != nil; cur = cur.Next() {
+		trade := cur.Value.(MarketTradeData)
+		trade.UpdatedAt = trade.UpdatedAt.UTC()
+		got = append(got, trade)
+	}
+	if !reflect.DeepEqual(got, trades) {
+		t.Fatalf("trades: %+v", got)
+	}
+}
@@ -0,0 +1,50 @@
+package internal
+
+import expb "newgitlab.com/xquant/exchange-protocols/protocols/src/go"
+
+// crossPrice 限价单撮合用的价格
+// 多头订单价格不低于 longCross 时成交，成交价取订单价和 longBest 中较低的一个，空头反之
+type crossPrice struct {
+	longCross  float64
+	shortCross float64
+	longBest   float64
+	shortBest  float64
+}
+
+func barCrossPrice(bar BarData) crossPrice {
+	return crossPrice{
+		longCross:  bar.LowPrice,
+		shortCross: bar.HighPrice,
+		longBest:   bar.OpenPrice,
+		shortBest:  bar.OpenPrice,
+	}
+}
+
+func tickCrossPrice(tick TickData) crossPrice {
+	return crossPrice{
+		longCross:  tick.AskPrice_1,
+		shortCross: tick.BidPrice_1,
+		longBest:   tick.AskPrice_1,
+		shortBest:  tick.BidPrice_1,
+	}
+}
+
+// matchLimitOrder 判断限价单能否成交，返回成交价和仓位变化，回测引擎和模拟盘共用
+func matchLimitOrder(order *OrderData, price crossPrice) (tradePrice, posChange float64, ok bool) {
+	longCross := (order.Direction == expb.Direction_LONG) &&
+		(order.Price >= price.longCross) &&
+		(price.longCross > 0)
+
+	shortCross := (order.Direction == expb.Direction_SHORT) &&
+		(order.Price <= price.shortCross) &&
+		(price.shortCross > 0)
+
+	switch {
+	case longCross:
+		return Min(order.Price, price.longBest), order.Volume, true
+	case shortCross:
+		return Max(order.Price, price.shortBest), -order.Volume, true
+	default:
+		return 0, 0, false
+	}
+}
@@ -0,0 +1,280 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+)
+
+type MonteCarloMethod string
+
+const (
+	// MonteCarloBootstrap 逐日收益有放回抽样
+	MonteCarloBootstrap MonteCarloMethod = "bootstrap"
+	// MonteCarloBlockBootstrap 按连续的块抽样，保留收益的自相关
+	MonteCarloBlockBootstrap MonteCarloMethod = "block"
+	// MonteCarloTradeShuffle 打乱逐笔交易的顺序，最终资金不变，只看路径
+	MonteCarloTradeShuffle MonteCarloMethod = "shuffle"
+)
+
+type MonteCarloSetting struct {
+	Method      MonteCarloMethod
+	Simulations int
+	// 块抽样的块长度，单位为天
+	BlockSize int
+	// 随机种子，为 0 时使用当前时间，实际使用的种子记录在结果中
+	Seed int64
+	// 资金跌破起始资金的该比例视为破产
+	RuinLevel  float64
+	AnnualDays int
+	// 并行数，为 0 时使用 CPU 数
+	Workers int
+}
+
+// DefaultMonteCarloSetting 1000 次逐日收益抽样，资金跌破一半视为破产
+func DefaultMonteCarloSetting() MonteCarloSetting {
+	return MonteCarloSetting{
+		Method:      MonteCarloBootstrap,
+		Simulations: 1000,
+		BlockSize:   5,
+		RuinLevel:   0.5,
+		AnnualDays:  365,
+	}
+}
+
+func (s MonteCarloSetting) Check() error {
+	var errs CheckErrors
+	switch s.Method {
+	case MonteCarloBootstrap, MonteCarloTradeShuffle:
+	case MonteCarloBlockBootstrap:
+		if s.BlockSize <= 0 {
+			errs = append(errs, errors.New("blockSize必须大于0"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("不支持的蒙特卡洛方法: %s", s.Method))
+	}
+	if s.Simulations <= 0 {
+		errs = append(errs, errors.New("simulations必须大于0"))
+	}
+	if s.RuinLevel < 0 || s.RuinLevel >= 1 {
+		errs = append(errs, errors.New("ruinLevel必须在0到1之间"))
+	}
+	if s.AnnualDays <= 0 {
+		errs = append(errs, errors.New("annualDays必须大于0"))
+	}
+	if s.Workers < 0 {
+		errs = append(errs, errors.New("workers不能为负数"))
+	}
+	return errs.Err()
+}
+
+// Distribution 模拟结果的分布
+type Distribution struct {
+	Mean, Std, Min, Max    float64
+	P5, P25, P50, P75, P95 float64
+}
+
+func newDistribution(values []float64) Distribution {
+	if len(values) == 0 {
+		return Distribution{}
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	mean, std := meanStd(sorted)
+	return Distribution{
+		Mean: mean,
+		Std:  std,
+		Min:  sorted[0],
+		Max:  sorted[len(sorted)-1],
+		P5:   percentile(sorted, 5),
+		P25:  percentile(sorted, 25),
+		P50:  percentile(sorted, 50),
+		P75:  percentile(sorted, 75),
+		P95:  percentile(sorted, 95),
+	}
+}
+
+// percentile 已排序数据的百分位数，相邻两个值之间线性插值
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 1 {
+		return sorted[0]
+	}
+	pos := p / 100 * float64(len(sorted)-1)
+	i := int(pos)
+	if i >= len(sorted)-1 {
+		return sorted[len(sorted)-1]
+	}
+	return sorted[i] + (sorted[i+1]-sorted[i])*(pos-float64(i))
+}
+
+// MonteCarloResult 最终资金、最大回撤百分比和 Sharpe 的分布，RiskOfRuin 为破产路径的百分比
+type MonteCarloResult struct {
+	Method      MonteCarloMethod
+	Simulations int
+	Seed        int64
+
+	FinalBalance Distribution
+	MaxDdpercent Distribution
+	SharpeRatio  Distribution
+	RiskOfRuin   float64
+}
+
+type simulatedPath struct {
+	finalBalance float64
+	maxDdpercent float64
+	sharpeRatio  float64
+	ruined       bool
+}
+
+// MonteCarlo 对回测结果重新抽样，多个 goroutine 并行模拟
+// 第 i 次模拟使用 Seed+i 作为种子，同样的种子结果与并行数无关
+func MonteCarlo(result *BacktestResult, setting MonteCarloSetting) (*MonteCarloResult, error) {
+	if err := setting.Check(); err != nil {
+		return nil, err
+	}
+	if setting.Seed == 0 {
+		setting.Seed = time.Now().UnixNano()
+	}
+	workers := setting.Workers
+	if workers == 0 {
+		workers = runtime.NumCPU()
+	}
+
+	var simulate func(r *rand.Rand) simulatedPath
+	switch setting.Method {
+	case MonteCarloTradeShuffle:
+		if len(result.RoundTrips) < 2 {
+			return nil, errors.New("逐笔交易不足，无法模拟")
+		}
+		pnls := make([]float64, 0, len(result.RoundTrips))
+		for _, trip := range result.RoundTrips {
+			pnls = append(pnls, trip.NetPnl)
+		}
+		// 按回测期间的交易频率年化
+		perYear := float64(len(pnls)) / float64(Max(len(result.DailyResults), 1)) * float64(setting.AnnualDays)
+		simulate = func(r *rand.Rand) simulatedPath {
+			shuffled := append([]float64(nil), pnls...)
+			r.Shuffle(len(shuffled), func(i, j int) { shuffled[i], shuffled[j] = shuffled[j], shuffled[i] })
+			return pnlPath(result.Capital, shuffled, setting.RuinLevel, perYear)
+		}
+	default:
+		returns := balanceReturns(result.Capital, result.Balances())
+		if len(returns) < 2 {
+			return nil, errors.New("逐日结果不足，无法模拟")
+		}
+		blockSize := 1
+		if setting.Method == MonteCarloBlockBootstrap {
+			blockSize = Min(setting.BlockSize, len(returns))
+		}
+		simulate = func(r *rand.Rand) simulatedPath {
+			sampled := make([]float64, 0, len(returns))
+			for len(sampled) < len(returns) {
+				start := r.Intn(len(returns) - blockSize + 1)
+				for _, v := range returns[start : start+blockSize] {
+					if len(sampled) == len(returns) {
+						break
+					}
+					sampled = append(sampled, v)
+				}
+			}
+			return returnPath(result.Capital, sampled, setting.RuinLevel, float64(setting.AnnualDays))
+		}
+	}
+
+	paths := make([]simulatedPath, setting.Simulations)
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				paths[i] = simulate(rand.New(rand.NewSource(setting.Seed + int64(i))))
+			}
+		}()
+	}
+	for i := range paths {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	finals := make([]float64, 0, len(paths))
+	drawdowns := make([]float64, 0, len(paths))
+	sharpes := make([]float64, 0, len(paths))
+	ruined := 0
+	for _, path := range paths {
+		finals = append(finals, path.finalBalance)
+		drawdowns = append(drawdowns, path.maxDdpercent)
+		sharpes = append(sharpes, path.sharpeRatio)
+		if path.ruined {
+			ruined++
+		}
+	}
+	return &MonteCarloResult{
+		Method:       setting.Method,
+		Simulations:  setting.Simulations,
+		Seed:         setting.Seed,
+		FinalBalance: newDistribution(finals),
+		MaxDdpercent: newDistribution(drawdowns),
+		SharpeRatio:  newDistribution(sharpes),
+		RiskOfRuin:   float64(ruined) / float64(len(paths)) * 100,
+	}, nil
+}
+
+// pathTracker 沿一条资金路径记录最大回撤和是否破产
+type pathTracker struct {
+	balance, highlevel, ruin float64
+	maxDdpercent             float64
+	ruined                   bool
+}
+
+func newPathTracker(capital, ruinLevel float64) *pathTracker {
+	return &pathTracker{balance: capital, highlevel: capital, ruin: capital * ruinLevel}
+}
+
+func (p *pathTracker) update(balance float64) {
+	p.balance = balance
+	p.highlevel = math.Max(p.highlevel, balance)
+	if p.highlevel > 0 {
+		p.maxDdpercent = math.Min(p.maxDdpercent, (balance-p.highlevel)/p.highlevel*100)
+	}
+	if balance <= p.ruin {
+		p.ruined = true
+	}
+}
+
+func returnPath(capital float64, returns []float64, ruinLevel, annual float64) simulatedPath {
+	tracker := newPathTracker(capital, ruinLevel)
+	for _, r := range returns {
+		tracker.update(tracker.balance * (1 + r))
+	}
+	mean, std := meanStd(returns)
+	return simulatedPath{
+		finalBalance: tracker.balance,
+		maxDdpercent: tracker.maxDdpercent,
+		sharpeRatio:  ratio(mean, std) * math.Sqrt(annual),
+		ruined:       tracker.ruined,
+	}
+}
+
+func pnlPath(capital float64, pnls []float64, ruinLevel, annual float64) simulatedPath {
+	tracker := newPathTracker(capital, ruinLevel)
+	returns := make([]float64, 0, len(pnls))
+	for _, pnl := range pnls {
+		returns = append(returns, ratio(pnl, tracker.balance))
+		tracker.update(tracker.balance + pnl)
+	}
+	mean, std := meanStd(returns)
+	return simulatedPath{
+		finalBalance: tracker.balance,
+		maxDdpercent: tracker.maxDdpercent,
+		sharpeRatio:  ratio(mean, std) * math.Sqrt(annual),
+		ruined:       tracker.ruined,
+	}
+}
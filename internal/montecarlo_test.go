@@ -0,0 +1,104 @@
+package internal
+
+import (
+	"math"
+	"testing"
+)
+
+func newMonteCarloTestResult(pnls ...float64) *BacktestResult {
+	result := &BacktestResult{Capital: 1000}
+	for _, pnl := range pnls {
+		result.DailyResults = append(result.DailyResults, &DailyResult{NetPnl: pnl})
+		result.RoundTrips = append(result.RoundTrips, RoundTrip{NetPnl: pnl})
+	}
+	return result
+}
+
+func TestPercentile(t *testing.T) {
+	sorted := []float64{1, 2, 3, 4, 5}
+	if p := percentile(sorted, 50); p != 3 {
+		t.Fatalf("p50: %v", p)
+	}
+	if p := percentile(sorted, 25); p != 2 {
+		t.Fatalf("p25: %v", p)
+	}
+	if p := percentile(sorted, 95); math.Abs(p-4.8) > 1e-9 {
+		t.Fatalf("p95: %v", p)
+	}
+}
+
+func TestMonteCarlo(t *testing.T) {
+	result := newMonteCarloTestResult(50, -30, 20, -60, 40, 10, -20, 30)
+
+	for _, method := range []MonteCarloMethod{MonteCarloBootstrap, MonteCarloBlockBootstrap, MonteCarloTradeShuffle} {
+		setting := DefaultMonteCarloSetting()
+		setting.Method = method
+		setting.Simulations = 200
+		setting.Seed = 42
+
+		// 同样的种子，结果与并行数无关
+		setting.Workers = 1
+		single, err := MonteCarlo(result, setting)
+		if err != nil {
+			t.Fatal(err)
+		}
+		setting.Workers = 4
+		parallel, err := MonteCarlo(result, setting)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *single != *parallel {
+			t.Fatalf("%s: %+v != %+v", method, single, parallel)
+		}
+
+		d := single.FinalBalance
+		if d.Min > d.P5 || d.P5 > d.P50 || d.P50 > d.P95 || d.P95 > d.Max {
+			t.Fatalf("%s final balance: %+v", method, d)
+		}
+		if single.MaxDdpercent.Max > 0 || single.RiskOfRuin != 0 {
+			t.Fatalf("%s: %+v", method, single)
+		}
+	}
+}
+
+func TestMonteCarloTradeShuffle(t *testing.T) {
+	result := newMonteCarloTestResult(100, -200, 300, -50)
+	setting := DefaultMonteCarloSetting()
+	setting.Method = MonteCarloTradeShuffle
+	setting.Simulations = 100
+	setting.Seed = 1
+
+	mc, err := MonteCarlo(result, setting)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 打乱顺序不改变最终资金，回撤至少是单笔最大亏损
+	if mc.FinalBalance.Min != 1150 || mc.FinalBalance.Max != 1150 {
+		t.Fatalf("final balance: %+v", mc.FinalBalance)
+	}
+	if mc.MaxDdpercent.Max > -200.0/1400*100+1e-9 {
+		t.Fatalf("max ddpercent: %+v", mc.MaxDdpercent)
+	}
+}
+
+func TestMonteCarloRiskOfRuin(t *testing.T) {
+	result := newMonteCarloTestResult(-600, -100, -100)
+	setting := DefaultMonteCarloSetting()
+	setting.Simulations = 50
+	setting.Seed = 1
+
+	mc, err := MonteCarlo(result, setting)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 每天都亏损，所有路径最终都跌破一半资金
+	if mc.RiskOfRuin != 100 {
+		t.Fatalf("risk of ruin: %v", mc.RiskOfRuin)
+	}
+
+	setting.Method = "unknown"
+	setting.Simulations = 0
+	if _, err = MonteCarlo(result, setting); err == nil || len(err.(CheckErrors)) != 2 {
+		t.Fatalf("err: %v", err)
+	}
+}
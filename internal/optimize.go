@@ -0,0 +1,141 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+)
+
+// StrategyFactory 用参数创建策略，参数优化时每组参数创建一个新的策略
+type StrategyFactory func(params map[string]float64) (Strategy, error)
+
+type OptimizationSetting struct {
+	// 每个参数的候选值
+	Params map[string][]float64
+	// 排序用的统计指标，对应 calculateStatistics 返回的键
+	Target string
+}
+
+func (s *OptimizationSetting) AddParameter(name string, start, end, step float64) error {
+	if step <= 0 || end < start {
+		return fmt.Errorf("参数%s的范围错误", name)
+	}
+	if s.Params == nil {
+		s.Params = make(map[string][]float64)
+	}
+	values := make([]float64, 0)
+	for i := 0; ; i++ {
+		value := start + float64(i)*step
+		if value > end+step*1e-9 {
+			break
+		}
+		values = append(values, value)
+	}
+	s.Params[name] = values
+	return nil
+}
+
+// Combinations 所有参数组合，按参数名排序后展开，保证顺序固定
+func (s *OptimizationSetting) Combinations() []map[string]float64 {
+	names := make([]string, 0, len(s.Params))
+	for name := range s.Params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	combinations := []map[string]float64{{}}
+	for _, name := range names {
+		next := make([]map[string]float64, 0, len(combinations)*len(s.Params[name]))
+		for _, combination := range combinations {
+			for _, value := range s.Params[name] {
+				params := make(map[string]float64, len(combination)+1)
+				for k, v := range combination {
+					params[k] = v
+				}
+				params[name] = value
+				next = append(next, params)
+			}
+		}
+		combinations = next
+	}
+	return combinations
+}
+
+type OptimizationResult struct {
+	Params     map[string]float64
+	Target     float64
+	Statistics map[string]any
+}
+
+// Optimize 穷举参数组合回测，历史数据只加载一次，结果按目标指标从大到小排序
+func Optimize(cfg EngineCfg, factory StrategyFactory, setting OptimizationSetting) ([]OptimizationResult, error) {
+	if setting.Target == "" {
+		return nil, errors.New("优化目标不能为空")
+	}
+	combinations := setting.Combinations()
+	if len(combinations) == 0 || len(setting.Params) == 0 {
+		return nil, errors.New("优化参数不能为空")
+	}
+
+	var loaded *BackTestingEngine
+	results := make([]OptimizationResult, 0, len(combinations))
+	for i, params := range combinations {
+		strategy, err := factory(params)
+		if err != nil {
+			return nil, err
+		}
+
+		runCfg := cfg
+		runCfg.Strategy = strategy
+		// 每次回测使用新的事件引擎，不注册日志输出
+		runCfg.EventEngine = NewEventEngine(0)
+
+		engine, err := newEngine(runCfg)
+		if err != nil {
+			return nil, err
+		}
+		if loaded == nil {
+			if err = engine.loadData(); err != nil {
+				return nil, err
+			}
+			loaded = engine
+		} else {
+			engine.shareData(loaded)
+		}
+
+		statistics := engine.run().Statistics
+		target, ok := toFloat(statistics[setting.Target])
+		if !ok {
+			return nil, fmt.Errorf("不支持的优化目标: %s", setting.Target)
+		}
+		log.Printf("参数优化 %d/%d: %v %s=%.4f\n", i+1, len(combinations), params, setting.Target, target)
+
+		results = append(results, OptimizationResult{Params: params, Target: target, Statistics: statistics})
+	}
+
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Target > results[j].Target })
+	return results, nil
+}
+
+// shareData 使用另一个引擎已加载的历史数据，回放时只读
+func (b *BackTestingEngine) shareData(from *BackTestingEngine) {
+	b.End = from.End
+	b.historyData = from.historyData
+	b.legHistory = from.legHistory
+	b.benchmarkPrices = from.benchmarkPrices
+	for symbol := range from.legResults {
+		b.legResults[symbol] = make(map[string]*DailyResult)
+	}
+}
+
+func toFloat(v any) (float64, bool) {
+	switch value := v.(type) {
+	case float64:
+		return value, true
+	case int:
+		return float64(value), true
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,126 @@
+package internal
+
+import (
+	"testing"
+	"time"
+)
+
+func TestOptimizationCombinations(t *testing.T) {
+	var setting OptimizationSetting
+	if err := setting.AddParameter("window", 10, 30, 10); err != nil {
+		t.Fatal(err)
+	}
+	if err := setting.AddParameter("dev", 1, 2, 0.5); err != nil {
+		t.Fatal(err)
+	}
+	if err := setting.AddParameter("volume", 1, 0, 1); err == nil {
+		t.Fatal("expected range error")
+	}
+
+	combinations := setting.Combinations()
+	if len(combinations) != 9 {
+		t.Fatalf("combinations: %d", len(combinations))
+	}
+	if combinations[0]["dev"] != 1 || combinations[0]["window"] != 10 {
+		t.Fatalf("first: %v", combinations[0])
+	}
+	if combinations[8]["dev"] != 2 || combinations[8]["window"] != 30 {
+		t.Fatalf("last: %v", combinations[8])
+	}
+}
+
+type optimizeTestStrategy struct {
+	StrategyTemplate
+	hold float64
+	bars float64
+}
+
+func (s *optimizeTestStrategy) OnBar(bar BarData) {
+	s.bars++
+	switch s.bars {
+	case 1:
+		s.Buy(bar.ClosePrice*2, 1)
+	case 1 + s.hold:
+		s.Sell(bar.ClosePrice/2, 1)
+	}
+}
+
+func TestOptimize(t *testing.T) {
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	closes := []float64{100, 100, 130, 90, 110, 110}
+	bars := make([]BarData, 0, len(closes))
+	for i, price := range closes {
+		bars = append(bars, newTestBar("BTCUSDT", start.Add(time.Duration(i)*day), price, price, price, price))
+	}
+
+	setting := OptimizationSetting{Params: map[string][]float64{"hold": {1, 2, 3}}, Target: "total_net_pnl"}
+	results, err := Optimize(EngineCfg{
+		DataRepo: &memoryRepo{bars: map[string][]BarData{"BTCUSDT": bars}},
+		Symbol:   "BTCUSDT",
+		Start:    start,
+		End:      start.Add(6 * day),
+		Interval: day,
+		Capital:  1000,
+		Size:     1,
+	}, func(params map[string]float64) (Strategy, error) {
+		return &optimizeTestStrategy{hold: params["hold"]}, nil
+	}, setting)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 第二天开盘100买入，持有1、2、3根K线后分别以130、90、110卖出
+	if len(results) != 3 {
+		t.Fatalf("results: %d", len(results))
+	}
+	want := []struct{ hold, pnl float64 }{{1, 30}, {3, 10}, {2, -10}}
+	for i, w := range want {
+		if results[i].Params["hold"] != w.hold || results[i].Target != w.pnl {
+			t.Fatalf("result %d: %v %v", i, results[i].Params, results[i].Target)
+		}
+	}
+}
+
+// 复用第一次回测加载的数据时基准价格也要共享，每次回测的基准指标相同
+func TestOptimizeBenchmark(t *testing.T) {
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	bars := map[string][]BarData{}
+	for i, price := range []float64{100, 100, 130, 90, 110, 110} {
+		date := start.Add(time.Duration(i) * day)
+		bars["BTCUSDT"] = append(bars["BTCUSDT"], newTestBar("BTCUSDT", date, price, price, price, price))
+		bars["ETHUSDT"] = append(bars["ETHUSDT"], newTestBar("ETHUSDT", date, 10+float64(i), 10+float64(i), 10+float64(i), 10+float64(i)))
+	}
+
+	setting := OptimizationSetting{Params: map[string][]float64{"hold": {1, 2, 3}}, Target: "total_net_pnl"}
+	results, err := Optimize(EngineCfg{
+		DataRepo:   &memoryRepo{bars: bars},
+		Symbol:     "BTCUSDT",
+		Start:      start,
+		End:        start.Add(6 * day),
+		Interval:   day,
+		Capital:    1000,
+		Size:       1,
+		AnnualDays: 365,
+		Benchmark:  "ETHUSDT",
+	}, func(params map[string]float64) (Strategy, error) {
+		return &optimizeTestStrategy{hold: params["hold"]}, nil
+	}, setting)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(results) != 3 {
+		t.Fatalf("results: %d", len(results))
+	}
+	want := results[0].Statistics["benchmark_return"]
+	if r, ok := want.(float64); !ok || r <= 0 {
+		t.Fatalf("benchmark return: %v", want)
+	}
+	for _, result := range results[1:] {
+		if result.Statistics["benchmark_return"] != want {
+			t.Fatalf("%v benchmark return: %v != %v", result.Params, result.Statistics["benchmark_return"], want)
+		}
+	}
+}
@@ -0,0 +1,234 @@
+package internal
+
+import (
+	"container/list"
+	"sort"
+	"time"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+	expb "newgitlab.com/xquant/exchange-protocols/protocols/src/go"
+)
+
+type BookLevel struct {
+	Price  float64
+	Volume float64
+}
+
+// DepthData L2 盘口，Snapshot 为 true 时是全量快照，否则是增量更新，数量为 0 表示删除该档
+// LastPrice、LastVolume 为与上一条盘口之间的成交，用于估算排队位置
+type DepthData struct {
+	Symbol     string
+	UpdatedAt  time.Time
+	Snapshot   bool
+	Bids       []BookLevel
+	Asks       []BookLevel
+	LastPrice  float64
+	LastVolume float64
+}
+
+// DepthRepo 能提供 L2 盘口的数据源，开启 OrderBook 时 tick 回测优先使用
+type DepthRepo interface {
+	GetDepthData(symbol string, exchange Exchange, start, end time.Time) (*list.List, error)
+}
+
+// OrderBook 按价格排序的盘口，买盘从高到低，卖盘从低到高
+type OrderBook struct {
+	Bids []BookLevel
+	Asks []BookLevel
+}
+
+// SetTick 用 tick 的五档行情作为快照
+func (b *OrderBook) SetTick(tick TickData) {
+	b.Bids = tickLevels(
+		[]float64{tick.BidPrice_1, tick.BidPrice_2, tick.BidPrice_3, tick.BidPrice_4, tick.BidPrice_5},
+		[]float64{tick.BidVolume_1, tick.BidVolume_2, tick.BidVolume_3, tick.BidVolume_4, tick.BidVolume_5},
+	)
+	b.Asks = tickLevels(
+		[]float64{tick.AskPrice_1, tick.AskPrice_2, tick.AskPrice_3, tick.AskPrice_4, tick.AskPrice_5},
+		[]float64{tick.AskVolume_1, tick.AskVolume_2, tick.AskVolume_3, tick.AskVolume_4, tick.AskVolume_5},
+	)
+}
+
+func tickLevels(prices, volumes []float64) []BookLevel {
+	levels := make([]BookLevel, 0, len(prices))
+	for i, price := range prices {
+		if price > 0 && volumes[i] > 0 {
+			levels = append(levels, BookLevel{price, volumes[i]})
+		}
+	}
+	return levels
+}
+
+func (b *OrderBook) Apply(depth DepthData) {
+	if depth.Snapshot {
+		b.Bids = b.Bids[:0]
+		b.Asks = b.Asks[:0]
+	}
+	for _, level := range depth.Bids {
+		b.Bids = updateLevel(b.Bids, level, true)
+	}
+	for _, level := range depth.Asks {
+		b.Asks = updateLevel(b.Asks, level, false)
+	}
+}
+
+// updateLevel 更新或删除一档，保持排序
+func updateLevel(levels []BookLevel, level BookLevel, desc bool) []BookLevel {
+	i := sort.Search(len(levels), func(i int) bool {
+		if desc {
+			return levels[i].Price <= level.Price
+		}
+		return levels[i].Price >= level.Price
+	})
+	found := i < len(levels) && levels[i].Price == level.Price
+	switch {
+	case level.Volume <= 0 && found:
+		return append(levels[:i], levels[i+1:]...)
+	case level.Volume <= 0:
+		return levels
+	case found:
+		levels[i].Volume = level.Volume
+		return levels
+	default:
+		levels = append(levels, BookLevel{})
+		copy(levels[i+1:], levels[i:])
+		levels[i] = level
+		return levels
+	}
+}
+
+// Tick 盘口前五档转成 tick 推给策略
+func (b *OrderBook) Tick(symbol string, datetime time.Time, lastPrice, lastVolume float64) TickData {
+	tick := TickData{
+		Symbol:     symbol,
+		UpdatedAt:  timestamppb.New(datetime),
+		LastPrice:  lastPrice,
+		LastVolume: lastVolume,
+	}
+	bidPrices := []*float64{&tick.BidPrice_1, &tick.BidPrice_2, &tick.BidPrice_3, &tick.BidPrice_4, &tick.BidPrice_5}
+	bidVolumes := []*float64{&tick.BidVolume_1, &tick.BidVolume_2, &tick.BidVolume_3, &tick.BidVolume_4, &tick.BidVolume_5}
+	askPrices := []*float64{&tick.AskPrice_1, &tick.AskPrice_2, &tick.AskPrice_3, &tick.AskPrice_4, &tick.AskPrice_5}
+	askVolumes := []*float64{&tick.AskVolume_1, &tick.AskVolume_2, &tick.AskVolume_3, &tick.AskVolume_4, &tick.AskVolume_5}
+	for i := 0; i < 5; i++ {
+		if i < len(b.Bids) {
+			*bidPrices[i], *bidVolumes[i] = b.Bids[i].Price, b.Bids[i].Volume
+		}
+		if i < len(b.Asks) {
+			*askPrices[i], *askVolumes[i] = b.Asks[i].Price, b.Asks[i].Volume
+		}
+	}
+	return tick
+}
+
+func (b *OrderBook) clone() OrderBook {
+	return OrderBook{
+		Bids: append([]BookLevel(nil), b.Bids...),
+		Asks: append([]BookLevel(nil), b.Asks...),
+	}
+}
+
+// queuePosition 被动委托前面排队的数量，placed 为 false 时委托还没有进入盘口
+type queuePosition struct {
+	placed bool
+	ahead  float64
+}
+
+type bookFill struct {
+	price  float64
+	volume float64
+}
+
+// matchBook 按盘口撮合一个委托，book 中被吃掉的量会扣除，同一时刻的多个委托不会重复成交
+// 新委托先逐档吃掉对手盘，剩余部分按盘口同价位的挂单量排队；
+// 之后每次更新先用成交量消耗前面的排队，再按同价位挂单量的减少修正，排队量耗尽后的成交才算我们的
+func matchBook(order *OrderData, book *OrderBook, queue *queuePosition, lastPrice, lastVolume float64) []bookFill {
+	long := order.Direction == expb.Direction_LONG
+	remaining := order.Volume - order.Traded
+	crosses := func(price float64) bool {
+		if long {
+			return price <= order.Price
+		}
+		return price >= order.Price
+	}
+	opposite, same := &book.Asks, &book.Bids
+	if !long {
+		opposite, same = &book.Bids, &book.Asks
+	}
+
+	var fills []bookFill
+	// 新委托按对手盘价格成交，已挂在盘口上的委托被穿价时按委托价成交
+	for i := range *opposite {
+		level := &(*opposite)[i]
+		if remaining <= 0 || !crosses(level.Price) {
+			break
+		}
+		volume := Min(remaining, level.Volume)
+		if volume <= 0 {
+			continue
+		}
+		price := level.Price
+		if queue.placed {
+			price = order.Price
+		}
+		fills = append(fills, bookFill{price, volume})
+		level.Volume -= volume
+		remaining -= volume
+	}
+	if remaining <= 0 {
+		return fills
+	}
+
+	levelVolume, visible := sameSideVolume(*same, order.Price, long)
+	if !queue.placed {
+		queue.placed = true
+		queue.ahead = levelVolume
+		return fills
+	}
+
+	// 成交价穿过委托价时同价位已全部成交
+	if lastVolume > 0 && lastPrice > 0 {
+		switch {
+		case (long && lastPrice < order.Price) || (!long && lastPrice > order.Price):
+			fills = append(fills, bookFill{order.Price, remaining})
+			queue.ahead = 0
+			return fills
+		case lastPrice == order.Price:
+			traded := lastVolume - queue.ahead
+			queue.ahead = Max(queue.ahead-lastVolume, 0)
+			if traded > 0 {
+				fills = append(fills, bookFill{order.Price, Min(traded, remaining)})
+			}
+		}
+	}
+	// 同价位挂单减少视为前面的撤单或成交，超出可见档位时无法判断，保持不变
+	if visible {
+		queue.ahead = Min(queue.ahead, levelVolume)
+	}
+	return fills
+}
+
+// sameSideVolume 同方向盘口在 price 上的挂单量，price 在可见档位之外时 visible 为 false
+func sameSideVolume(levels []BookLevel, price float64, desc bool) (volume float64, visible bool) {
+	for _, level := range levels {
+		if level.Price == price {
+			return level.Volume, true
+		}
+		if (desc && level.Price < price) || (!desc && level.Price > price) {
+			return 0, true
+		}
+	}
+	return 0, false
+}
+
+// updateLastVolume tick 没有逐笔成交量时用累计成交量的变化代替，回放逐笔成交时由成交数据撮合
+func (b *BackTestingEngine) updateLastVolume(tick TickData) {
+	b.lastPrice = tick.LastPrice
+	b.lastVolume = tick.LastVolume
+	if b.lastVolume == 0 && b.preVolume > 0 && tick.Volume > b.preVolume {
+		b.lastVolume = tick.Volume - b.preVolume
+	}
+	b.preVolume = tick.Volume
+	if b.MarketTrades {
+		b.lastVolume = 0
+	}
+}
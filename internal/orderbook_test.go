@@ -0,0 +1,184 @@
+package internal
+
+import (
+	"container/list"
+	"reflect"
+	"testing"
+	"time"
+
+	expb "newgitlab.com/xquant/exchange-protocols/protocols/src/go"
+)
+
+func TestOrderBookApply(t *testing.T) {
+	var book OrderBook
+	book.Apply(DepthData{
+		Snapshot: true,
+		Bids:     []BookLevel{{99, 5}, {98, 3}},
+		Asks:     []BookLevel{{101, 2}, {102, 4}},
+	})
+	book.Apply(DepthData{
+		Bids: []BookLevel{{100, 1}, {98, 0}},
+		Asks: []BookLevel{{101, 6}, {103, 1}},
+	})
+
+	if want := []BookLevel{{100, 1}, {99, 5}}; !reflect.DeepEqual(book.Bids, want) {
+		t.Fatalf("bids: %v", book.Bids)
+	}
+	if want := []BookLevel{{101, 6}, {102, 4}, {103, 1}}; !reflect.DeepEqual(book.Asks, want) {
+		t.Fatalf("asks: %v", book.Asks)
+	}
+
+	tick := book.Tick("BTCUSDT", time.Now(), 100.5, 2)
+	if tick.BidPrice_1 != 100 || tick.AskPrice_3 != 103 || tick.AskVolume_1 != 6 || tick.BidPrice_3 != 0 {
+		t.Fatalf("tick: %+v", tick)
+	}
+
+	book.Apply(DepthData{Snapshot: true, Asks: []BookLevel{{105, 1}}})
+	if len(book.Bids) != 0 || len(book.Asks) != 1 {
+		t.Fatalf("snapshot: %+v", book)
+	}
+}
+
+func TestMatchBook(t *testing.T) {
+	// 新委托逐档吃掉对手盘，剩余部分挂在盘口上
+	book := OrderBook{
+		Bids: []BookLevel{{99, 3}},
+		Asks: []BookLevel{{100, 2}, {101, 2}, {102, 5}},
+	}
+	order := &OrderData{Direction: expb.Direction_LONG, Price: 101, Volume: 5}
+	queue := new(queuePosition)
+	fills := matchBook(order, &book, queue, 0, 0)
+	if want := []bookFill{{100, 2}, {101, 2}}; !reflect.DeepEqual(fills, want) {
+		t.Fatalf("fills: %v", fills)
+	}
+	if book.Asks[0].Volume != 0 || book.Asks[1].Volume != 0 || !queue.placed || queue.ahead != 0 {
+		t.Fatalf("book: %+v queue: %+v", book, queue)
+	}
+
+	// 被动委托排在同价位 10 手之后
+	order = &OrderData{Direction: expb.Direction_LONG, Price: 99, Volume: 3}
+	queue = new(queuePosition)
+	steps := []struct {
+		bid                   float64
+		lastPrice, lastVolume float64
+		traded                float64
+		ahead                 float64
+	}{
+		{10, 0, 0, 0, 10},
+		{6, 99, 4, 0, 6},
+		{4, 0, 0, 0, 4},
+		{0, 99, 6, 2, 0},
+		{0, 98, 1, 3, 0},
+	}
+	for i, step := range steps {
+		book := OrderBook{Bids: []BookLevel{{99, step.bid}, {98, 10}}, Asks: []BookLevel{{100, 10}}}
+		for _, fill := range matchBook(order, &book, queue, step.lastPrice, step.lastVolume) {
+			if fill.price != 99 {
+				t.Fatalf("step %d fill: %+v", i, fill)
+			}
+			order.Traded += fill.volume
+		}
+		if order.Traded != step.traded || queue.ahead != step.ahead {
+			t.Fatalf("step %d traded: %v ahead: %v", i, order.Traded, queue.ahead)
+		}
+	}
+}
+
+type depthTestRepo struct {
+	memoryRepo
+	depths []DepthData
+}
+
+func (d *depthTestRepo) GetDepthData(_ string, _ Exchange, start, end time.Time) (*list.List, error) {
+	l := list.New()
+	for _, depth := range d.depths {
+		if !depth.UpdatedAt.Before(start) && !depth.UpdatedAt.After(end) {
+			l.PushBack(depth)
+		}
+	}
+	return l, nil
+}
+
+type orderBookTestStrategy struct {
+	StrategyTemplate
+	ticks  int
+	orders []OrderData
+}
+
+func (s *orderBookTestStrategy) OnTick(tick TickData) {
+	s.ticks++
+	if s.ticks == 1 {
+		s.Buy(tick.AskPrice_2, 3)
+	}
+}
+
+func (s *orderBookTestStrategy) OnOrder(order OrderData) {
+	s.orders = append(s.orders, order)
+}
+
+func TestBacktestOrderBook(t *testing.T) {
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	repo := &depthTestRepo{depths: []DepthData{
+		{Symbol: "BTCUSDT", UpdatedAt: start, Snapshot: true,
+			Bids: []BookLevel{{99, 5}}, Asks: []BookLevel{{100, 1}, {101, 1}}},
+		// 卖一增加到 2 手，委托吃掉 100 和 101 两档后还剩 1 手在 101 排队
+		{Symbol: "BTCUSDT", UpdatedAt: start.Add(time.Second), Asks: []BookLevel{{100, 1}}},
+		{Symbol: "BTCUSDT", UpdatedAt: start.Add(2 * time.Second), Bids: []BookLevel{{101, 0}}, LastPrice: 100.5, LastVolume: 1},
+		{Symbol: "BTCUSDT", UpdatedAt: start.Add(3 * time.Second)},
+	}}
+
+	strategy := new(orderBookTestStrategy)
+	result, err := Evaluate(EngineCfg{
+		Strategy:       strategy,
+		DataRepo:       repo,
+		Symbol:         "BTCUSDT",
+		Start:          start,
+		End:            start.Add(time.Minute),
+		Capital:        1000,
+		Size:           1,
+		AnnualDays:     365,
+		BackTestingMod: TICK,
+		OrderBook:      true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	trades := result.Trades
+	if len(trades) != 3 || trades[0].Price != 100 || trades[1].Price != 101 || trades[2].Price != 101 {
+		t.Fatalf("trades: %+v", trades)
+	}
+	if len(strategy.orders) != 3 || strategy.orders[0].Status != expb.Status_PART_TRADED ||
+		strategy.orders[2].Status != expb.Status_ALL_TRADED {
+		t.Fatalf("orders: %+v", strategy.orders)
+	}
+}
+
+func TestFileDataDepth(t *testing.T) {
+	data, err := NewFileData(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	depths := []DepthData{
+		{Symbol: "BTCUSDT", UpdatedAt: start, Snapshot: true, Bids: []BookLevel{{99, 5}, {98.5, 1}}, Asks: []BookLevel{{100, 1}}},
+		{Symbol: "BTCUSDT", UpdatedAt: start, Asks: []BookLevel{{100, 0}}, LastPrice: 100, LastVolume: 1},
+	}
+	if err = data.SaveDepthData(depths); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := data.GetDepthData("BTCUSDT", 0, start, start.Add(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make([]DepthData, 0)
+	for cur := loaded.Front(); cur != nil; cur = cur.Next() {
+		depth := cur.Value.(DepthData)
+		depth.UpdatedAt = depth.UpdatedAt.UTC()
+		got = append(got, depth)
+	}
+	if !reflect.DeepEqual(got, depths) {
+		t.Fatalf("depths: %+v", got)
+	}
+}
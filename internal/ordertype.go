@@ -0,0 +1,102 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	expb "newgitlab.com/xquant/exchange-protocols/protocols/src/go"
+)
+
+// OrderType 委托类型，零值为限价单
+type OrderType int
+
+const (
+	LIMIT OrderType = iota
+	// MARKET 市价单忽略委托价，按对手价成交，未成交部分撤销
+	MARKET
+)
+
+// TimeInForce 委托的有效方式，与币安合约一致，零值为 GTC
+type TimeInForce int
+
+const (
+	// GTC 成交为止
+	GTC TimeInForce = iota
+	// IOC 立即成交，剩余部分撤销
+	IOC
+	// FOK 立即全部成交，否则全部撤销
+	FOK
+	// GTX 只做 maker（post-only），会立即成交时拒绝
+	GTX
+)
+
+func (r OrderRequest) check() error {
+	switch r.Type {
+	case LIMIT, MARKET:
+	default:
+		return fmt.Errorf("不支持的委托类型: %d", r.Type)
+	}
+	switch r.TimeInForce {
+	case GTC, IOC, FOK, GTX:
+	default:
+		return fmt.Errorf("不支持的委托有效方式: %d", r.TimeInForce)
+	}
+	if r.Type == MARKET && r.TimeInForce == GTX {
+		return errors.New("市价单不能设置postOnly")
+	}
+	return nil
+}
+
+// immediate 只在到达后的第一次撮合中成交，剩余部分撤销
+func (r OrderRequest) immediate() bool {
+	return r.Type == MARKET || r.TimeInForce == IOC || r.TimeInForce == FOK
+}
+
+// marketable 市价单换成一定能成交的价格，用于按限价单的逻辑撮合
+func marketable(order *OrderData, typ OrderType) *OrderData {
+	if typ != MARKET {
+		return order
+	}
+	o := *order
+	if o.Direction == expb.Direction_LONG {
+		o.Price = math.MaxFloat64
+	} else {
+		o.Price = 0
+	}
+	return &o
+}
+
+// matchOrder 按委托类型撮合，市价单按对手价成交
+func matchOrder(order *OrderData, typ OrderType, price crossPrice) (tradePrice, posChange float64, ok bool) {
+	return matchLimitOrder(marketable(order, typ), price)
+}
+
+type quote struct {
+	bid, ask float64
+}
+
+// barQuote K线没有盘口，买卖价都取收盘价
+func barQuote(bar BarData) quote {
+	return quote{bar.ClosePrice, bar.ClosePrice}
+}
+
+func tickQuote(tick TickData) quote {
+	return quote{tick.BidPrice_1, tick.AskPrice_1}
+}
+
+// crosses 委托价是否会与当前盘口立即成交，没有对手价时不会成交
+func (q quote) crosses(direction expb.Direction, price float64) bool {
+	if direction == expb.Direction_LONG {
+		return q.ask > 0 && price >= q.ask
+	}
+	return q.bid > 0 && price <= q.bid
+}
+
+// reduceOnlyVolume 只减仓委托最多能成交的数量，pos 为净持仓，方向相同或没有持仓时为 0
+func reduceOnlyVolume(direction expb.Direction, volume, pos float64) float64 {
+	if signedVolume(direction, 1)*pos >= 0 {
+		return 0
+	}
+	return Min(volume, math.Abs(pos))
+}
@@ -0,0 +1,200 @@
+package internal
+
+import (
+	"testing"
+	"time"
+
+	expb "newgitlab.com/xquant/exchange-protocols/protocols/src/go"
+)
+
+func TestOrderRequestCheck(t *testing.T) {
+	if err := (OrderRequest{Type: MARKET, TimeInForce: IOC}).check(); err != nil {
+		t.Fatal(err)
+	}
+	for _, req := range []OrderRequest{{Type: MARKET, TimeInForce: GTX}, {Type: 5}, {TimeInForce: 9}} {
+		if err := req.check(); err == nil {
+			t.Fatalf("expect error: %+v", req)
+		}
+	}
+
+	if v := reduceOnlyVolume(expb.Direction_SHORT, 5, 2); v != 2 {
+		t.Fatalf("clip: %v", v)
+	}
+	if v := reduceOnlyVolume(expb.Direction_LONG, 5, 2); v != 0 {
+		t.Fatalf("increase: %v", v)
+	}
+	if v := reduceOnlyVolume(expb.Direction_LONG, 1, -3); v != 1 {
+		t.Fatalf("cover: %v", v)
+	}
+
+	q := quote{bid: 99, ask: 101}
+	if !q.crosses(expb.Direction_LONG, 101) || q.crosses(expb.Direction_LONG, 100) || !q.crosses(expb.Direction_SHORT, 99) {
+		t.Fatal("crosses")
+	}
+}
+
+type orderTypeTestStrategy struct {
+	StrategyTemplate
+	onBar  func(s *orderTypeTestStrategy, bar BarData)
+	bars   int
+	orders map[string]OrderData
+}
+
+func (s *orderTypeTestStrategy) OnBar(bar BarData) {
+	s.bars++
+	s.onBar(s, bar)
+}
+
+func (s *orderTypeTestStrategy) OnOrder(order OrderData) {
+	s.orders[order.OrderNo] = order
+}
+
+func TestBacktestOrderTypes(t *testing.T) {
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	bars := []BarData{
+		newTestBar("BTCUSDT", start, 100, 100, 100, 100),
+		newTestBar("BTCUSDT", start.Add(time.Hour), 102, 103, 98, 100),
+		newTestBar("BTCUSDT", start.Add(2*time.Hour), 100, 101, 99, 100),
+		newTestBar("BTCUSDT", start.Add(3*time.Hour), 100, 100, 100, 100),
+	}
+
+	var market, ioc, gtx, crossing, increase, reduce string
+	strategy := &orderTypeTestStrategy{orders: make(map[string]OrderData), onBar: func(s *orderTypeTestStrategy, bar BarData) {
+		switch s.bars {
+		case 1:
+			market = s.BuyMarket(1)
+			ioc = s.SendOrder(OrderRequest{Direction: expb.Direction_LONG, Price: 50, Volume: 1, TimeInForce: IOC})
+			gtx = s.SendOrder(OrderRequest{Direction: expb.Direction_LONG, Price: 99, Volume: 1, TimeInForce: GTX})
+			crossing = s.SendOrder(OrderRequest{Direction: expb.Direction_LONG, Price: 100, Volume: 1, TimeInForce: GTX})
+			increase = s.SendOrder(OrderRequest{Direction: expb.Direction_SHORT, Price: 100, Volume: 1, ReduceOnly: true})
+		case 2:
+			// 持仓为市价单和 post-only 委托成交的 2 手
+			reduce = s.SendOrder(OrderRequest{Direction: expb.Direction_SHORT, Price: 100, Volume: 5, ReduceOnly: true})
+		}
+	}}
+	result, err := Evaluate(EngineCfg{
+		Strategy:   strategy,
+		DataRepo:   &memoryRepo{bars: map[string][]BarData{"BTCUSDT": bars}},
+		Symbol:     "BTCUSDT",
+		Start:      start,
+		End:        start.Add(4 * time.Hour),
+		Interval:   time.Hour,
+		Capital:    1000,
+		Size:       1,
+		AnnualDays: 365,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status := func(orderNo string) expb.Status { return strategy.orders[orderNo].Status }
+	if status(market) != expb.Status_ALL_TRADED || status(ioc) != expb.Status_CANCELLED || status(gtx) != expb.Status_ALL_TRADED {
+		t.Fatalf("orders: %+v", strategy.orders)
+	}
+	if status(crossing) != expb.Status_REJECTED || status(increase) != expb.Status_REJECTED {
+		t.Fatalf("orders: %+v", strategy.orders)
+	}
+	if order := strategy.orders[reduce]; order.Status != expb.Status_ALL_TRADED || order.Volume != 2 {
+		t.Fatalf("reduce only: %+v", order)
+	}
+
+	trades := result.Trades
+	if len(trades) != 3 || trades[0].Price != 102 || trades[1].Price != 99 || trades[2].Volume != 2 {
+		t.Fatalf("trades: %+v", trades)
+	}
+}
+
+type fokTestStrategy struct {
+	StrategyTemplate
+	ticks  int
+	orders map[string]OrderData
+}
+
+func (s *fokTestStrategy) OnTick(tick TickData) {
+	s.ticks++
+	if s.ticks == 1 {
+		s.SendOrder(OrderRequest{Direction: expb.Direction_LONG, Price: 101, Volume: 3, TimeInForce: FOK})
+		s.SendOrder(OrderRequest{Direction: expb.Direction_LONG, Price: 101, Volume: 2, TimeInForce: FOK})
+	}
+}
+
+func (s *fokTestStrategy) OnOrder(order OrderData) {
+	s.orders[order.OrderNo] = order
+}
+
+func TestBacktestOrderBookFOK(t *testing.T) {
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	repo := &depthTestRepo{depths: []DepthData{
+		{Symbol: "BTCUSDT", UpdatedAt: start, Snapshot: true,
+			Bids: []BookLevel{{99, 5}}, Asks: []BookLevel{{100, 1}, {101, 1}}},
+		{Symbol: "BTCUSDT", UpdatedAt: start.Add(time.Second)},
+		{Symbol: "BTCUSDT", UpdatedAt: start.Add(2 * time.Second)},
+	}}
+
+	strategy := &fokTestStrategy{orders: make(map[string]OrderData)}
+	result, err := Evaluate(EngineCfg{
+		Strategy:       strategy,
+		DataRepo:       repo,
+		Symbol:         "BTCUSDT",
+		Start:          start,
+		End:            start.Add(time.Minute),
+		Capital:        1000,
+		Size:           1,
+		AnnualDays:     365,
+		BackTestingMod: TICK,
+		OrderBook:      true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 盘口只有 2 手，3 手的 FOK 全部撤销，2 手的全部成交
+	if strategy.orders["1"].Status != expb.Status_CANCELLED || strategy.orders["1"].Traded != 0 {
+		t.Fatalf("order 1: %+v", strategy.orders["1"])
+	}
+	if strategy.orders["2"].Status != expb.Status_ALL_TRADED || len(result.Trades) != 2 {
+		t.Fatalf("order 2: %+v trades: %+v", strategy.orders["2"], result.Trades)
+	}
+}
+
+func TestPaperOrderTypes(t *testing.T) {
+	events := NewEventEngine(0)
+	gateway := NewPaperGateway(new(fakeMarketGateway), 1000, 0, 1)
+	if err := gateway.Connect(events); err != nil {
+		t.Fatal(err)
+	}
+	orders := make(map[string]OrderData)
+	events.Register(EventOrder, func(event Event) {
+		order := event.Data.(OrderData)
+		orders[order.OrderNo] = order
+	})
+
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	events.Put(Event{Type: EventBar, Data: newTestBar("BTCUSDT", start, 100, 100, 100, 100)})
+
+	if _, err := gateway.SendOrder(OrderRequest{Symbol: "BTCUSDT", Direction: expb.Direction_LONG, Price: 100, Volume: 1, TimeInForce: GTX}); err == nil {
+		t.Fatal("post only crossed")
+	}
+	if _, err := gateway.SendOrder(OrderRequest{Symbol: "BTCUSDT", Direction: expb.Direction_SHORT, Price: 100, Volume: 1, ReduceOnly: true}); err == nil {
+		t.Fatal("reduce only increased position")
+	}
+	market, _ := gateway.SendOrder(OrderRequest{Symbol: "BTCUSDT", Direction: expb.Direction_LONG, Volume: 2, Type: MARKET})
+	ioc, _ := gateway.SendOrder(OrderRequest{Symbol: "BTCUSDT", Direction: expb.Direction_LONG, Price: 90, Volume: 1, TimeInForce: IOC})
+	events.Put(Event{Type: EventBar, Data: newTestBar("BTCUSDT", start.Add(time.Minute), 101, 102, 99, 101)})
+
+	if orders[market].Status != expb.Status_ALL_TRADED || orders[ioc].Status != expb.Status_CANCELLED {
+		t.Fatalf("orders: %+v", orders)
+	}
+
+	reduce, err := gateway.SendOrder(OrderRequest{Symbol: "BTCUSDT", Direction: expb.Direction_SHORT, Price: 100, Volume: 5, ReduceOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	events.Put(Event{Type: EventBar, Data: newTestBar("BTCUSDT", start.Add(2*time.Minute), 101, 102, 99, 101)})
+	if order := orders[reduce]; order.Status != expb.Status_ALL_TRADED || order.Volume != 2 {
+		t.Fatalf("reduce only: %+v", order)
+	}
+	if positions, _ := gateway.QueryPosition(); len(positions) != 1 || positions[0].Volume != 0 {
+		t.Fatalf("positions: %+v", positions)
+	}
+}
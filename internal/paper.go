@@ -0,0 +1,276 @@
+package internal
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+	expb "newgitlab.com/xquant/exchange-protocols/protocols/src/go"
+)
+
+// PaperGateway 模拟盘交易接口
+// 行情来自 MarketData，委托不发往交易所，而是在本地按回测的撮合逻辑用收到的行情成交
+type PaperGateway struct {
+	MarketData Gateway
+
+	Capital float64
+	Rate    float64
+	Size    float64
+	// 反向合约按币本位计算手续费和盈亏，余额的单位为币
+	Inverse bool
+
+	events *EventEngine
+
+	mu           sync.Mutex
+	orderCount   int
+	tradeCount   int
+	activeOrders map[string]*OrderData
+	requests     map[string]OrderRequest
+	quotes       map[string]quote
+	positions    map[string]*PositionData
+	balance      float64
+}
+
+func NewPaperGateway(marketData Gateway, capital, rate, size float64) *PaperGateway {
+	if size == 0 {
+		size = 1
+	}
+	return &PaperGateway{
+		MarketData:   marketData,
+		Capital:      capital,
+		Rate:         rate,
+		Size:         size,
+		activeOrders: make(map[string]*OrderData),
+		requests:     make(map[string]OrderRequest),
+		quotes:       make(map[string]quote),
+		positions:    make(map[string]*PositionData),
+		balance:      capital,
+	}
+}
+
+func (p *PaperGateway) Connect(events *EventEngine) error {
+	if p.MarketData == nil {
+		return errors.New("模拟盘需要提供行情的交易接口")
+	}
+	p.events = events
+
+	// 排在策略之前，保证和回测一样先撮合再推送行情给策略
+	events.RegisterFirst(EventBar, func(event Event) {
+		bar := event.Data.(BarData)
+		p.cross(bar.Symbol, barCrossPrice(bar), barQuote(bar), bar.UpdatedAt.AsTime())
+	})
+	events.RegisterFirst(EventTick, func(event Event) {
+		tick := event.Data.(TickData)
+		p.cross(tick.Symbol, tickCrossPrice(tick), tickQuote(tick), tick.UpdatedAt.AsTime())
+	})
+
+	return p.MarketData.Connect(events)
+}
+
+func (p *PaperGateway) Close() {
+	p.MarketData.Close()
+}
+
+func (p *PaperGateway) Subscribe(req SubscribeRequest) error {
+	return p.MarketData.Subscribe(req)
+}
+
+func (p *PaperGateway) SendOrder(req OrderRequest) (string, error) {
+	if req.Volume <= 0 {
+		return "", errors.New("委托数量必须大于0")
+	}
+	if err := req.check(); err != nil {
+		return "", err
+	}
+
+	p.mu.Lock()
+	if req.TimeInForce == GTX && p.quotes[req.Symbol].crosses(req.Direction, req.Price) {
+		p.mu.Unlock()
+		return "", errors.New("postOnly委托会立即成交")
+	}
+	if req.ReduceOnly {
+		volume := reduceOnlyVolume(req.Direction, req.Volume, p.position(req.Symbol))
+		if volume <= 0 {
+			p.mu.Unlock()
+			return "", errors.New("只减仓委托不能增加持仓")
+		}
+		req.Volume = volume
+	}
+	p.orderCount++
+	order := &OrderData{
+		Symbol:    req.Symbol,
+		Exchange:  expb.Exchange(req.Exchange),
+		OrderNo:   "paper." + strconv.Itoa(p.orderCount),
+		Direction: req.Direction,
+		Offset:    req.Offset,
+		Price:     req.Price,
+		Volume:    req.Volume,
+		Status:    expb.Status_NOT_TRADED,
+		UpdatedAt: timestamppb.Now(),
+	}
+	p.activeOrders[order.OrderNo] = order
+	p.requests[order.OrderNo] = req
+	p.mu.Unlock()
+
+	p.events.Put(Event{Type: EventOrder, Data: *order})
+	return order.OrderNo, nil
+}
+
+func (p *PaperGateway) CancelOrder(req CancelRequest) error {
+	p.mu.Lock()
+	order, ok := p.activeOrders[req.OrderNo]
+	if !ok {
+		p.mu.Unlock()
+		return errors.New("委托不存在或已结束: " + req.OrderNo)
+	}
+	p.removeOrder(req.OrderNo)
+	order.Status = expb.Status_CANCELLED
+	p.mu.Unlock()
+
+	p.events.Put(Event{Type: EventOrder, Data: *order})
+	return nil
+}
+
+func (p *PaperGateway) QueryAccount() (AccountData, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return AccountData{AccountID: "paper", Balance: p.balance}, nil
+}
+
+func (p *PaperGateway) QueryPosition() ([]PositionData, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	positions := make([]PositionData, 0, len(p.positions))
+	for _, pos := range p.positions {
+		positions = append(positions, *pos)
+	}
+	sort.Slice(positions, func(i, j int) bool { return positions[i].Symbol < positions[j].Symbol })
+	return positions, nil
+}
+
+// cross 委托按提交顺序撮合，市价、IOC 和 FOK 委托未成交时撤销，只减仓委托最多成交到持仓为 0
+func (p *PaperGateway) cross(symbol string, price crossPrice, q quote, datetime time.Time) {
+	p.mu.Lock()
+	p.quotes[symbol] = q
+	orders := make([]*OrderData, 0, len(p.activeOrders))
+	for _, order := range p.activeOrders {
+		if order.Symbol == symbol {
+			orders = append(orders, order)
+		}
+	}
+	sort.Slice(orders, func(i, j int) bool { return lessNo(orders[i].OrderNo, orders[j].OrderNo) })
+
+	events := make([]Event, 0)
+	for _, order := range orders {
+		req := p.requests[order.OrderNo]
+		tradePrice, _, ok := matchOrder(order, req.Type, price)
+		volume := order.Volume
+		if ok && req.ReduceOnly {
+			volume = reduceOnlyVolume(order.Direction, volume, p.position(symbol))
+		}
+		if !ok || volume <= 0 {
+			if req.immediate() || req.ReduceOnly && ok {
+				order.Status = expb.Status_CANCELLED
+				p.removeOrder(order.OrderNo)
+				events = append(events, Event{Type: EventOrder, Data: *order})
+			}
+			continue
+		}
+
+		order.Traded = volume
+		order.Status = expb.Status_ALL_TRADED
+		if volume < order.Volume {
+			order.Status = expb.Status_PART_TRADED
+		}
+		p.removeOrder(order.OrderNo)
+
+		p.tradeCount++
+		trade := TradeData{
+			Symbol:    order.Symbol,
+			Exchange:  order.Exchange,
+			OrderNo:   order.OrderNo,
+			TradeNo:   "paper." + strconv.Itoa(p.tradeCount),
+			Direction: order.Direction,
+			Offset:    order.Offset,
+			Price:     tradePrice,
+			Volume:    volume,
+			UpdatedAt: timestamppb.New(datetime),
+		}
+		p.updatePosition(trade, signedVolume(order.Direction, volume))
+
+		events = append(events, Event{Type: EventOrder, Data: *order}, Event{Type: EventTrade, Data: trade})
+		// 只减仓委托超出持仓的部分撤销
+		if order.Status == expb.Status_PART_TRADED {
+			order.Status = expb.Status_CANCELLED
+			events = append(events, Event{Type: EventOrder, Data: *order})
+		}
+	}
+	p.mu.Unlock()
+
+	for _, event := range events {
+		p.events.Put(event)
+	}
+}
+
+func (p *PaperGateway) removeOrder(orderNo string) {
+	delete(p.activeOrders, orderNo)
+	delete(p.requests, orderNo)
+}
+
+func (p *PaperGateway) position(symbol string) float64 {
+	if pos, ok := p.positions[symbol]; ok {
+		return pos.Volume
+	}
+	return 0
+}
+
+// updatePosition 按成交更新净持仓和均价，平仓部分的盈亏和手续费计入余额
+func (p *PaperGateway) updatePosition(trade TradeData, posChange float64) {
+	pos, ok := p.positions[trade.Symbol]
+	if !ok {
+		pos = &PositionData{Symbol: trade.Symbol, Exchange: Exchange(trade.Exchange)}
+		p.positions[trade.Symbol] = pos
+	}
+
+	_, commission, _ := tradeCost(trade.Price, trade.Volume, p.Size, p.Rate, 0, p.Inverse)
+	p.balance -= commission
+
+	if pos.Volume == 0 || (pos.Volume > 0) == (posChange > 0) {
+		volume := math.Abs(pos.Volume) + math.Abs(posChange)
+		switch {
+		case pos.Volume == 0:
+			pos.Price = trade.Price
+		case p.Inverse:
+			// 反向合约的均价是按数量加权的调和平均
+			pos.Price = volume / (math.Abs(pos.Volume)/pos.Price + math.Abs(posChange)/trade.Price)
+		default:
+			pos.Price = (math.Abs(pos.Volume)*pos.Price + math.Abs(posChange)*trade.Price) / volume
+		}
+		pos.Volume += posChange
+		return
+	}
+
+	closed := Min(math.Abs(posChange), math.Abs(pos.Volume))
+	pnl := closed * (trade.Price - pos.Price) * p.Size
+	if p.Inverse {
+		pnl = closed * (1/pos.Price - 1/trade.Price) * p.Size
+	}
+	if pos.Volume < 0 {
+		pnl = -pnl
+	}
+	pos.Pnl += pnl
+	p.balance += pnl
+
+	pos.Volume += posChange
+	switch {
+	case pos.Volume == 0:
+		pos.Price = 0
+	case (pos.Volume > 0) == (posChange > 0):
+		// 反手，剩余部分按成交价开仓
+		pos.Price = trade.Price
+	}
+}
@@ -0,0 +1,215 @@
+package internal
+
+import (
+	"math"
+	"sync"
+	"testing"
+	"time"
+
+	expb "newgitlab.com/xquant/exchange-protocols/protocols/src/go"
+)
+
+type fakeMarketGateway struct {
+	events     *EventEngine
+	subscribed []string
+}
+
+func (f *fakeMarketGateway) Connect(events *EventEngine) error {
+	f.events = events
+	return nil
+}
+
+func (f *fakeMarketGateway) Close() {}
+
+func (f *fakeMarketGateway) Subscribe(req SubscribeRequest) error {
+	f.subscribed = append(f.subscribed, req.Symbol)
+	return nil
+}
+
+func (f *fakeMarketGateway) SendOrder(OrderRequest) (string, error) { panic("market data only") }
+func (f *fakeMarketGateway) CancelOrder(CancelRequest) error        { panic("market data only") }
+func (f *fakeMarketGateway) QueryAccount() (AccountData, error)     { panic("market data only") }
+func (f *fakeMarketGateway) QueryPosition() ([]PositionData, error) { panic("market data only") }
+
+// eventWaiter 等待事件引擎处理完队列中的事件，包括处理过程中新放入的事件
+type eventWaiter struct {
+	events *EventEngine
+	idle   chan bool
+}
+
+const eventFlush = EventType(100)
+
+func newEventWaiter(events *EventEngine) *eventWaiter {
+	w := &eventWaiter{events: events, idle: make(chan bool, 1)}
+	events.Register(eventFlush, func(Event) {
+		events.mu.Lock()
+		idle := len(events.queue) == 0
+		events.mu.Unlock()
+		w.idle <- idle
+	})
+	return w
+}
+
+func (w *eventWaiter) wait(t *testing.T) {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		w.events.Put(Event{Type: eventFlush})
+		select {
+		case idle := <-w.idle:
+			if idle {
+				return
+			}
+		case <-timeout:
+			t.Fatal("事件没有处理完")
+		}
+	}
+}
+
+type paperTestStrategy struct {
+	StrategyTemplate
+
+	mu     sync.Mutex
+	bars   int
+	pos    float64
+	trades []TradeData
+}
+
+func (s *paperTestStrategy) OnBar(bar BarData) {
+	s.mu.Lock()
+	s.bars++
+	bars := s.bars
+	s.mu.Unlock()
+
+	switch bars {
+	case 1:
+		s.Buy(bar.ClosePrice, 2)
+	case 2:
+		s.Sell(bar.ClosePrice, 2)
+	}
+}
+
+func (s *paperTestStrategy) OnPosition(posChange float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pos += posChange
+}
+
+func (s *paperTestStrategy) OnTrade(trade TradeData) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.trades = append(s.trades, trade)
+}
+
+func TestPaperTrading(t *testing.T) {
+	market := new(fakeMarketGateway)
+	gateway := NewPaperGateway(market, 1000, 0, 1)
+	strategy := new(paperTestStrategy)
+
+	engine, err := NewLiveEngine(LiveEngineCfg{
+		Strategy: strategy,
+		Gateway:  gateway,
+		Symbol:   "BTCUSDT",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = engine.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if len(market.subscribed) != 1 || market.subscribed[0] != "BTCUSDT" {
+		t.Fatalf("subscribed: %v", market.subscribed)
+	}
+
+	waiter := newEventWaiter(market.events)
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	bars := []BarData{
+		newTestBar("BTCUSDT", start, 100, 100, 100, 100),
+		newTestBar("ETHUSDT", start, 5, 5, 5, 5),
+		newTestBar("BTCUSDT", start.Add(time.Minute), 99, 101, 98, 110),
+		newTestBar("BTCUSDT", start.Add(2*time.Minute), 115, 120, 112, 118),
+	}
+	for _, bar := range bars {
+		market.events.Put(Event{Type: EventBar, Data: bar})
+		waiter.wait(t)
+	}
+	engine.Stop()
+
+	if len(strategy.trades) != 2 {
+		t.Fatalf("trades: %+v", strategy.trades)
+	}
+	if strategy.trades[0].Price != 99 || strategy.trades[1].Price != 115 {
+		t.Fatalf("trade prices: %v %v", strategy.trades[0].Price, strategy.trades[1].Price)
+	}
+	if strategy.pos != 0 || engine.Pos() != 0 {
+		t.Fatalf("pos: %v %v", strategy.pos, engine.Pos())
+	}
+
+	account, _ := gateway.QueryAccount()
+	if account.Balance != 1000+2*(115-99) {
+		t.Fatalf("balance: %v", account.Balance)
+	}
+}
+
+// reportingGateway 在 SendOrder 返回之前推送回报，并等回报处理完
+type reportingGateway struct {
+	fakeMarketGateway
+	t      *testing.T
+	waiter *eventWaiter
+}
+
+func (g *reportingGateway) SendOrder(req OrderRequest) (string, error) {
+	order := OrderData{Symbol: req.Symbol, OrderNo: "early.1", Direction: req.Direction, Price: req.Price, Volume: req.Volume, Traded: req.Volume, Status: expb.Status_ALL_TRADED}
+	g.events.Put(Event{Type: EventOrder, Data: order})
+	g.events.Put(Event{Type: EventTrade, Data: TradeData{Symbol: req.Symbol, OrderNo: order.OrderNo, TradeNo: "1", Direction: req.Direction, Price: req.Price, Volume: req.Volume}})
+	g.waiter.wait(g.t)
+	return order.OrderNo, nil
+}
+
+func TestLiveEarlyReport(t *testing.T) {
+	gateway := &reportingGateway{t: t}
+	strategy := new(paperTestStrategy)
+	engine, err := NewLiveEngine(LiveEngineCfg{
+		Strategy: strategy,
+		Gateway:  gateway,
+		Symbol:   "BTCUSDT",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = engine.Start(); err != nil {
+		t.Fatal(err)
+	}
+	gateway.waiter = newEventWaiter(gateway.events)
+
+	// 回报先于委托号返回，发单返回后补发给策略
+	if orderNo := engine.SendOrder(OrderRequest{Direction: expb.Direction_LONG, Price: 100, Volume: 2}); orderNo != "early.1" {
+		t.Fatalf("order no: %s", orderNo)
+	}
+	engine.Stop()
+
+	if len(strategy.trades) != 1 || strategy.pos != 2 || engine.Pos() != 2 {
+		t.Fatalf("trades: %+v pos: %v %v", strategy.trades, strategy.pos, engine.Pos())
+	}
+}
+
+func TestPaperInverse(t *testing.T) {
+	gateway := NewPaperGateway(new(fakeMarketGateway), 1, 0.001, 100)
+	gateway.Inverse = true
+
+	// 反向合约的手续费和盈亏按币计算
+	gateway.updatePosition(TradeData{Symbol: "BTCUSD", Price: 20000, Volume: 10}, 10)
+	gateway.updatePosition(TradeData{Symbol: "BTCUSD", Price: 25000, Volume: 10}, -10)
+	commission := 10*100/20000.0*0.001 + 10*100/25000.0*0.001
+	pnl := 10 * (1/20000.0 - 1/25000.0) * 100
+	if math.Abs(gateway.balance-(1-commission+pnl)) > 1e-12 {
+		t.Fatalf("balance: %v", gateway.balance)
+	}
+
+	// 加仓的均价按调和平均计算
+	gateway.updatePosition(TradeData{Symbol: "BTCUSD", Price: 20000, Volume: 1}, 1)
+	gateway.updatePosition(TradeData{Symbol: "BTCUSD", Price: 30000, Volume: 1}, 1)
+	if price := gateway.positions["BTCUSD"].Price; math.Abs(price-24000) > 1e-9 {
+		t.Fatalf("price: %v", price)
+	}
+}
@@ -0,0 +1,285 @@
+package internal
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+type RecorderCfg struct {
+	Gateway
+	DataSaver
+
+	// Interval 为 0 时只记录 tick，不记录交易接口推送的 K 线
+	Subscribes []SubscribeRequest
+
+	// 大于 0 时由 tick 合成该周期的 K 线一并写入
+	BarInterval time.Duration
+	// 缓存的数据达到 BatchSize 或收到 EventTimer 时写入
+	BatchSize int
+
+	EventEngine *EventEngine
+}
+
+func (c RecorderCfg) Check() error {
+	if c.Gateway == nil {
+		return errors.New("gateway不能为空")
+	}
+	if c.DataSaver == nil {
+		return errors.New("dataSaver不能为空")
+	}
+	if len(c.Subscribes) == 0 {
+		return errors.New("至少需要订阅一个合约")
+	}
+
+	var errs CheckErrors
+	for _, req := range c.Subscribes {
+		if _, err := tableSymbol(req.Symbol); err != nil {
+			errs = append(errs, err)
+		}
+		if req.Interval > 0 {
+			if _, err := intervalName(req.Interval); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	if c.BarInterval > 0 {
+		if _, err := intervalName(c.BarInterval); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs.Err()
+}
+
+// recordSeries 一个合约一个周期的数据，tick 的 interval 为 0
+type recordSeries struct {
+	symbol   string
+	interval time.Duration
+}
+
+type recordKey struct {
+	recordSeries
+	datetime int64
+}
+
+// Recorder 订阅交易接口的行情，批量写入数据仓库，使回测用的历史数据可以自动补齐
+type Recorder struct {
+	RecorderCfg
+
+	logger Logger
+	events *EventEngine
+
+	mu         sync.Mutex
+	generators map[string]*BarGenerator
+	bars       map[time.Duration][]BarData
+	ticks      []TickData
+	pending    int
+	seen       map[recordKey]struct{}
+	// 每个序列已写入的最新时间，重连或重放推送的旧数据不再写入
+	written map[recordSeries]int64
+}
+
+func NewRecorder(cfg RecorderCfg) (*Recorder, error) {
+	if err := cfg.Check(); err != nil {
+		return nil, err
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 1000
+	}
+
+	events := cfg.EventEngine
+	if events == nil {
+		events = NewEventEngine(0)
+		events.Register(EventLog, logHandler)
+	}
+
+	return &Recorder{
+		RecorderCfg: cfg,
+		logger:      eventLogger{events},
+		events:      events,
+		generators:  make(map[string]*BarGenerator),
+		bars:        make(map[time.Duration][]BarData),
+		seen:        make(map[recordKey]struct{}),
+		written:     make(map[recordSeries]int64),
+	}, nil
+}
+
+func (r *Recorder) Start() error {
+	intervals := make(map[string]time.Duration, len(r.Subscribes))
+	for _, req := range r.Subscribes {
+		intervals[req.Symbol] = req.Interval
+		if r.BarInterval > 0 {
+			r.generators[req.Symbol] = NewBarGenerator(r.BarInterval, r.recordGeneratedBar)
+		}
+	}
+
+	r.events.Register(EventTick, func(event Event) {
+		tick := event.Data.(TickData)
+		if _, ok := intervals[tick.Symbol]; ok {
+			r.recordTick(tick)
+		}
+	})
+	r.events.Register(EventBar, func(event Event) {
+		bar := event.Data.(BarData)
+		if interval := intervals[bar.Symbol]; interval > 0 {
+			r.recordBar(interval, bar)
+		}
+	})
+	r.events.Register(EventTimer, func(Event) {
+		r.flush()
+	})
+
+	r.events.Start()
+	if err := r.Gateway.Connect(r.events); err != nil {
+		return err
+	}
+	for _, req := range r.Subscribes {
+		if err := r.Gateway.Subscribe(req); err != nil {
+			return err
+		}
+	}
+	r.logger.Println("行情记录启动，订阅合约数:", len(r.Subscribes))
+
+	return nil
+}
+
+// Stop 停止接收行情，写入合成中的 K 线和剩余的缓存
+func (r *Recorder) Stop() {
+	r.Gateway.Close()
+	r.events.Stop()
+
+	for _, generator := range r.generators {
+		generator.Flush()
+	}
+	r.flush()
+	r.mu.Lock()
+	failed := len(r.seen)
+	r.mu.Unlock()
+	if failed > 0 {
+		r.logger.Println("行情记录停止，写入失败的数据条数:", failed)
+		return
+	}
+	r.logger.Println("行情记录停止")
+}
+
+func (r *Recorder) recordTick(tick TickData) {
+	r.mu.Lock()
+	generator := r.generators[tick.Symbol]
+	full := r.add(recordKey{recordSeries{tick.Symbol, 0}, tick.UpdatedAt.AsTime().UnixNano()}, func() {
+		r.ticks = append(r.ticks, tick)
+	})
+	r.mu.Unlock()
+
+	if generator != nil {
+		generator.UpdateTick(tick)
+	}
+	if full {
+		r.flush()
+	}
+}
+
+func (r *Recorder) recordBar(interval time.Duration, bar BarData) {
+	r.mu.Lock()
+	full := r.add(recordKey{recordSeries{bar.Symbol, interval}, bar.UpdatedAt.AsTime().UnixNano()}, func() {
+		r.bars[interval] = append(r.bars[interval], bar)
+	})
+	r.mu.Unlock()
+
+	if full {
+		r.flush()
+	}
+}
+
+func (r *Recorder) recordGeneratedBar(bar BarData) {
+	r.recordBar(r.BarInterval, bar)
+}
+
+// add 按合约和时间去重后加入缓存，返回是否需要写入
+// 未写入和写入中的数据按 seen 去重，已写入的数据按每个序列的最新时间去重
+func (r *Recorder) add(key recordKey, push func()) bool {
+	if _, ok := r.seen[key]; ok {
+		return false
+	}
+	if written, ok := r.written[key.recordSeries]; ok && key.datetime <= written {
+		return false
+	}
+	r.seen[key] = struct{}{}
+	push()
+	r.pending++
+	return r.pending >= r.BatchSize
+}
+
+// flush 写入缓存的数据，写入中的数据仍留在 seen 里去重
+// 写入成功后才推进序列的最新时间，失败的批次放回缓存，等下次写入时重试
+func (r *Recorder) flush() {
+	r.mu.Lock()
+	bars, ticks := r.bars, r.ticks
+	r.bars = make(map[time.Duration][]BarData)
+	r.ticks = nil
+	r.pending = 0
+	r.mu.Unlock()
+
+	for interval, data := range bars {
+		for symbol, symbolBars := range groupBars(data) {
+			err := r.SaveBarData(interval, symbolBars)
+			if err != nil {
+				r.logger.Println("写入K线失败:", symbol, err.Error())
+			}
+			datetimes := make([]int64, 0, len(symbolBars))
+			for _, bar := range symbolBars {
+				datetimes = append(datetimes, bar.UpdatedAt.AsTime().UnixNano())
+			}
+			interval, symbolBars := interval, symbolBars
+			r.saved(recordSeries{symbol, interval}, datetimes, err, func() {
+				r.bars[interval] = append(symbolBars, r.bars[interval]...)
+			})
+		}
+	}
+	for symbol, symbolTicks := range groupTicks(ticks) {
+		err := r.SaveTickData(symbolTicks)
+		if err != nil {
+			r.logger.Println("写入tick失败:", symbol, err.Error())
+		}
+		datetimes := make([]int64, 0, len(symbolTicks))
+		for _, tick := range symbolTicks {
+			datetimes = append(datetimes, tick.UpdatedAt.AsTime().UnixNano())
+		}
+		symbolTicks := symbolTicks
+		r.saved(recordSeries{symbol, 0}, datetimes, err, func() {
+			r.ticks = append(symbolTicks, r.ticks...)
+		})
+	}
+}
+
+// saved 写入成功时推进序列的最新时间并移出 seen，失败时调用 requeue 放回缓存
+// 放回的数据不计入 pending，由定时器或下一批数据触发重试，避免写入失败时每条行情都重试
+func (r *Recorder) saved(series recordSeries, datetimes []int64, err error, requeue func()) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err != nil {
+		requeue()
+		return
+	}
+	for _, datetime := range datetimes {
+		delete(r.seen, recordKey{series, datetime})
+		if written, ok := r.written[series]; !ok || datetime > written {
+			r.written[series] = datetime
+		}
+	}
+}
+
+func groupBars(bars []BarData) map[string][]BarData {
+	groups := make(map[string][]BarData)
+	for _, bar := range bars {
+		groups[bar.Symbol] = append(groups[bar.Symbol], bar)
+	}
+	return groups
+}
+
+func groupTicks(ticks []TickData) map[string][]TickData {
+	groups := make(map[string][]TickData)
+	for _, tick := range ticks {
+		groups[tick.Symbol] = append(groups[tick.Symbol], tick)
+	}
+	return groups
+}
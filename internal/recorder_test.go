@@ -0,0 +1,189 @@
+package internal
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRecorder(t *testing.T) {
+	repo, err := NewFileData(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	market := new(fakeMarketGateway)
+	recorder, err := NewRecorder(RecorderCfg{
+		Gateway:     market,
+		DataSaver:   repo,
+		Subscribes:  []SubscribeRequest{{Symbol: "BTCUSDT", Interval: time.Hour}},
+		BarInterval: time.Minute,
+		BatchSize:   3,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = recorder.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	events := []Event{
+		{Type: EventTick, Data: newTestTick("BTCUSDT", start, 100, 1)},
+		{Type: EventTick, Data: newTestTick("BTCUSDT", start, 100, 1)},
+		{Type: EventTick, Data: newTestTick("ETHUSDT", start, 5, 1)},
+		{Type: EventTick, Data: newTestTick("BTCUSDT", start.Add(30*time.Second), 102, 3)},
+		{Type: EventTick, Data: newTestTick("BTCUSDT", start.Add(90*time.Second), 101, 4)},
+		{Type: EventBar, Data: newTestBar("BTCUSDT", start, 100, 110, 90, 105)},
+	}
+	for _, event := range events {
+		market.events.Put(event)
+	}
+	recorder.Stop()
+
+	// 重复写入同样的数据不会产生重复记录
+	if err = repo.SaveTickData([]TickData{newTestTick("BTCUSDT", start, 100, 1)}); err != nil {
+		t.Fatal(err)
+	}
+
+	ticks, err := repo.GetTickData("BTCUSDT", 0, 0, start, start.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ticks.Len() != 3 {
+		t.Fatalf("ticks: %d", ticks.Len())
+	}
+
+	minuteBars, err := repo.GetBarData("BTCUSDT", 0, time.Minute, start, start.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if minuteBars.Len() != 2 {
+		t.Fatalf("minute bars: %d", minuteBars.Len())
+	}
+	first := minuteBars.Front().Value.(BarData)
+	if first.OpenPrice != 100 || first.HighPrice != 102 || first.Volume != 2 {
+		t.Fatalf("first minute bar: %+v", first)
+	}
+
+	hourBars, err := repo.GetBarData("BTCUSDT", 0, time.Hour, start, start.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hourBars.Len() != 1 || hourBars.Front().Value.(BarData).ClosePrice != 105 {
+		t.Fatalf("hour bars: %d", hourBars.Len())
+	}
+}
+
+// countingSaver 记录每次写入的数据，不去重
+type countingSaver struct {
+	bars  map[time.Duration][]BarData
+	ticks []TickData
+}
+
+func (c *countingSaver) SaveBarData(interval time.Duration, bars []BarData) error {
+	c.bars[interval] = append(c.bars[interval], bars...)
+	return nil
+}
+
+func (c *countingSaver) SaveTickData(ticks []TickData) error {
+	c.ticks = append(c.ticks, ticks...)
+	return nil
+}
+
+func TestRecorderReplay(t *testing.T) {
+	saver := &countingSaver{bars: make(map[time.Duration][]BarData)}
+	market := new(fakeMarketGateway)
+	recorder, err := NewRecorder(RecorderCfg{
+		Gateway:    market,
+		DataSaver:  saver,
+		Subscribes: []SubscribeRequest{{Symbol: "BTCUSDT", Interval: time.Minute}},
+		BatchSize:  2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = recorder.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 重连后交易接口重新推送已写入的数据
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 2; i++ {
+		for j := 0; j < 4; j++ {
+			at := start.Add(time.Duration(j) * time.Minute)
+			market.events.Put(Event{Type: EventTick, Data: newTestTick("BTCUSDT", at, 100, 1)})
+			market.events.Put(Event{Type: EventBar, Data: newTestBar("BTCUSDT", at, 100, 100, 100, 100)})
+		}
+	}
+	recorder.Stop()
+
+	if len(saver.ticks) != 4 || len(saver.bars[time.Minute]) != 4 {
+		t.Fatalf("ticks: %d bars: %d", len(saver.ticks), len(saver.bars[time.Minute]))
+	}
+}
+
+// failingSaver 前 fails 次写入 tick 失败
+type failingSaver struct {
+	countingSaver
+	fails int
+}
+
+func (f *failingSaver) SaveTickData(ticks []TickData) error {
+	if f.fails > 0 {
+		f.fails--
+		return errors.New("写入失败")
+	}
+	return f.countingSaver.SaveTickData(ticks)
+}
+
+func TestRecorderRetry(t *testing.T) {
+	saver := &failingSaver{countingSaver: countingSaver{bars: make(map[time.Duration][]BarData)}, fails: 1}
+	recorder, err := NewRecorder(RecorderCfg{
+		Gateway:    new(fakeMarketGateway),
+		DataSaver:  saver,
+		Subscribes: []SubscribeRequest{{Symbol: "BTCUSDT", Interval: time.Minute}},
+		BatchSize:  10,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	recorder.recordTick(newTestTick("BTCUSDT", start, 100, 1))
+	recorder.flush()
+	if len(saver.ticks) != 0 {
+		t.Fatalf("ticks: %d", len(saver.ticks))
+	}
+
+	// 写入失败的数据重新推送时不重复缓存，下次写入时重试
+	recorder.recordTick(newTestTick("BTCUSDT", start, 100, 1))
+	recorder.recordTick(newTestTick("BTCUSDT", start.Add(time.Minute), 100, 1))
+	recorder.flush()
+	if len(saver.ticks) != 2 || !saver.ticks[0].UpdatedAt.AsTime().Equal(start) {
+		t.Fatalf("ticks: %d", len(saver.ticks))
+	}
+
+	recorder.recordTick(newTestTick("BTCUSDT", start, 100, 1))
+	recorder.flush()
+	if len(saver.ticks) != 2 {
+		t.Fatalf("ticks: %d", len(saver.ticks))
+	}
+}
+
+func TestRecorderInterval(t *testing.T) {
+	cfg := RecorderCfg{
+		Gateway:     new(fakeMarketGateway),
+		DataSaver:   &countingSaver{},
+		Subscribes:  []SubscribeRequest{{Symbol: "BTCUSDT", Interval: 30 * time.Second}},
+		BarInterval: 90 * time.Second,
+	}
+	if err := cfg.Check(); err == nil || len(err.(CheckErrors)) != 2 {
+		t.Fatalf("check: %v", err)
+	}
+	if _, err := intervalName(30 * time.Second); err == nil {
+		t.Fatal("30s interval")
+	}
+	if name, err := intervalName(4 * time.Hour); err != nil || name != "4h" {
+		t.Fatalf("%s %v", name, err)
+	}
+}
@@ -0,0 +1,96 @@
+package internal
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// StrategyParam 策略参数的说明和默认值
+type StrategyParam struct {
+	Name        string
+	Default     float64
+	Description string
+}
+
+// StrategyInfo 注册到策略库的策略，Params 声明策略接受的全部参数
+type StrategyInfo struct {
+	Name        string
+	Description string
+	Params      []StrategyParam
+	Factory     StrategyFactory `json:"-"`
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]StrategyInfo)
+)
+
+// RegisterStrategy 一般在策略包的 init 中调用，名称重复或工厂为空时 panic
+func RegisterStrategy(info StrategyInfo) {
+	if info.Name == "" || info.Factory == nil {
+		panic("注册策略时名称和工厂不能为空")
+	}
+
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, ok := registry[info.Name]; ok {
+		panic("策略重复注册: " + info.Name)
+	}
+	registry[info.Name] = info
+}
+
+// LookupStrategy 按名称查找已注册的策略
+func LookupStrategy(name string) (StrategyInfo, error) {
+	registryMu.RLock()
+	info, ok := registry[name]
+	registryMu.RUnlock()
+	if !ok {
+		return StrategyInfo{}, fmt.Errorf("未知策略: %q，可选: %s", name, strings.Join(StrategyNames(), ", "))
+	}
+	return info, nil
+}
+
+// Strategies 所有已注册的策略，按名称排序
+func Strategies() []StrategyInfo {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	infos := make([]StrategyInfo, 0, len(registry))
+	for _, info := range registry {
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos
+}
+
+func StrategyNames() []string {
+	infos := Strategies()
+	names := make([]string, 0, len(infos))
+	for _, info := range infos {
+		names = append(names, info.Name)
+	}
+	return names
+}
+
+func (i StrategyInfo) DefaultParams() map[string]float64 {
+	params := make(map[string]float64, len(i.Params))
+	for _, param := range i.Params {
+		params[param.Name] = param.Default
+	}
+	return params
+}
+
+// New 用默认值补齐缺少的参数后创建策略，没有声明的参数报错
+// 可以直接作为 StrategyFactory 传给参数优化
+func (i StrategyInfo) New(params map[string]float64) (Strategy, error) {
+	merged := i.DefaultParams()
+	for name, value := range params {
+		if _, ok := merged[name]; !ok {
+			return nil, fmt.Errorf("策略%s不支持参数: %s", i.Name, name)
+		}
+		merged[name] = value
+	}
+	return i.Factory(merged)
+}
@@ -0,0 +1,29 @@
+package internal
+
+import "testing"
+
+func TestStrategyRegistry(t *testing.T) {
+	info, err := LookupStrategy("config_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = info.New(map[string]float64{"dev": 3}); err != nil {
+		t.Fatal(err)
+	}
+	if configTestParams["window"] != 10 || configTestParams["dev"] != 3 {
+		t.Fatalf("params: %v", configTestParams)
+	}
+	if _, err = info.New(map[string]float64{"windows": 3}); err == nil {
+		t.Fatal("expected error")
+	}
+	if _, err = LookupStrategy("unknown"); err == nil {
+		t.Fatal("expected error")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected panic")
+		}
+	}()
+	RegisterStrategy(info)
+}
@@ -0,0 +1,327 @@
+package internal
+
+import (
+	"fmt"
+	"html"
+	"html/template"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	expb "newgitlab.com/xquant/exchange-protocols/protocols/src/go"
+)
+
+const (
+	chartWidth   = 960
+	chartHeight  = 280
+	chartPadding = 50
+)
+
+var reportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html lang="zh">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: -apple-system, "Helvetica Neue", "PingFang SC", "Microsoft YaHei", sans-serif; margin: 24px; color: #222; }
+h1 { font-size: 22px; }
+h2 { font-size: 16px; margin: 24px 0 8px; }
+table { border-collapse: collapse; font-size: 13px; }
+td { border-bottom: 1px solid #eee; padding: 4px 16px 4px 0; }
+td.value { text-align: right; font-family: monospace; }
+svg { background: #fafafa; border: 1px solid #eee; }
+svg text { font-size: 11px; fill: #666; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<h2>统计指标</h2>
+<table>
+{{range .Statistics}}<tr><td>{{.Key}}</td><td class="value">{{.Value}}</td></tr>
+{{end}}</table>
+<h2>资金曲线</h2>
+{{.Balance}}
+<h2>回撤</h2>
+{{.Drawdown}}
+<h2>每日盈亏分布</h2>
+{{.Histogram}}
+<h2>价格与成交</h2>
+{{.Price}}
+</body>
+</html>
+`))
+
+type reportStatistic struct {
+	Key   string
+	Value string
+}
+
+// WriteReport 生成单文件 HTML 报告，图表为内嵌 SVG，不依赖外部脚本
+func WriteReport(w io.Writer, title string, result *BacktestResult) error {
+	balances := result.Balances()
+	dates := make([]string, 0, len(balances))
+	balanceValues := make([]float64, 0, len(balances))
+	drawdownValues := make([]float64, 0, len(balances))
+	for _, balance := range balances {
+		dates = append(dates, balance.Date)
+		balanceValues = append(balanceValues, balance.Balance)
+		drawdownValues = append(drawdownValues, balance.Drawdown)
+	}
+	benchmarkValues := make([]float64, 0, len(result.Benchmark))
+	for _, point := range result.Benchmark {
+		benchmarkValues = append(benchmarkValues, point.Balance)
+	}
+	pnls := make([]float64, 0, len(result.DailyResults))
+	for _, daily := range result.DailyResults {
+		pnls = append(pnls, daily.NetPnl)
+	}
+
+	statistics := make([]reportStatistic, 0, len(result.Statistics))
+	for _, key := range StatisticKeys {
+		value, ok := result.Statistics[key]
+		if !ok {
+			continue
+		}
+		statistics = append(statistics, reportStatistic{key, formatStatistic(value)})
+	}
+	// 其他模块追加的指标排在后面
+	extra := make([]string, 0)
+	for key := range result.Statistics {
+		if !containsString(StatisticKeys, key) {
+			extra = append(extra, key)
+		}
+	}
+	sort.Strings(extra)
+	for _, key := range extra {
+		statistics = append(statistics, reportStatistic{key, formatStatistic(result.Statistics[key])})
+	}
+
+	return reportTemplate.Execute(w, map[string]any{
+		"Title":      title,
+		"Statistics": statistics,
+		"Balance":    template.HTML(balanceChart(dates, balanceValues, benchmarkValues)),
+		"Drawdown":   template.HTML(lineChart(dates, drawdownValues, "#d62728", true)),
+		"Histogram":  template.HTML(histogramChart(pnls, 30)),
+		"Price":      template.HTML(priceChart(result.DailyResults, result.Trades)),
+	})
+}
+
+// SaveReport 把报告写入文件，目录不存在时创建
+func SaveReport(path, title string, result *BacktestResult) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err = WriteReport(f, title, result); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+func formatStatistic(v any) string {
+	if value, ok := v.(float64); ok {
+		return fmt.Sprintf("%.2f", value)
+	}
+	return fmt.Sprint(v)
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// svgChart 把数据坐标换算成画布坐标
+type svgChart struct {
+	count      int
+	minY, maxY float64
+}
+
+func newSvgChart(count int, values ...[]float64) svgChart {
+	c := svgChart{count: count, minY: math.Inf(1), maxY: math.Inf(-1)}
+	for _, vs := range values {
+		for _, v := range vs {
+			c.minY = math.Min(c.minY, v)
+			c.maxY = math.Max(c.maxY, v)
+		}
+	}
+	if math.IsInf(c.minY, 0) {
+		c.minY, c.maxY = 0, 1
+	}
+	if c.maxY == c.minY {
+		c.minY, c.maxY = c.minY-1, c.maxY+1
+	}
+	return c
+}
+
+func (c svgChart) x(i int) float64 {
+	if c.count <= 1 {
+		return chartPadding
+	}
+	return chartPadding + float64(i)/float64(c.count-1)*(chartWidth-2*chartPadding)
+}
+
+func (c svgChart) y(v float64) float64 {
+	return chartHeight - chartPadding/2 - (v-c.minY)/(c.maxY-c.minY)*(chartHeight-chartPadding)
+}
+
+// frame 画布、Y轴范围和首尾日期
+func (c svgChart) frame(b *strings.Builder, dates []string) {
+	fmt.Fprintf(b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d">`,
+		chartWidth, chartHeight, chartWidth, chartHeight)
+	fmt.Fprintf(b, `<line x1="%d" y1="%.1f" x2="%d" y2="%.1f" stroke="#ccc"/>`,
+		chartPadding, c.y(c.minY), chartWidth-chartPadding, c.y(c.minY))
+	fmt.Fprintf(b, `<text x="4" y="%.1f">%s</text>`, c.y(c.maxY)+4, formatAxis(c.maxY))
+	fmt.Fprintf(b, `<text x="4" y="%.1f">%s</text>`, c.y(c.minY), formatAxis(c.minY))
+	if len(dates) > 0 {
+		fmt.Fprintf(b, `<text x="%d" y="%d">%s</text>`, chartPadding, chartHeight-4, html.EscapeString(dates[0]))
+		fmt.Fprintf(b, `<text x="%d" y="%d" text-anchor="end">%s</text>`,
+			chartWidth-chartPadding, chartHeight-4, html.EscapeString(dates[len(dates)-1]))
+	}
+}
+
+func formatAxis(v float64) string {
+	if math.Abs(v) >= 1000 {
+		return fmt.Sprintf("%.0f", v)
+	}
+	return fmt.Sprintf("%.2f", v)
+}
+
+func (c svgChart) polyline(values []float64) string {
+	points := make([]string, 0, len(values))
+	for i, v := range values {
+		points = append(points, fmt.Sprintf("%.1f,%.1f", c.x(i), c.y(v)))
+	}
+	return strings.Join(points, " ")
+}
+
+// lineChart 折线图，fill 为 true 时填充到零线，用于回撤
+func lineChart(dates []string, values []float64, color string, fill bool) string {
+	var b strings.Builder
+	c := newSvgChart(len(values), values)
+	if fill {
+		c = newSvgChart(len(values), values, []float64{0})
+	}
+	c.frame(&b, dates)
+	if len(values) > 0 {
+		points := c.polyline(values)
+		if fill {
+			fmt.Fprintf(&b, `<polygon points="%.1f,%.1f %s %.1f,%.1f" fill="%s" fill-opacity="0.3"/>`,
+				c.x(0), c.y(0), points, c.x(len(values)-1), c.y(0), color)
+		}
+		fmt.Fprintf(&b, `<polyline points="%s" fill="none" stroke="%s" stroke-width="1.5"/>`, points, color)
+	}
+	b.WriteString(`</svg>`)
+	return b.String()
+}
+
+// balanceChart 资金曲线，设置基准时叠加虚线表示的基准买入持有曲线
+func balanceChart(dates []string, balances, benchmark []float64) string {
+	if len(balances) == 0 || len(benchmark) != len(balances) {
+		return lineChart(dates, balances, "#1f77b4", false)
+	}
+
+	var b strings.Builder
+	c := newSvgChart(len(balances), balances, benchmark)
+	c.frame(&b, dates)
+	fmt.Fprintf(&b, `<polyline points="%s" fill="none" stroke="#ff7f0e" stroke-width="1" stroke-dasharray="4 3"/>`,
+		c.polyline(benchmark))
+	fmt.Fprintf(&b, `<polyline points="%s" fill="none" stroke="#1f77b4" stroke-width="1.5"/>`, c.polyline(balances))
+	fmt.Fprintf(&b, `<text x="%d" y="14" text-anchor="end" style="fill:#1f77b4">策略</text>`, chartWidth-chartPadding-40)
+	fmt.Fprintf(&b, `<text x="%d" y="14" text-anchor="end" style="fill:#ff7f0e">基准</text>`, chartWidth-chartPadding)
+	b.WriteString(`</svg>`)
+	return b.String()
+}
+
+// histogramChart 每日盈亏分成 bins 个区间统计天数
+func histogramChart(values []float64, bins int) string {
+	var b strings.Builder
+	if len(values) == 0 {
+		newSvgChart(0).frame(&b, nil)
+		b.WriteString(`</svg>`)
+		return b.String()
+	}
+
+	low, high := values[0], values[0]
+	for _, v := range values {
+		low, high = math.Min(low, v), math.Max(high, v)
+	}
+	if high == low {
+		low, high = low-1, high+1
+	}
+	width := (high - low) / float64(bins)
+	counts := make([]float64, bins)
+	for _, v := range values {
+		i := int((v - low) / width)
+		if i >= bins {
+			i = bins - 1
+		}
+		counts[i]++
+	}
+
+	c := newSvgChart(bins+1, counts, []float64{0})
+	c.frame(&b, []string{formatAxis(low), formatAxis(high)})
+	barWidth := c.x(1) - c.x(0)
+	for i, count := range counts {
+		color := "#2ca02c"
+		if low+width*float64(i) < 0 {
+			color = "#d62728"
+		}
+		fmt.Fprintf(&b, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" fill="%s"><title>%s ~ %s: %.0f</title></rect>`,
+			c.x(i)+1, c.y(count), barWidth-2, c.y(0)-c.y(count), color,
+			formatAxis(low+width*float64(i)), formatAxis(low+width*float64(i+1)), count)
+	}
+	b.WriteString(`</svg>`)
+	return b.String()
+}
+
+// priceChart 每日收盘价，成交按日期标在当天的位置，买入向上三角，卖出向下三角
+func priceChart(dailyResults []*DailyResult, trades []*TradeData) string {
+	dates := make([]string, 0, len(dailyResults))
+	closes := make([]float64, 0, len(dailyResults))
+	index := make(map[string]int, len(dailyResults))
+	for i, daily := range dailyResults {
+		dates = append(dates, daily.Date)
+		closes = append(closes, daily.ClosePrice)
+		index[daily.Date] = i
+	}
+	prices := make([]float64, 0, len(trades))
+	for _, trade := range trades {
+		prices = append(prices, trade.Price)
+	}
+
+	var b strings.Builder
+	c := newSvgChart(len(closes), closes, prices)
+	c.frame(&b, dates)
+	if len(closes) > 0 {
+		fmt.Fprintf(&b, `<polyline points="%s" fill="none" stroke="#555" stroke-width="1"/>`, c.polyline(closes))
+	}
+	for _, trade := range trades {
+		i, ok := index[trade.UpdatedAt.AsTime().Format("2006-01-02")]
+		if !ok {
+			continue
+		}
+		x, y := c.x(i), c.y(trade.Price)
+		points := fmt.Sprintf("%.1f,%.1f %.1f,%.1f %.1f,%.1f", x, y, x-5, y+9, x+5, y+9)
+		color, name := "#2ca02c", "买入"
+		if trade.Direction == expb.Direction_SHORT {
+			points = fmt.Sprintf("%.1f,%.1f %.1f,%.1f %.1f,%.1f", x, y, x-5, y-9, x+5, y-9)
+			color, name = "#d62728", "卖出"
+		}
+		fmt.Fprintf(&b, `<polygon points="%s" fill="%s"><title>%s %s %.4f x %.4f</title></polygon>`,
+			points, color, trade.UpdatedAt.AsTime().Format("2006-01-02 15:04:05"), name, trade.Price, trade.Volume)
+	}
+	b.WriteString(`</svg>`)
+	return b.String()
+}
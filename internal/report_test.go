@@ -0,0 +1,30 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWriteReport(t *testing.T) {
+	result := evaluateTestBacktest(t)
+
+	var b strings.Builder
+	if err := WriteReport(&b, "BTCUSDT <test>", result); err != nil {
+		t.Fatal(err)
+	}
+	report := b.String()
+
+	if n := strings.Count(report, "<svg"); n != 4 {
+		t.Fatalf("charts: %d", n)
+	}
+	// 两笔成交标在价格图上
+	if n := strings.Count(report, "<polygon points=") - 1; n != 2 {
+		t.Fatalf("trade markers: %d", n)
+	}
+	if !strings.Contains(report, "<td>total_net_pnl</td><td class=\"value\">10.00</td>") {
+		t.Fatal("missing statistics")
+	}
+	if !strings.Contains(report, "BTCUSDT &lt;test&gt;") {
+		t.Fatal("title not escaped")
+	}
+}
@@ -0,0 +1,383 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os/exec"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+// BacktestRun 一次回测的配置、参数和统计指标，常用指标单独成列便于排序
+type BacktestRun struct {
+	ID        uint `gorm:"primaryKey"`
+	CreatedAt time.Time
+
+	Strategy  string             `gorm:"size:64;index"`
+	Symbol    string             `gorm:"size:64;index"`
+	Params    map[string]float64 `gorm:"serializer:json"`
+	Config    BacktestConfig     `gorm:"serializer:json"`
+	GitCommit string             `gorm:"size:64"`
+
+	// 配置、数据和结果的指纹，相同配置和数据的回测指纹不同时说明结果不可复现
+	Fingerprint string `gorm:"size:64;index"`
+
+	TotalNetPnl     float64
+	TotalReturn     float64
+	AnnualReturn    float64
+	MaxDdpercent    float64
+	SharpeRatio     float64
+	TotalTradeCount float64
+
+	Statistics map[string]any `gorm:"serializer:json"`
+}
+
+func (BacktestRun) TableName() string {
+	return "backtest_runs"
+}
+
+// BacktestDaily 回测记录的逐日资金曲线
+type BacktestDaily struct {
+	ID         uint   `gorm:"primaryKey"`
+	RunID      uint   `gorm:"index"`
+	Date       string `gorm:"size:10"`
+	ClosePrice float64
+	TradeCount int
+	Turnover   float64
+	Commission float64
+	Slippage   float64
+	NetPnl     float64
+	Balance    float64
+	Drawdown   float64
+	DdPercent  float64
+}
+
+func (BacktestDaily) TableName() string {
+	return "backtest_daily"
+}
+
+type BacktestTrade struct {
+	ID        uint   `gorm:"primaryKey"`
+	RunID     uint   `gorm:"index"`
+	TradeNo   string `gorm:"size:32"`
+	OrderNo   string `gorm:"size:32"`
+	Datetime  time.Time
+	Symbol    string `gorm:"size:64"`
+	Direction string `gorm:"size:16"`
+	Offset    string `gorm:"size:16"`
+	Price     float64
+	Volume    float64
+}
+
+func (BacktestTrade) TableName() string {
+	return "backtest_trades"
+}
+
+// RunFilter 查询回测记录的条件，空值表示不限制
+type RunFilter struct {
+	Strategy string
+	Symbol   string
+	Limit    int
+}
+
+// ResultStore 回测结果库
+type ResultStore struct {
+	db *gorm.DB
+}
+
+// NewResultStore 使用已有的连接，自动创建或更新表结构
+func NewResultStore(db *gorm.DB) (*ResultStore, error) {
+	if err := db.AutoMigrate(&BacktestRun{}, &BacktestDaily{}, &BacktestTrade{}); err != nil {
+		return nil, err
+	}
+	return &ResultStore{db}, nil
+}
+
+func NewResultStoreWithDSN(dsn string) (*ResultStore, error) {
+	db, err := gorm.Open(mysql.Open(dsn))
+	if err != nil {
+		return nil, err
+	}
+	return NewResultStore(db)
+}
+
+// NewBacktestRun 记录回测配置和结果，数据源不保存，避免把数据库密码写进结果库
+func NewBacktestRun(cfg EngineCfg, strategy string, params map[string]float64, result *BacktestResult) BacktestRun {
+	rate := cfg.Rate
+	config := BacktestConfig{
+		Symbol:       cfg.Symbol,
+		Exchange:     cfg.Exchange,
+		Interval:     cfg.Interval.String(),
+		Start:        cfg.Start.Format(time.RFC3339),
+		Capital:      cfg.Capital,
+		Rate:         &rate,
+		Size:         cfg.Size,
+		Slippage:     cfg.Slippage,
+		Inverse:      cfg.Inverse,
+		AnnualDays:   cfg.AnnualDays,
+		Mode:         "bar",
+		Spread:       cfg.Spread,
+		Benchmark:    cfg.Benchmark,
+		Risk:         cfg.Risk,
+		OrderBook:    cfg.OrderBook,
+		MarketTrades: cfg.MarketTrades,
+		Latency:      latencySetting(cfg.Latency),
+		Contract:     cfg.Contract,
+		Strategy:     StrategySetting{Name: strategy, Params: params},
+	}
+	if !cfg.End.IsZero() {
+		config.End = cfg.End.Format(time.RFC3339)
+	}
+	if name, err := intervalName(cfg.Interval); err == nil {
+		config.Interval = name
+	}
+	if cfg.BackTestingMod == TICK {
+		config.Mode = "tick"
+	}
+
+	run := BacktestRun{
+		Strategy:   strategy,
+		Symbol:     cfg.Symbol,
+		Params:     params,
+		Config:     config,
+		GitCommit:  GitCommit(),
+		Statistics: result.Statistics,
+	}
+	run.Fingerprint = result.Fingerprint.String()
+	run.TotalNetPnl, _ = toFloat(result.Statistics["total_net_pnl"])
+	run.TotalReturn, _ = toFloat(result.Statistics["total_return"])
+	run.AnnualReturn, _ = toFloat(result.Statistics["annual_return"])
+	run.MaxDdpercent, _ = toFloat(result.Statistics["max_ddpercent"])
+	run.SharpeRatio, _ = toFloat(result.Statistics["sharpe_ratio"])
+	run.TotalTradeCount, _ = toFloat(result.Statistics["total_trade_count"])
+	return run
+}
+
+func newBacktestDaily(result *BacktestResult) []BacktestDaily {
+	balances := result.Balances()
+	rows := make([]BacktestDaily, 0, len(result.DailyResults))
+	for i, daily := range result.DailyResults {
+		rows = append(rows, BacktestDaily{
+			Date:       daily.Date,
+			ClosePrice: finite(daily.ClosePrice),
+			TradeCount: daily.TradeCount,
+			Turnover:   finite(daily.Turnover),
+			Commission: finite(daily.Commission),
+			Slippage:   finite(daily.Slippage),
+			NetPnl:     finite(daily.NetPnl),
+			Balance:    finite(balances[i].Balance),
+			Drawdown:   finite(balances[i].Drawdown),
+			DdPercent:  finite(balances[i].DdPercent),
+		})
+	}
+	return rows
+}
+
+func newBacktestTrades(trades []*TradeData) []BacktestTrade {
+	rows := make([]BacktestTrade, 0, len(trades))
+	for _, trade := range trades {
+		rows = append(rows, BacktestTrade{
+			TradeNo:   trade.TradeNo,
+			OrderNo:   trade.OrderNo,
+			Datetime:  trade.UpdatedAt.AsTime(),
+			Symbol:    trade.Symbol,
+			Direction: directionName(trade.Direction),
+			Offset:    offsetName(trade.Offset),
+			Price:     trade.Price,
+			Volume:    trade.Volume,
+		})
+	}
+	return rows
+}
+
+// finite 把 NaN 和 ±Inf 换成 0，JSON 和数据库的浮点列都不能保存非有限值
+func finite(v float64) float64 {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return 0
+	}
+	return v
+}
+
+// finiteValue 替换统计指标中的非有限值，包括嵌套的 map 和切片
+func finiteValue(v any) any {
+	switch value := v.(type) {
+	case float64:
+		return finite(value)
+	case float32:
+		return float32(finite(float64(value)))
+	case []float64:
+		values := make([]float64, len(value))
+		for i := range value {
+			values[i] = finite(value[i])
+		}
+		return values
+	case []any:
+		values := make([]any, len(value))
+		for i := range value {
+			values[i] = finiteValue(value[i])
+		}
+		return values
+	case map[string]any:
+		values := make(map[string]any, len(value))
+		for k, item := range value {
+			values[k] = finiteValue(item)
+		}
+		return values
+	default:
+		return v
+	}
+}
+
+// sanitizeRun 保存前替换记录中的非有限值，不修改调用方的 map
+func sanitizeRun(run BacktestRun) BacktestRun {
+	if run.Params != nil {
+		params := make(map[string]float64, len(run.Params))
+		for k, v := range run.Params {
+			params[k] = finite(v)
+		}
+		run.Params = params
+		run.Config.Strategy.Params = params
+	}
+	if run.Statistics != nil {
+		run.Statistics = finiteValue(run.Statistics).(map[string]any)
+	}
+	run.TotalNetPnl = finite(run.TotalNetPnl)
+	run.TotalReturn = finite(run.TotalReturn)
+	run.AnnualReturn = finite(run.AnnualReturn)
+	run.MaxDdpercent = finite(run.MaxDdpercent)
+	run.SharpeRatio = finite(run.SharpeRatio)
+	run.TotalTradeCount = finite(run.TotalTradeCount)
+	return run
+}
+
+// SaveRun 在一个事务中保存回测记录、逐日结果和成交，返回记录编号
+func (s *ResultStore) SaveRun(run BacktestRun, result *BacktestResult) (uint, error) {
+	run = sanitizeRun(run)
+	daily := newBacktestDaily(result)
+	trades := newBacktestTrades(result.Trades)
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&run).Error; err != nil {
+			return err
+		}
+		for i := range daily {
+			daily[i].RunID = run.ID
+		}
+		for i := range trades {
+			trades[i].RunID = run.ID
+		}
+		if len(daily) > 0 {
+			if err := tx.CreateInBatches(daily, 500).Error; err != nil {
+				return err
+			}
+		}
+		if len(trades) > 0 {
+			return tx.CreateInBatches(trades, 500).Error
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return run.ID, nil
+}
+
+// ListRuns 按时间倒序列出回测记录
+func (s *ResultStore) ListRuns(filter RunFilter) ([]BacktestRun, error) {
+	query := s.db.Order("id desc")
+	if filter.Strategy != "" {
+		query = query.Where("strategy = ?", filter.Strategy)
+	}
+	if filter.Symbol != "" {
+		query = query.Where("symbol = ?", filter.Symbol)
+	}
+	if filter.Limit > 0 {
+		query = query.Limit(filter.Limit)
+	}
+
+	var runs []BacktestRun
+	if err := query.Find(&runs).Error; err != nil {
+		return nil, err
+	}
+	return runs, nil
+}
+
+func (s *ResultStore) GetRun(id uint) (*BacktestRun, error) {
+	var run BacktestRun
+	if err := s.db.First(&run, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("回测记录不存在: %d", id)
+		}
+		return nil, err
+	}
+	return &run, nil
+}
+
+func (s *ResultStore) RunDaily(id uint) ([]BacktestDaily, error) {
+	var daily []BacktestDaily
+	err := s.db.Where("run_id = ?", id).Order("date").Find(&daily).Error
+	return daily, err
+}
+
+func (s *ResultStore) RunTrades(id uint) ([]BacktestTrade, error) {
+	var trades []BacktestTrade
+	err := s.db.Where("run_id = ?", id).Order("id").Find(&trades).Error
+	return trades, err
+}
+
+// CompareRuns 按传入的顺序返回多条记录，用于并排对比统计指标
+func (s *ResultStore) CompareRuns(ids ...uint) ([]BacktestRun, error) {
+	if len(ids) < 2 {
+		return nil, errors.New("至少需要两条回测记录")
+	}
+	runs := make([]BacktestRun, 0, len(ids))
+	for _, id := range ids {
+		run, err := s.GetRun(id)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, *run)
+	}
+	return runs, nil
+}
+
+// DeleteRun 删除回测记录及其逐日结果和成交
+func (s *ResultStore) DeleteRun(id uint) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("run_id = ?", id).Delete(&BacktestDaily{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("run_id = ?", id).Delete(&BacktestTrade{}).Error; err != nil {
+			return err
+		}
+		result := tx.Delete(&BacktestRun{}, id)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return fmt.Errorf("回测记录不存在: %d", id)
+		}
+		return nil
+	})
+}
+
+// GitCommit 当前代码的提交，优先使用编译时写入的版本信息，都取不到时为空
+func GitCommit() string {
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			if setting.Key == "vcs.revision" {
+				return setting.Value
+			}
+		}
+	}
+	out, err := exec.Command("git", "rev-parse", "HEAD").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
@@ -0,0 +1,203 @@
+package internal
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+func TestNewBacktestRun(t *testing.T) {
+	result := evaluateTestBacktest(t)
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	cfg := EngineCfg{Symbol: "BTCUSDT", Start: start, End: start.Add(5 * 24 * time.Hour), Interval: 24 * time.Hour, Capital: 1000, Size: 1}
+
+	run := NewBacktestRun(cfg, "config_test", map[string]float64{"window": 20}, result)
+	if run.TotalNetPnl != 10 || run.Symbol != "BTCUSDT" || run.Config.Strategy.Params["window"] != 20 {
+		t.Fatalf("run: %+v", run)
+	}
+
+	// 保存的配置可以重新生成同样的引擎配置
+	run.Config.Data.Dir = t.TempDir()
+	restored, err := run.Config.EngineCfg()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !restored.Start.Equal(cfg.Start) || !restored.End.Equal(cfg.End) || restored.Interval != cfg.Interval || restored.Capital != cfg.Capital {
+		t.Fatalf("restored: %+v", restored)
+	}
+
+	daily := newBacktestDaily(result)
+	if len(daily) != len(result.DailyResults) || daily[len(daily)-1].Balance != 1010 {
+		t.Fatalf("daily: %+v", daily)
+	}
+	trades := newBacktestTrades(result.Trades)
+	if len(trades) != 2 || trades[0].Direction != "LONG" || trades[1].Price != 120 {
+		t.Fatalf("trades: %+v", trades)
+	}
+}
+
+// dryRunPool 只支持开启和提交事务，DryRun 模式下 gorm 不会执行语句
+type dryRunPool struct{}
+
+var errDryRun = errors.New("dry run")
+
+func (*dryRunPool) PrepareContext(context.Context, string) (*sql.Stmt, error) {
+	return nil, errDryRun
+}
+
+func (*dryRunPool) ExecContext(context.Context, string, ...any) (sql.Result, error) {
+	return nil, errDryRun
+}
+
+func (*dryRunPool) QueryContext(context.Context, string, ...any) (*sql.Rows, error) {
+	return nil, errDryRun
+}
+
+func (*dryRunPool) QueryRowContext(context.Context, string, ...any) *sql.Row {
+	return nil
+}
+
+func (p *dryRunPool) BeginTx(context.Context, *sql.TxOptions) (gorm.ConnPool, error) {
+	return p, nil
+}
+
+func (*dryRunPool) Commit() error   { return nil }
+func (*dryRunPool) Rollback() error { return nil }
+
+type dryRunStatement struct {
+	sql  string
+	vars []any
+}
+
+// newDryRunStore 返回只生成不执行 SQL 的结果库，以及生成的语句
+// DryRun 下保存点语句会留在 Statement 里，关闭嵌套事务后批量插入才会生成
+func newDryRunStore(t *testing.T) (*ResultStore, *[]dryRunStatement) {
+	db, err := gorm.Open(mysql.New(mysql.Config{Conn: new(dryRunPool), SkipInitializeWithVersion: true}), &gorm.Config{DryRun: true, DisableNestedTransaction: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	statements := new([]dryRunStatement)
+	record := func(db *gorm.DB) {
+		*statements = append(*statements, dryRunStatement{db.Statement.SQL.String(), db.Statement.Vars})
+	}
+	for name, processor := range map[string]interface {
+		Register(string, func(*gorm.DB)) error
+	}{
+		"gorm:create": db.Callback().Create().After("gorm:create"),
+		"gorm:query":  db.Callback().Query().After("gorm:query"),
+		"gorm:delete": db.Callback().Delete().After("gorm:delete"),
+	} {
+		if err = processor.Register("test:record_"+name, record); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return &ResultStore{db}, statements
+}
+
+func TestStoreSaveRun(t *testing.T) {
+	store, statements := newDryRunStore(t)
+	statistics := map[string]any{
+		"sharpe_ratio":  math.NaN(),
+		"max_ddpercent": math.Inf(-1),
+		"total_net_pnl": 10.0,
+		"nested":        map[string]any{"ratio": math.Inf(1)},
+	}
+	run := BacktestRun{
+		Strategy:     "boll",
+		Symbol:       "BTCUSDT",
+		Params:       map[string]float64{"window": math.Inf(1)},
+		Statistics:   statistics,
+		SharpeRatio:  math.NaN(),
+		MaxDdpercent: math.Inf(-1),
+		TotalNetPnl:  10,
+	}
+	result := &BacktestResult{
+		DailyResults: []*DailyResult{{Date: "2022-01-01", ClosePrice: 100, NetPnl: math.NaN()}},
+		Statistics:   statistics,
+	}
+	if _, err := store.SaveRun(run, result); err != nil {
+		t.Fatal(err)
+	}
+	if !math.IsNaN(statistics["sharpe_ratio"].(float64)) {
+		t.Fatal("caller statistics modified")
+	}
+
+	tables := make([]string, 0)
+	for _, statement := range *statements {
+		tables = append(tables, statement.sql)
+		for _, v := range statement.vars {
+			// 和驱动执行时一样先取 Valuer 的值，json 序列化的列在这里编码
+			if valuer, ok := v.(driver.Valuer); ok {
+				var err error
+				if v, err = valuer.Value(); err != nil {
+					t.Fatalf("%s: %v", statement.sql, err)
+				}
+			}
+			if f, ok := v.(float64); ok && (math.IsNaN(f) || math.IsInf(f, 0)) {
+				t.Fatalf("%s: %v", statement.sql, v)
+			}
+			if b, ok := v.([]byte); ok && strings.Contains(string(b), "window") && !strings.Contains(string(b), `"window":0`) {
+				t.Fatalf("params: %s", b)
+			}
+		}
+	}
+	if len(tables) != 2 || !strings.Contains(tables[0], "INSERT INTO `backtest_runs`") || !strings.Contains(tables[1], "INSERT INTO `backtest_daily`") {
+		t.Fatalf("statements: %v", tables)
+	}
+}
+
+func TestStoreListRuns(t *testing.T) {
+	store, statements := newDryRunStore(t)
+	if _, err := store.ListRuns(RunFilter{Strategy: "boll", Symbol: "BTCUSDT", Limit: 5}); err != nil {
+		t.Fatal(err)
+	}
+	if len(*statements) != 1 {
+		t.Fatalf("statements: %v", *statements)
+	}
+	statement := (*statements)[0]
+	if statement.sql != "SELECT * FROM `backtest_runs` WHERE strategy = ? AND symbol = ? ORDER BY id desc LIMIT 5" ||
+		len(statement.vars) != 2 || statement.vars[0] != "boll" || statement.vars[1] != "BTCUSDT" {
+		t.Fatalf("list: %s %v", statement.sql, statement.vars)
+	}
+}
+
+func TestStoreCompareRuns(t *testing.T) {
+	store, statements := newDryRunStore(t)
+	if _, err := store.CompareRuns(1); err == nil {
+		t.Fatal("expect error")
+	}
+	runs, err := store.CompareRuns(3, 1)
+	if err != nil || len(runs) != 2 {
+		t.Fatalf("compare: %v %v", runs, err)
+	}
+	if len(*statements) != 2 || (*statements)[0].vars[0] != uint(3) || (*statements)[1].vars[0] != uint(1) {
+		t.Fatalf("statements: %v", *statements)
+	}
+}
+
+// DryRun 不执行删除，影响行数为 0，走记录不存在的分支
+func TestStoreDeleteRun(t *testing.T) {
+	store, statements := newDryRunStore(t)
+	err := store.DeleteRun(7)
+	if err == nil || err.Error() != "回测记录不存在: 7" {
+		t.Fatalf("delete: %v", err)
+	}
+	tables := []string{"`backtest_daily`", "`backtest_trades`", "`backtest_runs`"}
+	if len(*statements) != len(tables) {
+		t.Fatalf("statements: %v", *statements)
+	}
+	for i, table := range tables {
+		statement := (*statements)[i]
+		if !strings.HasPrefix(statement.sql, "DELETE FROM "+table) || statement.vars[0] != uint(7) {
+			t.Fatalf("delete: %s %v", statement.sql, statement.vars)
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	expb "newgitlab.com/xquant/exchange-protocols/protocols/src/go"
+)
+
+// RiskConfig 下单前的风控规则，为 0 的规则不检查
+type RiskConfig struct {
+	// 单笔委托的最大数量
+	MaxOrderVolume float64 `yaml:"max_order_volume" toml:"max_order_volume" json:"max_order_volume"`
+	// 持仓加上同方向未成交委托的最大绝对值
+	MaxPosition float64 `yaml:"max_position" toml:"max_position" json:"max_position"`
+	// 最多同时存在的活动委托数
+	MaxActiveOrders int `yaml:"max_active_orders" toml:"max_active_orders" json:"max_active_orders"`
+	// 最近一分钟内最多发出的委托数
+	MaxOrdersPerMinute int `yaml:"max_orders_per_minute" toml:"max_orders_per_minute" json:"max_orders_per_minute"`
+	// 当日亏损达到该金额后只能减仓
+	MaxDailyLoss float64 `yaml:"max_daily_loss" toml:"max_daily_loss" json:"max_daily_loss"`
+	// 委托价偏离最新价的最大比例，如 0.05 表示 5%
+	MaxPriceDeviation float64 `yaml:"max_price_deviation" toml:"max_price_deviation" json:"max_price_deviation"`
+}
+
+func (c RiskConfig) Check() error {
+	var errs CheckErrors
+	if c.MaxOrderVolume < 0 {
+		errs = append(errs, errors.New("risk.max_order_volume不能为负数"))
+	}
+	if c.MaxPosition < 0 {
+		errs = append(errs, errors.New("risk.max_position不能为负数"))
+	}
+	if c.MaxActiveOrders < 0 {
+		errs = append(errs, errors.New("risk.max_active_orders不能为负数"))
+	}
+	if c.MaxOrdersPerMinute < 0 {
+		errs = append(errs, errors.New("risk.max_orders_per_minute不能为负数"))
+	}
+	if c.MaxDailyLoss < 0 {
+		errs = append(errs, errors.New("risk.max_daily_loss不能为负数"))
+	}
+	if c.MaxPriceDeviation < 0 {
+		errs = append(errs, errors.New("risk.max_price_deviation不能为负数"))
+	}
+	return errs.Err()
+}
+
+// riskManager 跟踪一个策略的持仓、活动委托和当日盈亏，在委托发出前检查
+// 引擎在把行情和本策略的回报转给策略之前更新风控，规则都为 0 时只拒绝数量不大于 0 的委托
+type riskManager struct {
+	RiskConfig
+	size float64
+
+	mu           sync.Mutex
+	pos          float64
+	activeOrders map[string]*OrderData
+	sent         []time.Time
+
+	// 当日盈亏按成交的现金流加持仓市值计算，dayStart 为当日开始时的权益
+	lastPrice float64
+	cash      float64
+	day       string
+	dayStart  float64
+}
+
+func newRiskManager(cfg RiskConfig, size float64) *riskManager {
+	if size == 0 {
+		size = 1
+	}
+	return &riskManager{
+		RiskConfig:   cfg,
+		size:         size,
+		activeOrders: make(map[string]*OrderData),
+	}
+}
+
+// check 返回拒绝的原因，通过时返回 nil
+func (r *riskManager) check(req OrderRequest, now time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if req.Volume <= 0 {
+		return errors.New("委托数量必须大于0")
+	}
+	if err := req.check(); err != nil {
+		return err
+	}
+	if r.MaxOrderVolume > 0 && req.Volume > r.MaxOrderVolume {
+		return fmt.Errorf("委托数量%v超过单笔上限%v", req.Volume, r.MaxOrderVolume)
+	}
+	if r.MaxActiveOrders > 0 && len(r.activeOrders) >= r.MaxActiveOrders {
+		return fmt.Errorf("活动委托数已达上限%d", r.MaxActiveOrders)
+	}
+	if r.MaxOrdersPerMinute > 0 && r.recentOrders(now) >= r.MaxOrdersPerMinute {
+		return fmt.Errorf("每分钟委托数已达上限%d", r.MaxOrdersPerMinute)
+	}
+
+	volume := signedVolume(req.Direction, req.Volume)
+	if r.MaxPosition > 0 {
+		pos := r.pos + volume
+		for _, order := range r.activeOrders {
+			if order.Direction == req.Direction {
+				pos += signedVolume(order.Direction, order.Volume-order.Traded)
+			}
+		}
+		if math.Abs(pos) > r.MaxPosition {
+			return fmt.Errorf("委托后持仓%v超过上限%v", pos, r.MaxPosition)
+		}
+	}
+
+	reduce := r.pos*volume < 0 && math.Abs(volume) <= math.Abs(r.pos)
+	if r.MaxDailyLoss > 0 && !reduce {
+		if loss := r.dayStart - r.equity(); r.day != "" && loss >= r.MaxDailyLoss {
+			return fmt.Errorf("当日亏损%.2f达到上限%.2f，只能减仓", loss, r.MaxDailyLoss)
+		}
+	}
+
+	if r.MaxPriceDeviation > 0 && r.lastPrice > 0 && req.Type != MARKET {
+		deviation := math.Abs(req.Price-r.lastPrice) / r.lastPrice
+		if deviation > r.MaxPriceDeviation {
+			return fmt.Errorf("委托价%v偏离最新价%v超过%.2f%%", req.Price, r.lastPrice, r.MaxPriceDeviation*100)
+		}
+	}
+	return nil
+}
+
+// recentOrders 最近一分钟内发出的委托数，同时清理更早的记录
+func (r *riskManager) recentOrders(now time.Time) int {
+	start := now.Add(-time.Minute)
+	i := 0
+	for i < len(r.sent) && !r.sent[i].After(start) {
+		i++
+	}
+	r.sent = r.sent[i:]
+	return len(r.sent)
+}
+
+// addOrder 记录通过检查并已发出的委托
+func (r *riskManager) addOrder(order OrderData, now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.activeOrders[order.OrderNo] = &order
+	if r.MaxOrdersPerMinute > 0 {
+		r.sent = append(r.sent, now)
+	}
+}
+
+func (r *riskManager) updateOrder(order OrderData) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	active, ok := r.activeOrders[order.OrderNo]
+	if !ok {
+		return
+	}
+	switch order.Status {
+	case expb.Status_ALL_TRADED, expb.Status_CANCELLED, expb.Status_REJECTED:
+		delete(r.activeOrders, order.OrderNo)
+	default:
+		active.Traded = order.Traded
+	}
+}
+
+func (r *riskManager) updateTrade(trade TradeData) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	volume := signedVolume(trade.Direction, trade.Volume)
+	r.pos += volume
+	r.cash -= volume * trade.Price * r.size
+	if r.lastPrice == 0 {
+		r.lastPrice = trade.Price
+	}
+}
+
+func (r *riskManager) updatePrice(price float64, now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// 换日时用上一个价格计算的权益作为当日起点
+	if day := now.Format("2006-01-02"); day != r.day {
+		r.day = day
+		r.dayStart = r.equity()
+	}
+	r.lastPrice = price
+}
+
+func (r *riskManager) latestPrice() float64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.lastPrice
+}
+
+func (r *riskManager) equity() float64 {
+	return r.cash + r.pos*r.lastPrice*r.size
+}
+
+func signedVolume(direction expb.Direction, volume float64) float64 {
+	if direction == expb.Direction_SHORT {
+		return -volume
+	}
+	return volume
+}
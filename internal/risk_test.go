@@ -0,0 +1,154 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	expb "newgitlab.com/xquant/exchange-protocols/protocols/src/go"
+)
+
+func TestRiskManager(t *testing.T) {
+	now := time.Date(2022, 1, 1, 9, 0, 0, 0, time.UTC)
+	buy := func(price, volume float64) OrderRequest {
+		return OrderRequest{Direction: expb.Direction_LONG, Price: price, Volume: volume}
+	}
+	sell := func(price, volume float64) OrderRequest {
+		return OrderRequest{Direction: expb.Direction_SHORT, Price: price, Volume: volume}
+	}
+	expect := func(r *riskManager, req OrderRequest, reason string) {
+		t.Helper()
+		err := r.check(req, now)
+		switch {
+		case reason == "" && err != nil:
+			t.Fatalf("rejected: %v", err)
+		case reason != "" && (err == nil || !strings.Contains(err.Error(), reason)):
+			t.Fatalf("expect %s, got %v", reason, err)
+		}
+	}
+
+	r := newRiskManager(RiskConfig{}, 1)
+	expect(r, buy(100, 0), "委托数量必须大于0")
+	expect(r, buy(100, 1e9), "")
+
+	r = newRiskManager(RiskConfig{MaxOrderVolume: 5}, 1)
+	expect(r, buy(100, 6), "单笔上限")
+	expect(r, buy(100, 5), "")
+
+	// 未成交的同方向委托计入持仓
+	r = newRiskManager(RiskConfig{MaxPosition: 10}, 1)
+	r.addOrder(OrderData{OrderNo: "1", Direction: expb.Direction_LONG, Volume: 6}, now)
+	expect(r, buy(100, 5), "持仓")
+	expect(r, sell(100, 5), "")
+	r.updateOrder(OrderData{OrderNo: "1", Status: expb.Status_CANCELLED})
+	expect(r, buy(100, 5), "")
+
+	r = newRiskManager(RiskConfig{MaxActiveOrders: 1}, 1)
+	r.addOrder(OrderData{OrderNo: "1", Direction: expb.Direction_LONG, Volume: 1}, now)
+	expect(r, buy(100, 1), "活动委托数")
+	r.updateOrder(OrderData{OrderNo: "1", Status: expb.Status_ALL_TRADED})
+	expect(r, buy(100, 1), "")
+
+	r = newRiskManager(RiskConfig{MaxOrdersPerMinute: 2}, 1)
+	r.addOrder(OrderData{OrderNo: "1"}, now.Add(-90*time.Second))
+	r.addOrder(OrderData{OrderNo: "2"}, now.Add(-30*time.Second))
+	r.addOrder(OrderData{OrderNo: "3"}, now.Add(-10*time.Second))
+	expect(r, buy(100, 1), "每分钟")
+	now = now.Add(31 * time.Second)
+	expect(r, buy(100, 1), "")
+
+	r = newRiskManager(RiskConfig{MaxPriceDeviation: 0.05}, 1)
+	r.updatePrice(100, now)
+	expect(r, buy(106, 1), "偏离最新价")
+	expect(r, sell(95, 1), "")
+
+	// 当日亏损达到上限后只能减仓，换日后恢复
+	r = newRiskManager(RiskConfig{MaxDailyLoss: 100}, 10)
+	r.updatePrice(100, now)
+	r.updateTrade(TradeData{Direction: expb.Direction_LONG, Price: 100, Volume: 2})
+	r.updatePrice(95, now)
+	expect(r, buy(95, 1), "当日亏损")
+	expect(r, sell(95, 3), "当日亏损")
+	expect(r, sell(95, 2), "")
+	r.updatePrice(95, now.Add(24*time.Hour))
+	expect(r, buy(95, 1), "")
+}
+
+type riskTestStrategy struct {
+	StrategyTemplate
+	bars     int
+	rejected []OrderData
+}
+
+func (s *riskTestStrategy) OnBar(bar BarData) {
+	s.bars++
+	if s.bars == 1 {
+		s.Buy(bar.ClosePrice, 10)
+		s.Buy(bar.ClosePrice, 1)
+	}
+}
+
+func (s *riskTestStrategy) OnOrder(order OrderData) {
+	if order.Status == expb.Status_REJECTED {
+		s.rejected = append(s.rejected, order)
+	}
+}
+
+func TestBacktestRisk(t *testing.T) {
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	bars := make([]BarData, 0)
+	for i := 0; i < 4; i++ {
+		bars = append(bars, newTestBar("BTCUSDT", start.Add(time.Duration(i)*time.Hour), 100, 100, 100, 100))
+	}
+
+	strategy := new(riskTestStrategy)
+	result, err := Evaluate(EngineCfg{
+		Strategy:   strategy,
+		DataRepo:   &memoryRepo{bars: map[string][]BarData{"BTCUSDT": bars}},
+		Symbol:     "BTCUSDT",
+		Start:      start,
+		End:        start.Add(4 * time.Hour),
+		Interval:   time.Hour,
+		Capital:    1000,
+		Size:       1,
+		AnnualDays: 365,
+		Risk:       RiskConfig{MaxOrderVolume: 5},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(strategy.rejected) != 1 || !strings.Contains(strategy.rejected[0].Reference, "单笔上限") {
+		t.Fatalf("rejected: %+v", strategy.rejected)
+	}
+	if len(result.Orders) != 2 || result.Orders[0].Status != expb.Status_REJECTED || result.Orders[1].Status != expb.Status_ALL_TRADED {
+		t.Fatalf("orders: %+v", result.Orders)
+	}
+	if len(result.Trades) != 1 || result.Trades[0].Volume != 1 {
+		t.Fatalf("trades: %+v", result.Trades)
+	}
+}
+
+func TestLiveRisk(t *testing.T) {
+	market := new(fakeMarketGateway)
+	strategy := new(riskTestStrategy)
+	engine, err := NewLiveEngine(LiveEngineCfg{
+		Strategy: strategy,
+		// 行情接口收到委托会 panic，被拒绝的委托不会发到交易接口
+		Gateway: market,
+		Symbol:  "BTCUSDT",
+		Risk:    RiskConfig{MaxOrderVolume: 0.5},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = engine.Start(); err != nil {
+		t.Fatal(err)
+	}
+	market.events.Put(Event{Type: EventBar, Data: newTestBar("BTCUSDT", time.Now(), 100, 100, 100, 100)})
+	engine.Stop()
+
+	if len(strategy.rejected) != 2 || strategy.rejected[1].OrderNo != "risk.2" {
+		t.Fatalf("rejected: %+v", strategy.rejected)
+	}
+}
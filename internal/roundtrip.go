@@ -0,0 +1,207 @@
+package internal
+
+import (
+	"math"
+	"time"
+
+	expb "newgitlab.com/xquant/exchange-protocols/protocols/src/go"
+)
+
+// RoundTrip 一笔开仓和对应的平仓，按先进先出配对，部分平仓拆成多笔
+// Mae、Mfe 为持仓期间最不利、最有利价格对应的浮动盈亏
+type RoundTrip struct {
+	Symbol      string
+	Direction   expb.Direction
+	EntryTime   time.Time
+	ExitTime    time.Time
+	EntryPrice  float64
+	ExitPrice   float64
+	Volume      float64
+	Pnl         float64
+	Commission  float64
+	Slippage    float64
+	NetPnl      float64
+	HoldingTime time.Duration
+	Mae         float64
+	Mfe         float64
+}
+
+// openLot 未平仓的开仓成交，high、low 记录开仓以来的价格范围
+type openLot struct {
+	trade     *TradeData
+	volume    float64
+	high, low float64
+}
+
+// roundTripTracker 回放时跟踪持仓，平仓时生成 RoundTrip
+type roundTripTracker struct {
+	size, rate, slippage float64
+	inverse              bool
+
+	lots  []*openLot
+	trips []RoundTrip
+}
+
+func newRoundTripTracker(cfg EngineCfg) *roundTripTracker {
+	return &roundTripTracker{size: cfg.Size, rate: cfg.Rate, slippage: cfg.Slippage, inverse: cfg.Inverse}
+}
+
+// updatePrice 每根K线或每个tick撮合之后更新持仓期间的价格范围
+func (r *roundTripTracker) updatePrice(high, low float64) {
+	for _, lot := range r.lots {
+		lot.high = math.Max(lot.high, high)
+		lot.low = math.Min(lot.low, low)
+	}
+}
+
+func (r *roundTripTracker) addTrade(trade *TradeData) {
+	volume := trade.Volume
+	for volume > 0 && len(r.lots) > 0 && r.lots[0].trade.Direction != trade.Direction {
+		lot := r.lots[0]
+		closed := math.Min(volume, lot.volume)
+		r.trips = append(r.trips, r.newRoundTrip(lot, trade, closed))
+
+		lot.volume -= closed
+		volume -= closed
+		if lot.volume <= 1e-12 {
+			r.lots = r.lots[1:]
+		}
+	}
+	if volume > 1e-12 {
+		r.lots = append(r.lots, &openLot{trade: trade, volume: volume, high: trade.Price, low: trade.Price})
+	}
+}
+
+func (r *roundTripTracker) newRoundTrip(lot *openLot, exit *TradeData, volume float64) RoundTrip {
+	entry := lot.trade
+	trip := RoundTrip{
+		Symbol:      entry.Symbol,
+		Direction:   entry.Direction,
+		EntryTime:   entry.UpdatedAt.AsTime(),
+		ExitTime:    exit.UpdatedAt.AsTime(),
+		EntryPrice:  entry.Price,
+		ExitPrice:   exit.Price,
+		Volume:      volume,
+		Pnl:         r.pnl(entry.Direction, entry.Price, exit.Price, volume),
+	}
+	trip.HoldingTime = trip.ExitTime.Sub(trip.EntryTime)
+
+	for _, price := range []float64{entry.Price, exit.Price} {
+		_, commission, slippage := tradeCost(price, volume, r.size, r.rate, r.slippage, r.inverse)
+		trip.Commission += commission
+		trip.Slippage += slippage
+	}
+	trip.NetPnl = trip.Pnl - trip.Commission - trip.Slippage
+
+	high := r.pnl(entry.Direction, entry.Price, math.Max(lot.high, exit.Price), volume)
+	low := r.pnl(entry.Direction, entry.Price, math.Min(lot.low, exit.Price), volume)
+	trip.Mae, trip.Mfe = math.Min(math.Min(high, low), 0), math.Max(math.Max(high, low), 0)
+	return trip
+}
+
+func (r *roundTripTracker) pnl(direction expb.Direction, entry, exit, volume float64) float64 {
+	if direction == expb.Direction_SHORT {
+		volume = -volume
+	}
+	if r.inverse {
+		return volume * (1/entry - 1/exit) * r.size
+	}
+	return volume * (exit - entry) * r.size
+}
+
+// tradeCost 一笔成交的成交额、手续费和滑点，逐日盈亏和逐笔盈亏共用
+func tradeCost(price, volume, size, rate, slippage float64, inverse bool) (turnover, commission, slippageCost float64) {
+	if inverse {
+		turnover = volume * size / price
+		slippageCost = volume * size * slippage / (price * 2) // todo: **2
+	} else {
+		turnover = volume * size * price
+		slippageCost = volume * size * slippage
+	}
+	return turnover, turnover * rate, slippageCost
+}
+
+// roundTripStatistics 逐笔交易的统计，盈亏按扣除费用后的净盈亏计算
+func roundTripStatistics(trips []RoundTrip) map[string]any {
+	var (
+		winCount, lossCount           int
+		totalWin, totalLoss, totalNet float64
+		winStreak, lossStreak         int
+		maxWinStreak, maxLossStreak   int
+		holding                       time.Duration
+		totalMae, totalMfe            float64
+		longCount, longWin            int
+		shortCount, shortWin          int
+		longNet, shortNet             float64
+	)
+
+	for _, trip := range trips {
+		win := trip.NetPnl > 0
+		switch {
+		case win:
+			winCount++
+			totalWin += trip.NetPnl
+			winStreak, lossStreak = winStreak+1, 0
+		case trip.NetPnl < 0:
+			lossCount++
+			totalLoss += trip.NetPnl
+			winStreak, lossStreak = 0, lossStreak+1
+		default:
+			winStreak, lossStreak = 0, 0
+		}
+		maxWinStreak = Max(maxWinStreak, winStreak)
+		maxLossStreak = Max(maxLossStreak, lossStreak)
+
+		totalNet += trip.NetPnl
+		holding += trip.HoldingTime
+		totalMae += trip.Mae
+		totalMfe += trip.Mfe
+
+		if trip.Direction == expb.Direction_LONG {
+			longCount++
+			longNet += trip.NetPnl
+			if win {
+				longWin++
+			}
+		} else {
+			shortCount++
+			shortNet += trip.NetPnl
+			if win {
+				shortWin++
+			}
+		}
+	}
+
+	count := len(trips)
+	averageWin := ratio(totalWin, float64(winCount))
+	averageLoss := ratio(totalLoss, float64(lossCount))
+	return map[string]any{
+		"round_trip_count":      count,
+		"win_count":             winCount,
+		"loss_count":            lossCount,
+		"win_rate":              ratio(float64(winCount), float64(count)) * 100,
+		"average_win":           averageWin,
+		"average_loss":          averageLoss,
+		"payoff_ratio":          ratio(averageWin, -averageLoss),
+		"average_net_pnl":       ratio(totalNet, float64(count)),
+		"max_win_streak":        maxWinStreak,
+		"max_loss_streak":       maxLossStreak,
+		"average_holding_hours": ratio(holding.Hours(), float64(count)),
+		"average_mae":           ratio(totalMae, float64(count)),
+		"average_mfe":           ratio(totalMfe, float64(count)),
+		"long_count":            longCount,
+		"long_win_rate":         ratio(float64(longWin), float64(longCount)) * 100,
+		"long_net_pnl":          longNet,
+		"short_count":           shortCount,
+		"short_win_rate":        ratio(float64(shortWin), float64(shortCount)) * 100,
+		"short_net_pnl":         shortNet,
+	}
+}
+
+// ratio 分母为 0 时返回 0，避免统计结果出现 NaN
+func ratio(a, b float64) float64 {
+	if b == 0 {
+		return 0
+	}
+	return a / b
+}
@@ -0,0 +1,50 @@
+package internal
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+	expb "newgitlab.com/xquant/exchange-protocols/protocols/src/go"
+)
+
+func newTestTrade(direction expb.Direction, price, volume float64, t time.Time) *TradeData {
+	return &TradeData{Symbol: "BTCUSDT", Direction: direction, Price: price, Volume: volume, UpdatedAt: timestamppb.New(t)}
+}
+
+func TestRoundTripTracker(t *testing.T) {
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	tracker := &roundTripTracker{size: 1}
+
+	// 100、110 各买 1，以 120 卖 3：先平两笔多头，剩余 1 开空，再以 100 买回
+	tracker.addTrade(newTestTrade(expb.Direction_LONG, 100, 1, start))
+	tracker.updatePrice(105, 95)
+	tracker.addTrade(newTestTrade(expb.Direction_LONG, 110, 1, start.Add(time.Hour)))
+	tracker.updatePrice(112, 90)
+	tracker.addTrade(newTestTrade(expb.Direction_SHORT, 120, 3, start.Add(2*time.Hour)))
+	tracker.updatePrice(125, 118)
+	tracker.addTrade(newTestTrade(expb.Direction_LONG, 100, 1, start.Add(4*time.Hour)))
+
+	trips := tracker.trips
+	if len(trips) != 3 || len(tracker.lots) != 0 {
+		t.Fatalf("trips: %+v lots: %d", trips, len(tracker.lots))
+	}
+	if trips[0].Pnl != 20 || trips[0].Mae != -10 || trips[0].Mfe != 20 || trips[0].HoldingTime != 2*time.Hour {
+		t.Fatalf("first: %+v", trips[0])
+	}
+	if trips[1].Pnl != 10 || trips[1].Mae != -20 {
+		t.Fatalf("second: %+v", trips[1])
+	}
+	if trips[2].Direction != expb.Direction_SHORT || trips[2].Pnl != 20 || trips[2].Mae != -5 || trips[2].Mfe != 20 {
+		t.Fatalf("third: %+v", trips[2])
+	}
+
+	statistics := roundTripStatistics(append(trips, RoundTrip{Direction: expb.Direction_SHORT, NetPnl: -25}))
+	if statistics["win_rate"] != 75.0 || math.Abs(statistics["payoff_ratio"].(float64)-2.0/3) > 1e-9 {
+		t.Fatalf("statistics: %v", statistics)
+	}
+	if statistics["max_win_streak"] != 3 || statistics["max_loss_streak"] != 1 || statistics["short_net_pnl"] != -5.0 {
+		t.Fatalf("statistics: %v", statistics)
+	}
+}
@@ -0,0 +1,234 @@
+package internal
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+
+	expb "newgitlab.com/xquant/exchange-protocols/protocols/src/go"
+)
+
+// SpreadLeg 价差的一条腿
+// PriceMultiplier 用于计算价差价格，TradingMultiplier 用于把价差数量换算成腿的数量
+// Size 和 Inverse 是腿的合约乘数和是否反向合约，用于计算腿的盈亏，Size 为 0 时使用引擎的设置
+type SpreadLeg struct {
+	Symbol            string   `yaml:"symbol" toml:"symbol" json:"symbol"`
+	Exchange          Exchange `yaml:"exchange" toml:"exchange" json:"exchange"`
+	PriceMultiplier   float64  `yaml:"price_multiplier" toml:"price_multiplier" json:"price_multiplier"`
+	TradingMultiplier float64  `yaml:"trading_multiplier" toml:"trading_multiplier" json:"trading_multiplier"`
+	Size              float64  `yaml:"size" toml:"size" json:"size"`
+	Inverse           bool     `yaml:"inverse" toml:"inverse" json:"inverse"`
+}
+
+// SpreadData 由多条腿合成的价差合约
+type SpreadData struct {
+	Name string      `yaml:"name" toml:"name" json:"name"`
+	Legs []SpreadLeg `yaml:"legs" toml:"legs" json:"legs"`
+}
+
+func (s *SpreadData) Check() error {
+	if s.Name == "" {
+		return errors.New("spread名称不能为空")
+	}
+	if len(s.Legs) < 2 {
+		return errors.New("spread至少需要两条腿")
+	}
+	symbols := make(map[string]struct{}, len(s.Legs))
+	for _, leg := range s.Legs {
+		if leg.Symbol == "" {
+			return errors.New("spread腿的symbol不能为空")
+		}
+		if _, ok := symbols[leg.Symbol]; ok {
+			return fmt.Errorf("spread腿重复: %s", leg.Symbol)
+		}
+		symbols[leg.Symbol] = struct{}{}
+		if leg.PriceMultiplier == 0 {
+			return fmt.Errorf("spread腿%s的价格乘数不能为0", leg.Symbol)
+		}
+		if leg.TradingMultiplier == 0 {
+			return fmt.Errorf("spread腿%s的交易乘数不能为0", leg.Symbol)
+		}
+		if leg.Size < 0 {
+			return fmt.Errorf("spread腿%s的合约乘数不能为负数", leg.Symbol)
+		}
+	}
+	return nil
+}
+
+// CalculatePrice 根据各腿价格计算价差价格
+func (s *SpreadData) CalculatePrice(prices map[string]float64) float64 {
+	var price float64
+	for _, leg := range s.Legs {
+		price += leg.PriceMultiplier * prices[leg.Symbol]
+	}
+	return price
+}
+
+// CalculateBar 用同一时刻的各腿K线合成价差K线
+// 开收盘价是精确值，最高最低价取各腿极值的组合，是价差区间的上下界
+func (s *SpreadData) CalculateBar(legs map[string]BarData) BarData {
+	var bar BarData
+	bar.Symbol = s.Name
+	bar.Volume = math.MaxFloat64
+	for _, leg := range s.Legs {
+		legBar := legs[leg.Symbol]
+		if bar.UpdatedAt == nil {
+			bar.UpdatedAt = legBar.UpdatedAt
+		}
+		bar.OpenPrice += leg.PriceMultiplier * legBar.OpenPrice
+		bar.ClosePrice += leg.PriceMultiplier * legBar.ClosePrice
+		if leg.PriceMultiplier > 0 {
+			bar.HighPrice += leg.PriceMultiplier * legBar.HighPrice
+			bar.LowPrice += leg.PriceMultiplier * legBar.LowPrice
+		} else {
+			bar.HighPrice += leg.PriceMultiplier * legBar.LowPrice
+			bar.LowPrice += leg.PriceMultiplier * legBar.HighPrice
+		}
+		bar.Volume = Min(bar.Volume, legBar.Volume/math.Abs(leg.TradingMultiplier))
+	}
+	return bar
+}
+
+// CalculateTick 用各腿最新的tick合成价差tick
+// 买价由正乘数腿的买价和负乘数腿的卖价组成，卖价反之，挂单量取各腿能成交的最小价差数量
+func (s *SpreadData) CalculateTick(legs map[string]TickData) TickData {
+	var tick TickData
+	tick.Symbol = s.Name
+	tick.BidVolume_1 = math.MaxFloat64
+	tick.AskVolume_1 = math.MaxFloat64
+	for _, leg := range s.Legs {
+		legTick := legs[leg.Symbol]
+		if tick.UpdatedAt == nil || legTick.UpdatedAt.AsTime().After(tick.UpdatedAt.AsTime()) {
+			tick.UpdatedAt = legTick.UpdatedAt
+		}
+		tick.LastPrice += leg.PriceMultiplier * legTick.LastPrice
+
+		trading := math.Abs(leg.TradingMultiplier)
+		if leg.PriceMultiplier > 0 {
+			tick.BidPrice_1 += leg.PriceMultiplier * legTick.BidPrice_1
+			tick.AskPrice_1 += leg.PriceMultiplier * legTick.AskPrice_1
+			tick.BidVolume_1 = Min(tick.BidVolume_1, legTick.BidVolume_1/trading)
+			tick.AskVolume_1 = Min(tick.AskVolume_1, legTick.AskVolume_1/trading)
+		} else {
+			tick.BidPrice_1 += leg.PriceMultiplier * legTick.AskPrice_1
+			tick.AskPrice_1 += leg.PriceMultiplier * legTick.BidPrice_1
+			tick.BidVolume_1 = Min(tick.BidVolume_1, legTick.AskVolume_1/trading)
+			tick.AskVolume_1 = Min(tick.AskVolume_1, legTick.BidVolume_1/trading)
+		}
+	}
+	return tick
+}
+
+// SplitTrade 把价差成交拆成各腿的成交
+// 各腿按参考价成交，第一条腿吸收差额，保证各腿成交价合成的价差等于价差成交价
+func (s *SpreadData) SplitTrade(trade *TradeData, prices map[string]float64) []*TradeData {
+	legPrices := make([]float64, len(s.Legs))
+	residual := trade.Price
+	for i, leg := range s.Legs {
+		legPrices[i] = prices[leg.Symbol]
+		if i > 0 {
+			residual -= leg.PriceMultiplier * legPrices[i]
+		}
+	}
+	legPrices[0] = residual / s.Legs[0].PriceMultiplier
+
+	trades := make([]*TradeData, 0, len(s.Legs))
+	for i, leg := range s.Legs {
+		direction := trade.Direction
+		if leg.TradingMultiplier < 0 {
+			direction = reverseDirection(direction)
+		}
+		trades = append(trades, &TradeData{
+			Symbol:    leg.Symbol,
+			Exchange:  expb.Exchange(leg.Exchange),
+			OrderNo:   trade.OrderNo,
+			TradeNo:   fmt.Sprintf("%s.%d", trade.TradeNo, i),
+			Direction: direction,
+			Offset:    trade.Offset,
+			Price:     legPrices[i],
+			Volume:    trade.Volume * math.Abs(leg.TradingMultiplier),
+			UpdatedAt: trade.UpdatedAt,
+			Reference: s.Name,
+		})
+	}
+	return trades
+}
+
+// MergeBars 按时间对齐各腿的K线，只保留所有腿都有数据的时刻
+func (s *SpreadData) MergeBars(legs map[string]*list.List) (spread *list.List, legBars map[int64]map[string]BarData) {
+	legBars = make(map[int64]map[string]BarData)
+	for _, leg := range s.Legs {
+		for cur := legs[leg.Symbol].Front(); cur != nil; cur = cur.Next() {
+			bar := cur.Value.(BarData)
+			key := bar.UpdatedAt.AsTime().UnixNano()
+			if _, ok := legBars[key]; !ok {
+				legBars[key] = make(map[string]BarData, len(s.Legs))
+			}
+			legBars[key][leg.Symbol] = bar
+		}
+	}
+
+	keys := make([]int64, 0, len(legBars))
+	for key, bars := range legBars {
+		if len(bars) != len(s.Legs) {
+			delete(legBars, key)
+			continue
+		}
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+
+	spread = list.New()
+	for _, key := range keys {
+		spread.PushBack(s.CalculateBar(legBars[key]))
+	}
+	return spread, legBars
+}
+
+// MergeTicks 按时间顺序回放各腿的tick，任意一腿更新且所有腿都已有行情时生成一个价差tick
+// 同一时刻多条腿更新时先全部合并，只生成一个价差tick
+func (s *SpreadData) MergeTicks(legs map[string]*list.List) (spread *list.List, legTicks map[int64]map[string]TickData) {
+	type legTick struct {
+		symbol string
+		tick   TickData
+	}
+	all := make([]legTick, 0)
+	for _, leg := range s.Legs {
+		for cur := legs[leg.Symbol].Front(); cur != nil; cur = cur.Next() {
+			all = append(all, legTick{leg.Symbol, cur.Value.(TickData)})
+		}
+	}
+	sort.SliceStable(all, func(i, j int) bool {
+		return all[i].tick.UpdatedAt.AsTime().Before(all[j].tick.UpdatedAt.AsTime())
+	})
+
+	spread = list.New()
+	legTicks = make(map[int64]map[string]TickData)
+	latest := make(map[string]TickData, len(s.Legs))
+	for i, t := range all {
+		latest[t.symbol] = t.tick
+		if i+1 < len(all) && all[i+1].tick.UpdatedAt.AsTime().Equal(t.tick.UpdatedAt.AsTime()) {
+			continue
+		}
+		if len(latest) != len(s.Legs) {
+			continue
+		}
+		snapshot := make(map[string]TickData, len(latest))
+		for symbol, tick := range latest {
+			snapshot[symbol] = tick
+		}
+		tick := s.CalculateTick(snapshot)
+		legTicks[tick.UpdatedAt.AsTime().UnixNano()] = snapshot
+		spread.PushBack(tick)
+	}
+	return spread, legTicks
+}
+
+func reverseDirection(direction expb.Direction) expb.Direction {
+	if direction == expb.Direction_LONG {
+		return expb.Direction_SHORT
+	}
+	return expb.Direction_LONG
+}
@@ -0,0 +1,200 @@
+package internal
+
+import (
+	"container/list"
+	"math"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+	expb "newgitlab.com/xquant/exchange-protocols/protocols/src/go"
+)
+
+var testSpread = &SpreadData{
+	Name: "BTC-ETH",
+	Legs: []SpreadLeg{
+		{Symbol: "BTCUSDT", PriceMultiplier: 1, TradingMultiplier: 1},
+		{Symbol: "ETHUSDT", PriceMultiplier: -10, TradingMultiplier: -10},
+	},
+}
+
+func TestSpreadCalculateBar(t *testing.T) {
+	now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	bar := testSpread.CalculateBar(map[string]BarData{
+		"BTCUSDT": newTestBar("BTCUSDT", now, 100, 110, 90, 105),
+		"ETHUSDT": newTestBar("ETHUSDT", now, 5, 6, 4, 5.5),
+	})
+
+	if bar.OpenPrice != 50 || bar.ClosePrice != 50 {
+		t.Fatalf("open/close: %v %v", bar.OpenPrice, bar.ClosePrice)
+	}
+	if bar.HighPrice != 70 || bar.LowPrice != 30 {
+		t.Fatalf("high/low: %v %v", bar.HighPrice, bar.LowPrice)
+	}
+	if bar.Volume != 10 {
+		t.Fatalf("volume: %v", bar.Volume)
+	}
+}
+
+func TestSpreadCalculateTick(t *testing.T) {
+	now := timestamppb.New(time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC))
+	tick := testSpread.CalculateTick(map[string]TickData{
+		"BTCUSDT": {UpdatedAt: now, LastPrice: 100, BidPrice_1: 99, AskPrice_1: 101, BidVolume_1: 2, AskVolume_1: 3},
+		"ETHUSDT": {UpdatedAt: now, LastPrice: 5, BidPrice_1: 4.9, AskPrice_1: 5.1, BidVolume_1: 40, AskVolume_1: 10},
+	})
+
+	if tick.BidPrice_1 != 99-51 || tick.AskPrice_1 != 101-49 {
+		t.Fatalf("bid/ask: %v %v", tick.BidPrice_1, tick.AskPrice_1)
+	}
+	if tick.BidVolume_1 != 1 || tick.AskVolume_1 != 3 {
+		t.Fatalf("bid/ask volume: %v %v", tick.BidVolume_1, tick.AskVolume_1)
+	}
+}
+
+func TestSpreadSplitTrade(t *testing.T) {
+	trade := &TradeData{TradeNo: "1", Direction: expb.Direction_LONG, Price: 52, Volume: 2}
+	legs := testSpread.SplitTrade(trade, map[string]float64{"BTCUSDT": 105, "ETHUSDT": 5.5})
+
+	if len(legs) != 2 {
+		t.Fatalf("legs: %d", len(legs))
+	}
+	if legs[0].Direction != expb.Direction_LONG || legs[0].Volume != 2 || legs[0].Price != 107 {
+		t.Fatalf("btc leg: %+v", legs[0])
+	}
+	if legs[1].Direction != expb.Direction_SHORT || legs[1].Volume != 20 || legs[1].Price != 5.5 {
+		t.Fatalf("eth leg: %+v", legs[1])
+	}
+	if price := legs[0].Price - 10*legs[1].Price; math.Abs(price-trade.Price) > 1e-9 {
+		t.Fatalf("spread price: %v", price)
+	}
+}
+
+func TestSpreadMergeTicks(t *testing.T) {
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	legs := map[string]*list.List{"BTCUSDT": list.New(), "ETHUSDT": list.New()}
+	legs["BTCUSDT"].PushBack(newTestTick("BTCUSDT", start, 100, 1))
+	legs["BTCUSDT"].PushBack(newTestTick("BTCUSDT", start.Add(time.Second), 110, 1))
+	legs["ETHUSDT"].PushBack(newTestTick("ETHUSDT", start, 5, 1))
+	legs["ETHUSDT"].PushBack(newTestTick("ETHUSDT", start.Add(time.Second), 6, 1))
+
+	// 同一时刻两条腿都更新，只生成一个用两条腿新价格合成的价差tick
+	spread, legTicks := testSpread.MergeTicks(legs)
+	if spread.Len() != 2 {
+		t.Fatalf("spread ticks: %d", spread.Len())
+	}
+	if tick := spread.Back().Value.(TickData); tick.LastPrice != 50 {
+		t.Fatalf("spread tick: %+v", tick)
+	}
+	snapshot := legTicks[start.Add(time.Second).UnixNano()]
+	if snapshot["BTCUSDT"].LastPrice != 110 || snapshot["ETHUSDT"].LastPrice != 6 {
+		t.Fatalf("snapshot: %+v", snapshot)
+	}
+}
+
+type spreadTestStrategy struct {
+	StrategyTemplate
+	bars int
+}
+
+func (s *spreadTestStrategy) OnBar(bar BarData) {
+	s.bars++
+	if s.bars == 1 {
+		s.Buy(bar.ClosePrice, 1)
+	}
+}
+
+func TestSpreadBacktest(t *testing.T) {
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	repo := &memoryRepo{bars: map[string][]BarData{
+		"BTCUSDT": {
+			newTestBar("BTCUSDT", start, 100, 100, 100, 100),
+			newTestBar("BTCUSDT", start.Add(day), 100, 110, 95, 110),
+			newTestBar("BTCUSDT", start.Add(2*day), 110, 120, 105, 120),
+			newTestBar("BTCUSDT", start.Add(3*day), 120, 120, 120, 120),
+		},
+		"ETHUSDT": {
+			newTestBar("ETHUSDT", start, 5, 5, 5, 5),
+			newTestBar("ETHUSDT", start.Add(day), 5, 5.2, 4.8, 5),
+			newTestBar("ETHUSDT", start.Add(2*day), 5, 5.5, 5, 5.5),
+			newTestBar("ETHUSDT", start.Add(3*day), 5.5, 5.5, 5.5, 5.5),
+		},
+	}}
+
+	run := func(spread *SpreadData) *BackTestingEngine {
+		engine, err := newEngine(EngineCfg{
+			Strategy: new(spreadTestStrategy),
+			DataRepo: repo,
+			Symbol:   spread.Name,
+			Start:    start,
+			End:      start.Add(4 * day),
+			Interval: day,
+			Size:     1,
+			Spread:   spread,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = engine.loadData(); err != nil {
+			t.Fatal(err)
+		}
+		engine.runBackTesting()
+		engine.calculateResult()
+		return engine
+	}
+
+	engine := run(testSpread)
+	if len(engine.trades) != 1 || len(engine.legTrades) != 2 {
+		t.Fatalf("trades: %d, leg trades: %d", len(engine.trades), len(engine.legTrades))
+	}
+
+	// 第一天按价差收盘价50挂买单，第二天开盘价50成交，收盘价60
+	result := engine.dailyResults["2022-01-02"]
+	if result.TradeCount != 2 || result.EndPos != 1 {
+		t.Fatalf("result: %+v", result)
+	}
+	if math.Abs(result.TotalPnl-10) > 1e-9 {
+		t.Fatalf("total pnl: %v", result.TotalPnl)
+	}
+	// 第三天 BTC 腿持仓盈利10，ETH 腿持仓亏损5
+	if result = engine.dailyResults["2022-01-03"]; math.Abs(result.TotalPnl-5) > 1e-9 {
+		t.Fatalf("total pnl: %v", result.TotalPnl)
+	}
+
+	// BTC 腿的合约乘数为2时，只有 BTC 腿的盈亏翻倍
+	sized := &SpreadData{Name: testSpread.Name, Legs: append([]SpreadLeg(nil), testSpread.Legs...)}
+	sized.Legs[0].Size = 2
+	if result = run(sized).dailyResults["2022-01-03"]; math.Abs(result.TotalPnl-15) > 1e-9 {
+		t.Fatalf("sized total pnl: %v", result.TotalPnl)
+	}
+}
+
+// 腿在成交当天没有行情时，逐日结果按成交价补上，不会因为缺少当天的结果而崩溃
+func TestSpreadLegTradeWithoutClose(t *testing.T) {
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	engine, err := newEngine(EngineCfg{
+		Strategy: new(spreadTestStrategy),
+		DataRepo: &memoryRepo{},
+		Symbol:   testSpread.Name,
+		Start:    start,
+		End:      start.Add(24 * time.Hour),
+		Interval: time.Hour,
+		Size:     1,
+		Spread:   testSpread,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine.dailyResults["2022-01-01"] = NewDailyResult("2022-01-01", 50)
+	trade := &TradeData{TradeNo: "1", Direction: expb.Direction_LONG, Price: 50, Volume: 1, UpdatedAt: timestamppb.New(start)}
+	engine.trades[trade.TradeNo] = trade
+	engine.legTrades = testSpread.SplitTrade(trade, map[string]float64{"BTCUSDT": 100, "ETHUSDT": 5})
+
+	engine.calculateSpreadPnl()
+	if result := engine.dailyResults["2022-01-01"]; result.TradeCount != 2 || result.EndPos != 1 {
+		t.Fatalf("result: %+v", result)
+	}
+	if leg := engine.legResults["ETHUSDT"]["2022-01-01"]; leg == nil || leg.ClosePrice != 5 {
+		t.Fatalf("leg result: %+v", leg)
+	}
+}
@@ -2,9 +2,75 @@ package internal
 
 import (
 	"log"
+	"time"
+
+	expb "newgitlab.com/xquant/exchange-protocols/protocols/src/go"
 )
 
-type StrategyTemplate struct{}
+type StrategyTemplate struct {
+	engine CtaEngine
+}
+
+func (s *StrategyTemplate) SetEngine(engine CtaEngine) {
+	s.engine = engine
+}
+
+func (s StrategyTemplate) Buy(price, volume float64) string {
+	return s.engine.SendOrder(OrderRequest{Direction: expb.Direction_LONG, Price: price, Volume: volume})
+}
+
+func (s StrategyTemplate) Sell(price, volume float64) string {
+	return s.engine.SendOrder(OrderRequest{Direction: expb.Direction_SHORT, Price: price, Volume: volume})
+}
+
+func (s StrategyTemplate) BuyMarket(volume float64) string {
+	return s.engine.SendOrder(OrderRequest{Direction: expb.Direction_LONG, Volume: volume, Type: MARKET})
+}
+
+func (s StrategyTemplate) SellMarket(volume float64) string {
+	return s.engine.SendOrder(OrderRequest{Direction: expb.Direction_SHORT, Volume: volume, Type: MARKET})
+}
+
+// SendOrder 发送指定类型的委托，如 IOC、post-only、只减仓
+func (s StrategyTemplate) SendOrder(req OrderRequest) string {
+	return s.engine.SendOrder(req)
+}
+
+func (s StrategyTemplate) CancelOrder(orderNo string) {
+	s.engine.CancelOrder(orderNo)
+}
+
+func (s StrategyTemplate) SendAlgo(req AlgoRequest) string {
+	return s.engine.SendAlgo(req)
+}
+
+func (s StrategyTemplate) CancelAlgo(algoID string) {
+	s.engine.CancelAlgo(algoID)
+}
+
+func (s StrategyTemplate) SendBracket(req BracketRequest) string {
+	return s.engine.SendBracket(req)
+}
+
+func (s StrategyTemplate) CancelBracket(bracketID string) {
+	s.engine.CancelBracket(bracketID)
+}
+
+func (s StrategyTemplate) AddTimer(name string, schedule Schedule) {
+	s.engine.AddTimer(name, schedule)
+}
+
+func (s StrategyTemplate) RemoveTimer(name string) {
+	s.engine.RemoveTimer(name)
+}
+
+func (s StrategyTemplate) LoadBar(days int) {
+	s.engine.LoadBar(days)
+}
+
+func (s StrategyTemplate) LoadTick(days int) {
+	s.engine.LoadTick(days)
+}
 
 func (s StrategyTemplate) OnInit() {
 	log.Println("Strategy: OnInit")
@@ -26,8 +92,12 @@ func (s StrategyTemplate) OnStop() {
 	log.Println("Strategy: OnStop")
 }
 
+func (s StrategyTemplate) OnTimer(name string, at time.Time) {
+	log.Printf("Strategy: OnTimer: %s %v\n", name, at)
+}
+
 func (s StrategyTemplate) OnPosition(posChange float64) {
-	log.Printf("Strategy: OnPosition: changed: %d\n", posChange)
+	log.Printf("Strategy: OnPosition: changed: %v\n", posChange)
 }
 
 func (s StrategyTemplate) OnOrder(order OrderData) {
@@ -37,3 +107,11 @@ func (s StrategyTemplate) OnOrder(order OrderData) {
 func (s StrategyTemplate) OnTrade(trade TradeData) {
 	log.Printf("Strategy: OnTrade: %+v\n", trade)
 }
+
+func (s StrategyTemplate) OnAlgo(algo AlgoData) {
+	log.Printf("Strategy: OnAlgo: %+v\n", algo)
+}
+
+func (s StrategyTemplate) OnBracket(bracket BracketData) {
+	log.Printf("Strategy: OnBracket: %+v\n", bracket)
+}
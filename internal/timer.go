@@ -0,0 +1,135 @@
+package internal
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Schedule 定时任务的触发规则
+type Schedule interface {
+	// Next 返回 t 之后（不含 t）的下一次触发时间
+	Next(t time.Time) time.Time
+}
+
+type everySchedule time.Duration
+
+// Every 每隔 interval 触发一次，触发时间对齐到 interval 的整数倍，如每小时整点
+func Every(interval time.Duration) Schedule {
+	if interval <= 0 {
+		panic("定时间隔必须大于0")
+	}
+	return everySchedule(interval)
+}
+
+func (s everySchedule) Next(t time.Time) time.Time {
+	interval := time.Duration(s)
+	return t.Truncate(interval).Add(interval)
+}
+
+type dailySchedule struct {
+	offset time.Duration
+	loc    *time.Location
+}
+
+// DailyAt 每天在 loc 时区的 hour:minute 触发，loc 为空时使用 UTC
+func DailyAt(hour, minute int, loc *time.Location) Schedule {
+	if loc == nil {
+		loc = time.UTC
+	}
+	return dailySchedule{offset: time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute, loc: loc}
+}
+
+func (s dailySchedule) Next(t time.Time) time.Time {
+	t = t.In(s.loc)
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, s.loc)
+	next := day.Add(s.offset)
+	if !next.After(t) {
+		next = day.AddDate(0, 0, 1).Add(s.offset)
+	}
+	return next
+}
+
+type timer struct {
+	name     string
+	schedule Schedule
+	next     time.Time
+}
+
+type firedTimer struct {
+	name string
+	at   time.Time
+}
+
+// scheduler 按传入的时间触发定时任务，回测时传入行情时间，实盘时传入 EventTimer 的时间
+// 两次传入的时间跨过多个触发点时只触发一次，触发时间取最近的一个
+type scheduler struct {
+	mu     sync.Mutex
+	timers []*timer
+	now    time.Time
+}
+
+func newScheduler() *scheduler {
+	return &scheduler{}
+}
+
+// add 同名的定时任务会被替换
+func (s *scheduler) add(name string, schedule Schedule) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.removeLocked(name)
+	t := &timer{name: name, schedule: schedule}
+	if !s.now.IsZero() {
+		t.next = schedule.Next(s.now)
+	}
+	s.timers = append(s.timers, t)
+}
+
+func (s *scheduler) remove(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.removeLocked(name)
+}
+
+func (s *scheduler) removeLocked(name string) {
+	for i, t := range s.timers {
+		if t.name == name {
+			s.timers = append(s.timers[:i], s.timers[i+1:]...)
+			return
+		}
+	}
+}
+
+// update 返回到 now 为止需要触发的定时任务，按触发时间和名称排序
+// 回调在锁外执行，策略可以在 OnTimer 中增删定时任务
+func (s *scheduler) update(now time.Time) []firedTimer {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.now = now
+	var fired []firedTimer
+	for _, t := range s.timers {
+		if t.next.IsZero() {
+			t.next = t.schedule.Next(now)
+			continue
+		}
+		if t.next.After(now) {
+			continue
+		}
+		at := t.next
+		for next := t.schedule.Next(at); !next.After(now); next = t.schedule.Next(at) {
+			at = next
+		}
+		t.next = t.schedule.Next(at)
+		fired = append(fired, firedTimer{t.name, at})
+	}
+
+	sort.Slice(fired, func(i, j int) bool {
+		if !fired[i].at.Equal(fired[j].at) {
+			return fired[i].at.Before(fired[j].at)
+		}
+		return fired[i].name < fired[j].name
+	})
+	return fired
+}
@@ -0,0 +1,131 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSchedule(t *testing.T) {
+	now := time.Date(2022, 1, 1, 9, 30, 0, 0, time.UTC)
+
+	if next := Every(time.Hour).Next(now); !next.Equal(time.Date(2022, 1, 1, 10, 0, 0, 0, time.UTC)) {
+		t.Fatalf("every: %v", next)
+	}
+	if next := DailyAt(8, 0, nil).Next(now); !next.Equal(time.Date(2022, 1, 2, 8, 0, 0, 0, time.UTC)) {
+		t.Fatalf("daily: %v", next)
+	}
+	if next := DailyAt(16, 0, nil).Next(now); !next.Equal(time.Date(2022, 1, 1, 16, 0, 0, 0, time.UTC)) {
+		t.Fatalf("daily: %v", next)
+	}
+}
+
+func TestScheduler(t *testing.T) {
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := newScheduler()
+	s.add("hourly", Every(time.Hour))
+	s.add("funding", DailyAt(8, 0, nil))
+
+	if fired := s.update(start); len(fired) != 0 {
+		t.Fatalf("fired: %v", fired)
+	}
+	// 跨过多个整点只触发一次，时间取最近的整点
+	fired := s.update(start.Add(8*time.Hour + 30*time.Minute))
+	if len(fired) != 2 || fired[0].name != "funding" || fired[1].name != "hourly" || !fired[1].at.Equal(start.Add(8*time.Hour)) {
+		t.Fatalf("fired: %v", fired)
+	}
+
+	s.remove("hourly")
+	if fired = s.update(start.Add(10 * time.Hour)); len(fired) != 0 {
+		t.Fatalf("fired: %v", fired)
+	}
+}
+
+type timerTestStrategy struct {
+	StrategyTemplate
+	fired []time.Time
+}
+
+func (s *timerTestStrategy) OnInit() {
+	s.AddTimer("every2h", Every(2*time.Hour))
+}
+
+func (s *timerTestStrategy) OnTimer(name string, at time.Time) {
+	s.fired = append(s.fired, at)
+}
+
+func TestBacktestTimer(t *testing.T) {
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	bars := make([]BarData, 0, 6)
+	for i := 0; i < 6; i++ {
+		bars = append(bars, newTestBar("BTCUSDT", start.Add(time.Duration(i)*time.Hour), 100, 100, 100, 100))
+	}
+
+	// 定时任务经事件引擎触发，调用方注册的处理函数也能收到 EventTimer
+	events := NewEventEngine(0)
+	var timers []time.Time
+	events.Register(EventTimer, func(event Event) {
+		timers = append(timers, event.Data.(time.Time))
+	})
+	strategy := new(timerTestStrategy)
+	cfg := EngineCfg{
+		Strategy:    strategy,
+		DataRepo:    &memoryRepo{bars: map[string][]BarData{"BTCUSDT": bars}},
+		Symbol:      "BTCUSDT",
+		Start:       start,
+		End:         start.Add(6 * time.Hour),
+		Interval:    time.Hour,
+		Size:        1,
+		EventEngine: events,
+	}
+	if _, err := Evaluate(cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	// 按行情时间每两小时触发一次
+	if len(strategy.fired) != 2 || !strategy.fired[0].Equal(start.Add(2*time.Hour)) || !strategy.fired[1].Equal(start.Add(4*time.Hour)) {
+		t.Fatalf("fired: %v", strategy.fired)
+	}
+	if len(timers) != 5 || !timers[4].Equal(start.Add(4*time.Hour)) {
+		t.Fatalf("timers: %v", timers)
+	}
+
+	// 用过的和已启动的事件引擎不能再用于回测
+	cfg.Strategy = new(timerTestStrategy)
+	if _, err := Evaluate(cfg); err == nil || !strings.Contains(err.Error(), "注册过策略") {
+		t.Fatalf("reuse: %v", err)
+	}
+	cfg.EventEngine = NewEventEngine(time.Hour)
+	cfg.EventEngine.Start()
+	defer cfg.EventEngine.Stop()
+	if _, err := Evaluate(cfg); err == nil || !strings.Contains(err.Error(), "已启动") {
+		t.Fatalf("started: %v", err)
+	}
+}
+
+func TestLiveTimer(t *testing.T) {
+	strategy := new(timerTestStrategy)
+	engine, err := NewLiveEngine(LiveEngineCfg{
+		Strategy: strategy,
+		Gateway:  new(fakeMarketGateway),
+		Symbol:   "BTCUSDT",
+		// 计时器由测试发出，避免系统时间的 EventTimer 干扰
+		EventEngine: NewEventEngine(time.Hour),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = engine.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, offset := range []time.Duration{30 * time.Minute, 70 * time.Minute, 150 * time.Minute} {
+		engine.events.Put(Event{Type: EventTimer, Data: start.Add(offset)})
+	}
+	engine.Stop()
+
+	if len(strategy.fired) != 1 || !strategy.fired[0].Equal(start.Add(2*time.Hour)) {
+		t.Fatalf("fired: %v", strategy.fired)
+	}
+}
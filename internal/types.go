@@ -23,18 +23,60 @@ func PbToInterval(i expb.Interval) Interval {
 	}
 }
 
+// Strategy 回测指纹只计入策略的导出字段，影响交易的参数要放在导出字段中，否则参数不同的回测指纹相同
 type Strategy interface {
 	//GetCfg() StrategyConfig
 
+	SetEngine(engine CtaEngine)
+
 	OnInit()
 	OnStart()
 	OnTick(tick TickData)
 	OnBar(bar BarData)
 	OnStop()
+	// OnTimer 由 CtaEngine.AddTimer 添加的定时任务触发，at 为计划的触发时间
+	OnTimer(name string, at time.Time)
 
 	OnPosition(posChange float64)
 	OnOrder(order OrderData)
 	OnTrade(trade TradeData)
+	// OnAlgo 算法委托的进度，子委托同样会推送 OnOrder 和 OnTrade
+	OnAlgo(algo AlgoData)
+	// OnBracket 止盈止损委托组的进度
+	OnBracket(bracket BracketData)
+}
+
+// OrderRequest 回测时 Symbol 和 Exchange 由引擎填写
+type OrderRequest struct {
+	Symbol    string
+	Exchange  Exchange
+	Direction expb.Direction
+	Offset    expb.Offset
+	Price     float64
+	Volume    float64
+
+	// 零值为 GTC 限价单
+	Type        OrderType
+	TimeInForce TimeInForce
+	ReduceOnly  bool
+}
+
+// CtaEngine 策略下单使用的引擎接口
+type CtaEngine interface {
+	SendOrder(req OrderRequest) string
+	CancelOrder(orderNo string)
+	// 回测按行情时间触发定时任务，实盘按系统时间触发
+	AddTimer(name string, schedule Schedule)
+	RemoveTimer(name string)
+	// 在 OnInit 中调用，把开始前 days 天的历史数据推给策略用于预热，预热期间不能下单
+	LoadBar(days int)
+	LoadTick(days int)
+	// 算法委托由引擎拆成子委托发出，返回算法编号
+	SendAlgo(req AlgoRequest) string
+	CancelAlgo(algoID string)
+	// 止盈止损委托组由引擎管理，返回委托组编号
+	SendBracket(req BracketRequest) string
+	CancelBracket(bracketID string)
 }
 
 type StrategyConfig struct {
@@ -46,7 +88,7 @@ type DailyResult struct {
 	Date       string
 	ClosePrice float64
 	PreClose   float64
-	Trades     []*TradeData
+	Trades     []*TradeData `dataframe:"-"`
 	TradeCount int
 	StartPos   float64
 	EndPos     float64
@@ -94,18 +136,15 @@ func (d *DailyResult) CalculatePnl(preClose, startPos, rate, Slippage, size floa
 		}
 		d.EndPos += posChange
 
-		var turnover float64
 		if inverse {
-			turnover = trade.Volume * size / trade.Price
 			d.TradingPnl += posChange * (1/trade.Price - 1/d.ClosePrice) * size
-			d.Slippage += trade.Volume * size * Slippage / (trade.Price * 2) // todo: **2
 		} else {
-			turnover = trade.Volume * size * trade.Price
 			d.TradingPnl += posChange * (d.ClosePrice - trade.Price) * size
-			d.Slippage += trade.Volume * size * Slippage
 		}
+		turnover, commission, slippage := tradeCost(trade.Price, trade.Volume, size, rate, Slippage, inverse)
 		d.Turnover += turnover
-		d.Commission += turnover * rate
+		d.Commission += commission
+		d.Slippage += slippage
 	}
 	d.TotalPnl = d.TradingPnl + d.HoldingPnl
 	d.NetPnl = d.TotalPnl - d.Commission - d.Slippage
@@ -0,0 +1,57 @@
+package internal
+
+import (
+	"container/list"
+	"errors"
+	"time"
+)
+
+var errWarmupOrder = errors.New("预热期间不能下单")
+
+// warmupRange 预热数据的时间范围，取 before 之前的 days 天
+func warmupRange(before time.Time, days int) (start, end time.Time, err error) {
+	if days <= 0 {
+		return start, end, errors.New("预热天数必须大于0")
+	}
+	return before.AddDate(0, 0, -days), before, nil
+}
+
+// replayHistory 把 before 之前的历史数据直接推给策略，不经过事件引擎，返回推送的数量
+// advance 不为空时在每条数据推送前用数据时间调用，回测用它推进引擎时间
+func replayHistory(strategy Strategy, history *list.List, before time.Time, advance func(time.Time)) int {
+	count := 0
+	var book OrderBook
+	for cur := history.Front(); cur != nil; cur = cur.Next() {
+		switch data := cur.Value.(type) {
+		case BarData:
+			if !data.UpdatedAt.AsTime().Before(before) {
+				continue
+			}
+			if advance != nil {
+				advance(data.UpdatedAt.AsTime())
+			}
+			strategy.OnBar(data)
+		case TickData:
+			if !data.UpdatedAt.AsTime().Before(before) {
+				continue
+			}
+			if advance != nil {
+				advance(data.UpdatedAt.AsTime())
+			}
+			strategy.OnTick(data)
+		case DepthData:
+			if !data.UpdatedAt.Before(before) {
+				continue
+			}
+			if advance != nil {
+				advance(data.UpdatedAt)
+			}
+			book.Apply(data)
+			strategy.OnTick(book.Tick(data.Symbol, data.UpdatedAt, data.LastPrice, data.LastVolume))
+		default:
+			continue
+		}
+		count++
+	}
+	return count
+}
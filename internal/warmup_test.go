@@ -0,0 +1,172 @@
+package internal
+
+import (
+	"testing"
+	"time"
+)
+
+type warmupTestStrategy struct {
+	StrategyTemplate
+	days int
+
+	initialized bool
+	warmup      []float64
+	bars        []float64
+	orders      []string
+}
+
+func (s *warmupTestStrategy) OnInit() {
+	s.LoadBar(s.days)
+	s.initialized = true
+}
+
+func (s *warmupTestStrategy) OnBar(bar BarData) {
+	if !s.initialized {
+		s.warmup = append(s.warmup, bar.ClosePrice)
+		s.orders = append(s.orders, s.Buy(bar.ClosePrice*1.2, 1))
+		return
+	}
+	s.bars = append(s.bars, bar.ClosePrice)
+}
+
+func TestBacktestWarmup(t *testing.T) {
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	bars := make([]BarData, 0)
+	for i := -5; i < 3; i++ {
+		price := float64(100 + i)
+		bars = append(bars, newTestBar("BTCUSDT", start.Add(time.Duration(i)*day), price, price, price, price))
+	}
+
+	strategy := &warmupTestStrategy{days: 3}
+	result, err := Evaluate(EngineCfg{
+		Strategy:   strategy,
+		DataRepo:   &memoryRepo{bars: map[string][]BarData{"BTCUSDT": bars}},
+		Symbol:     "BTCUSDT",
+		Start:      start,
+		End:        start.Add(3 * day),
+		Interval:   day,
+		Capital:    1000,
+		Size:       1,
+		AnnualDays: 365,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 只回放开始前3天，不包含开始时间的K线
+	if len(strategy.warmup) != 3 || strategy.warmup[0] != 97 || strategy.warmup[2] != 99 {
+		t.Fatalf("warmup: %v", strategy.warmup)
+	}
+	if len(strategy.bars) == 0 || strategy.bars[0] != 100 {
+		t.Fatalf("bars: %v", strategy.bars)
+	}
+	for _, orderNo := range strategy.orders {
+		if orderNo != "" {
+			t.Fatalf("orders: %v", strategy.orders)
+		}
+	}
+	if len(result.Orders) != 0 || len(result.Trades) != 0 {
+		t.Fatalf("orders: %d trades: %d", len(result.Orders), len(result.Trades))
+	}
+	// 逐日结果从回测开始日期算起
+	if len(result.DailyResults) == 0 || result.DailyResults[0].Date != "2022-01-01" {
+		t.Fatalf("daily results: %+v", result.DailyResults)
+	}
+}
+
+type warmupTimerStrategy struct {
+	StrategyTemplate
+	initialized bool
+	warmup      []time.Time
+	fired       []time.Time
+	restored    time.Time
+}
+
+func (s *warmupTimerStrategy) OnInit() {
+	s.AddTimer("daily", Every(24*time.Hour))
+	s.LoadBar(3)
+	s.restored = s.engine.(*BackTestingEngine).datetime
+	s.initialized = true
+}
+
+func (s *warmupTimerStrategy) OnBar(bar BarData) {
+	if !s.initialized {
+		s.warmup = append(s.warmup, s.engine.(*BackTestingEngine).datetime)
+	}
+}
+
+func (s *warmupTimerStrategy) OnTimer(name string, at time.Time) {
+	s.fired = append(s.fired, at)
+}
+
+// 预热时引擎时间跟随回放的K线，定时任务按预热数据的时间触发，结束后恢复
+func TestBacktestWarmupDatetime(t *testing.T) {
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	bars := make([]BarData, 0)
+	for i := -3; i < 3; i++ {
+		bars = append(bars, newTestBar("BTCUSDT", start.Add(time.Duration(i)*day), 100, 100, 100, 100))
+	}
+
+	strategy := new(warmupTimerStrategy)
+	_, err := Evaluate(EngineCfg{
+		Strategy:   strategy,
+		DataRepo:   &memoryRepo{bars: map[string][]BarData{"BTCUSDT": bars}},
+		Symbol:     "BTCUSDT",
+		Start:      start,
+		End:        start.Add(3 * day),
+		Interval:   day,
+		Capital:    1000,
+		Size:       1,
+		AnnualDays: 365,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(strategy.warmup) != 3 {
+		t.Fatalf("warmup: %v", strategy.warmup)
+	}
+	for i, datetime := range strategy.warmup {
+		if !datetime.Equal(start.Add(time.Duration(i-3) * day)) {
+			t.Fatalf("warmup datetime: %v", strategy.warmup)
+		}
+	}
+	if !strategy.restored.IsZero() {
+		t.Fatalf("restored: %v", strategy.restored)
+	}
+	if len(strategy.fired) < 2 || !strategy.fired[0].Equal(start.Add(-2*day)) || !strategy.fired[1].Equal(start.Add(-day)) {
+		t.Fatalf("fired: %v", strategy.fired)
+	}
+}
+
+func TestLiveWarmup(t *testing.T) {
+	now := time.Now()
+	bars := []BarData{
+		newTestBar("BTCUSDT", now.Add(-72*time.Hour), 1, 1, 1, 1),
+		newTestBar("BTCUSDT", now.Add(-36*time.Hour), 2, 2, 2, 2),
+		newTestBar("BTCUSDT", now.Add(-time.Hour), 3, 3, 3, 3),
+	}
+
+	strategy := &warmupTestStrategy{days: 2}
+	engine, err := NewLiveEngine(LiveEngineCfg{
+		Strategy: strategy,
+		Gateway:  new(fakeMarketGateway),
+		Symbol:   "BTCUSDT",
+		Interval: time.Hour,
+		DataRepo: &memoryRepo{bars: map[string][]BarData{"BTCUSDT": bars}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = engine.Start(); err != nil {
+		t.Fatal(err)
+	}
+	engine.Stop()
+
+	// 预热期间的委托不会发到交易接口，fakeMarketGateway 收到委托会 panic
+	if len(strategy.warmup) != 2 || strategy.warmup[0] != 2 || strategy.warmup[1] != 3 {
+		t.Fatalf("warmup: %v", strategy.warmup)
+	}
+}
@@ -1,32 +1,53 @@
 package main
 
-import "fmt"
+import (
+	"fmt"
+	"os"
+)
+
+const usage = `usage:
+  gocta backtest [flags]        运行回测，输出统计指标
+  gocta optimize [flags]        参数优化
+  gocta montecarlo [flags]      回测后对逐日收益或逐笔交易做蒙特卡洛模拟
+  gocta strategies              列出可用策略和默认参数
+  gocta runs list|show|compare|delete [flags] [id...]
+                                查询、对比和删除保存的回测记录
+  gocta data import [flags]     从 csv 目录导入行情到数据库
+  gocta data export [flags]     从数据库导出行情到 csv 目录
+
+使用 gocta <command> -h 查看参数
+`
 
 func main() {
-	//err := internal.Evaluate(internal.EngineCfg{
-	//	Strategy:       internal.StrategyTemplate{},
-	//	DataRepo:       internal.NewData(),
-	//	Symbol:         "BTCUSDT",
-	//	Start:          time.Date(2022, 1, 1, 0, 0, 0, 0, time.Local),
-	//	BackTestingMod: internal.BAR,
-	//})
-	//if err != nil {
-	//	panic(err)
-	//}
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
 
-	m := map[string]int{}
-	m["1"] = 1
-	m["2"] = 2
+	var err error
+	switch os.Args[1] {
+	case "backtest":
+		err = runBacktest(os.Args[2:])
+	case "optimize":
+		err = runOptimize(os.Args[2:])
+	case "montecarlo":
+		err = runMonteCarlo(os.Args[2:])
+	case "data":
+		err = runData(os.Args[2:])
+	case "strategies":
+		runStrategies()
+	case "runs":
+		err = runRuns(os.Args[2:])
+	case "-h", "-help", "--help", "help":
+		fmt.Print(usage)
+		return
+	default:
+		fmt.Fprintf(os.Stderr, "未知命令: %s\n\n%s", os.Args[1], usage)
+		os.Exit(2)
+	}
 
-	var list []int
-	for _, v := range m {
-		if v == 1 {
-			v = 10
-		} else if v == 2 {
-			v = 12
-		}
-		list = append(list, v)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "错误:", err)
+		os.Exit(1)
 	}
-	fmt.Println(m)
-	fmt.Println(list)
 }
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+
+	"gocta/internal"
+)
+
+func runMonteCarlo(args []string) error {
+	var (
+		f       engineFlags
+		params  string
+		method  string
+		setting = internal.DefaultMonteCarloSetting()
+	)
+	fs := flag.NewFlagSet("montecarlo", flag.ExitOnError)
+	f.register(fs)
+	fs.StringVar(&params, "params", "", "策略参数，如 window=20,dev=2")
+	fs.StringVar(&method, "method", string(setting.Method), "抽样方法: bootstrap、block 或 shuffle")
+	fs.IntVar(&setting.Simulations, "n", setting.Simulations, "模拟次数")
+	fs.IntVar(&setting.BlockSize, "block", setting.BlockSize, "block 方法的块长度，单位为天")
+	fs.Int64Var(&setting.Seed, "seed", 0, "随机种子，为 0 时使用当前时间")
+	fs.Float64Var(&setting.RuinLevel, "ruin", setting.RuinLevel, "资金跌破起始资金的该比例视为破产")
+	fs.IntVar(&setting.Workers, "workers", 0, "并行数，为 0 时使用 CPU 数")
+	fs.Parse(args)
+
+	cfg, err := f.config()
+	if err != nil {
+		return err
+	}
+	factory, err := f.factory()
+	if err != nil {
+		return err
+	}
+	strategyParams, err := parseParams(params)
+	if err != nil {
+		return err
+	}
+	if cfg.Strategy, err = factory(strategyParams); err != nil {
+		return err
+	}
+
+	result, err := internal.Evaluate(cfg)
+	if err != nil {
+		return err
+	}
+	setting.Method = internal.MonteCarloMethod(method)
+	setting.AnnualDays = cfg.AnnualDays
+	mc, err := internal.MonteCarlo(result, setting)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("方法: %s  次数: %d  种子: %d  破产概率: %.2f%%\n", mc.Method, mc.Simulations, mc.Seed, mc.RiskOfRuin)
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "指标\t均值\t标准差\t最小\tP5\tP25\tP50\tP75\tP95\t最大")
+	for _, row := range []struct {
+		name string
+		d    internal.Distribution
+	}{
+		{"final_balance", mc.FinalBalance},
+		{"max_ddpercent", mc.MaxDdpercent},
+		{"sharpe_ratio", mc.SharpeRatio},
+	} {
+		d := row.d
+		fmt.Fprintf(w, "%s\t%.2f\t%.2f\t%.2f\t%.2f\t%.2f\t%.2f\t%.2f\t%.2f\t%.2f\n",
+			row.name, d.Mean, d.Std, d.Min, d.P5, d.P25, d.P50, d.P75, d.P95, d.Max)
+	}
+	w.Flush()
+
+	if f.out == "" {
+		return nil
+	}
+	return writeJSON(filepath.Join(f.out, "montecarlo.json"), map[string]any{
+		"strategy":   f.strategy,
+		"params":     strategyParams,
+		"montecarlo": mc,
+	})
+}
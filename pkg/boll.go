@@ -6,6 +6,18 @@ type BollStrategy struct {
 	internal.StrategyTemplate
 }
 
+func init() {
+	internal.RegisterStrategy(internal.StrategyInfo{
+		Name:        "boll",
+		Description: "布林带策略，交易逻辑尚未实现",
+		Factory:     NewBollStrategy,
+	})
+}
+
+func NewBollStrategy(map[string]float64) (internal.Strategy, error) {
+	return new(BollStrategy), nil
+}
+
 func (b *BollStrategy) OnBar(data internal.BarData) {
 
 }
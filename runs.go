@@ -0,0 +1,122 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"gocta/internal"
+)
+
+func runRuns(args []string) error {
+	if len(args) == 0 {
+		return errors.New("runs 需要子命令 list、show、compare 或 delete")
+	}
+
+	var (
+		dsn    string
+		filter internal.RunFilter
+	)
+	fs := flag.NewFlagSet("runs "+args[0], flag.ExitOnError)
+	fs.StringVar(&dsn, "dsn", "", "结果库 mysql 数据源")
+	fs.StringVar(&filter.Strategy, "strategy", "", "只列出该策略的记录")
+	fs.StringVar(&filter.Symbol, "symbol", "", "只列出该合约的记录")
+	fs.IntVar(&filter.Limit, "limit", 20, "最多列出几条记录")
+	fs.Parse(args[1:])
+
+	if dsn == "" {
+		return errors.New("dsn不能为空")
+	}
+	ids, err := parseIDs(fs.Args())
+	if err != nil {
+		return err
+	}
+	store, err := internal.NewResultStoreWithDSN(dsn)
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "list":
+		runs, err := store.ListRuns(filter)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "编号\t时间\t策略\t合约\t参数\ttotal_return\tmax_ddpercent\tsharpe_ratio\tcommit")
+		for _, run := range runs {
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%v\t%.2f\t%.2f\t%.2f\t%.8s\n", run.ID, run.CreatedAt.Format("2006-01-02 15:04"),
+				run.Strategy, run.Symbol, run.Params, run.TotalReturn, run.MaxDdpercent, run.SharpeRatio, run.GitCommit)
+		}
+		return w.Flush()
+	case "show":
+		if len(ids) != 1 {
+			return errors.New("show 需要一个记录编号")
+		}
+		run, err := store.GetRun(ids[0])
+		if err != nil {
+			return err
+		}
+		fmt.Printf("编号: %d  策略: %s  参数: %v  commit: %s  指纹: %s\n", run.ID, run.Strategy, run.Params, run.GitCommit, run.Fingerprint)
+		printStatistics(os.Stdout, run.Statistics)
+		return nil
+	case "compare":
+		runs, err := store.CompareRuns(ids...)
+		if err != nil {
+			return err
+		}
+		printComparison(runs)
+		return nil
+	case "delete":
+		if len(ids) == 0 {
+			return errors.New("delete 需要记录编号")
+		}
+		for _, id := range ids {
+			if err = store.DeleteRun(id); err != nil {
+				return err
+			}
+			fmt.Println("已删除回测记录:", id)
+		}
+		return nil
+	default:
+		return fmt.Errorf("未知子命令: runs %s", args[0])
+	}
+}
+
+// printComparison 每行一个统计指标，每列一条回测记录
+func printComparison(runs []internal.BacktestRun) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprint(w, "指标")
+	for _, run := range runs {
+		fmt.Fprintf(w, "\t#%d %s %v", run.ID, run.Strategy, run.Params)
+	}
+	fmt.Fprintln(w)
+	for _, key := range internal.StatisticKeys {
+		fmt.Fprint(w, key)
+		for _, run := range runs {
+			switch value := run.Statistics[key].(type) {
+			case float64:
+				fmt.Fprintf(w, "\t%.2f", value)
+			default:
+				fmt.Fprintf(w, "\t%v", value)
+			}
+		}
+		fmt.Fprintln(w)
+	}
+	w.Flush()
+}
+
+func parseIDs(args []string) ([]uint, error) {
+	ids := make([]uint, 0, len(args))
+	for _, arg := range args {
+		id, err := strconv.ParseUint(arg, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("记录编号错误: %s", arg)
+		}
+		ids = append(ids, uint(id))
+	}
+	return ids, nil
+}
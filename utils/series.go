@@ -54,6 +54,22 @@ func CumSumSeries(a series.Series, name string, capital float64) series.Series {
 	return series.New(result, series.Float, name)
 }
 
+func CumMaxSeries(a series.Series, name string) series.Series {
+	if name == "" {
+		name = a.Name
+	}
+	aSlice := a.Float()
+	result := make([]float64, len(aSlice))
+	for i, v := range aSlice {
+		if i == 0 || v > result[i-1] {
+			result[i] = v
+		} else {
+			result[i] = result[i-1]
+		}
+	}
+	return series.New(result, series.Float, name)
+}
+
 func GreaterSeries(a series.Series, greater float64) (count int) {
 	aSlice := a.Float()
 	for _, v := range aSlice {